@@ -0,0 +1,124 @@
+// Команда cache-sev-server обслуживает кэш lru или lfu по протоколу Redis (RESP2/RESP3),
+// memcached (текстовый и мета-протокол) или HTTP (REST/JSON).
+//
+//	cache-sev-server -addr 127.0.0.1:6379 -policy lfu -capacity 100000
+//	cache-sev-server -addr 127.0.0.1:11211 -protocol memcache -max-bytes 67108864
+//	cache-sev-server -addr 127.0.0.1:8080 -protocol http
+//	cache-sev-server -addr 127.0.0.1:6379 -metrics 127.0.0.1:9100
+package main
+
+import (
+	"errors"
+	"expvar"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+	"github.com/ivansevryukov1995/cache-sev/pkg/metrics"
+	"github.com/ivansevryukov1995/cache-sev/pkg/rest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/server"
+)
+
+// listener - общий интерфейс серверов Redis и memcached
+type listener interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6379", "адрес для входящих подключений")
+	protocol := flag.String("protocol", "resp", "протокол: resp, memcache или http")
+	policy := flag.String("policy", "lru", "политика вытеснения: lru или lfu")
+	capacity := flag.Int("capacity", 10000, "наибольшее число ключей")
+	maxBytes := flag.Int64("max-bytes", 0, "наибольший объем данных memcache в байтах вместо -capacity")
+	metricsAddr := flag.String("metrics", "", "адрес HTTP для метрик Prometheus (/metrics) и отладочных страниц (/debug/cache, /debug/vars), пустой - не публиковать")
+	flag.Parse()
+
+	if *policy != "lru" && *policy != "lfu" {
+		log.Fatalf("Неизвестная политика вытеснения %q\n", *policy)
+	}
+
+	var s listener
+	var cache any
+	switch *protocol {
+	case "resp":
+		backend := newBackend(*policy, *capacity)
+		s, cache = server.New(backend, *policy), backend
+	case "http":
+		backend := newBackend(*policy, *capacity)
+		s, cache = &httpServer{srv: &http.Server{Handler: rest.NewHandler(backend, rest.Options{})}}, backend
+	case "memcache":
+		backend := newMemcacheBackend(*policy, *capacity, *maxBytes)
+		s, cache = server.NewMemcache(backend, *policy), backend
+	default:
+		log.Fatalf("Неизвестный протокол %q\n", *protocol)
+	}
+
+	if *metricsAddr != "" {
+		metrics.Register(*protocol, *policy, cache.(metrics.Source))
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/debug/cache", metrics.DebugHandler())
+		expvar.Publish("caches", metrics.Default.Var())
+		mux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Fatal(http.ListenAndServe(*metricsAddr, mux))
+		}()
+	}
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		s.Close()
+	}()
+
+	log.Printf("Кэш %s (%s) слушает %s\n", *policy, *protocol, *addr)
+	if err := s.ListenAndServe(*addr); err != nil && !errors.Is(err, server.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// newBackend создает кэш для протоколов Redis и HTTP.
+func newBackend(policy string, capacity int) server.Backend {
+	if policy == "lfu" {
+		return lfu.NewCache[string, []byte](capacity)
+	}
+	return lru.NewCache[string, []byte](capacity)
+}
+
+// httpServer приводит http.Server к интерфейсу listener
+type httpServer struct {
+	srv *http.Server
+}
+
+func (h *httpServer) ListenAndServe(addr string) error {
+	h.srv.Addr = addr
+	if err := h.srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return server.ErrServerClosed
+}
+
+func (h *httpServer) Close() error {
+	return h.srv.Close()
+}
+
+// newMemcacheBackend создает кэш, ограниченный числом ключей или, при maxBytes > 0, объемом данных.
+func newMemcacheBackend(policy string, capacity int, maxBytes int64) server.MemcacheBackend {
+	switch {
+	case policy == "lfu" && maxBytes > 0:
+		return lfu.NewWeightedCache(maxBytes, server.ItemWeight)
+	case policy == "lfu":
+		return lfu.NewCache[string, server.Item](capacity)
+	case maxBytes > 0:
+		return lru.NewWeightedCache(maxBytes, server.ItemWeight)
+	default:
+		return lru.NewCache[string, server.Item](capacity)
+	}
+}
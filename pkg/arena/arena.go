@@ -0,0 +1,368 @@
+package arena
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Формат записи в кольцевом буфере шарда (little endian):
+//
+//	[0:4]   полная длина записи вместе с заголовком
+//	[4:12]  время истечения срока жизни в наносекундах Unix, 0 - без TTL
+//	[12:20] хеш ключа
+//	[20:22] длина ключа
+//	[22:]   ключ, затем значение
+//
+// Нулевая длина записи означает маркер перехода в начало буфера.
+const (
+	headerSize   = 22
+	lenPrefix    = 4
+	maxKeyLength = math.MaxUint16
+	maxShardSize = math.MaxUint32
+)
+
+// Stats - счетчики кэша, суммированные по всем шардам.
+type Stats struct {
+	Entries        int
+	Hits           int64
+	Misses         int64
+	Evictions      int64 // живые записи, вытесненные по FIFO
+	Expired        int64 // записи, удаленные по истечении TTL
+	Collisions     int64 // перезаписи записи с другим ключом и тем же хешем
+	Rejected       int64 // записи, которые не помещаются в шард
+	UsedBytes      int64 // занятые байты буфера, включая мертвые записи
+	DeadBytes      int64 // байты удаленных и перезаписанных записей, еще лежащие в буфере
+	Compactions    int64
+	ReclaimedBytes int64 // байты, освобожденные уплотнением
+}
+
+// Cache хранит значения []byte в заранее выделенных кольцевых буферах.
+// Индекс шарда отображает хеш ключа в смещение записи и не содержит указателей,
+// поэтому сборщик мусора почти не сканирует память кэша.
+type Cache struct {
+	shards []shard
+	mask   uint64
+	clock  pkg.Clock
+}
+
+// NewCache создает кэш общим объемом capacity байт, разделенный на shards шардов.
+// Количество шардов округляется вверх до степени двойки.
+func NewCache(capacity int, shards int) *Cache {
+	if shards < 1 {
+		shards = 1
+	}
+	count := 1
+	for count < shards {
+		count <<= 1
+	}
+	shardSize := capacity / count
+	if shardSize > maxShardSize {
+		shardSize = maxShardSize
+	}
+
+	c := &Cache{
+		shards: make([]shard, count),
+		mask:   uint64(count - 1),
+		clock:  pkg.SystemClock,
+	}
+	for i := range c.shards {
+		c.shards[i].buf = make([]byte, shardSize)
+		c.shards[i].index = make(map[uint64]uint32)
+	}
+	return c
+}
+
+// Get возвращает копию значения по ключу.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	hash := hashKey(key)
+	return c.shard(hash).get(key, hash, c.clock.Now().UnixNano())
+}
+
+// Put записывает значение в конец кольцевого буфера шарда.
+// Если места не хватает, самые старые записи шарда вытесняются.
+func (c *Cache) Put(key string, value []byte, ttl time.Duration) {
+	var expiresAt int64
+	now := c.clock.Now().UnixNano()
+	if ttl > 0 {
+		expiresAt = now + int64(ttl)
+	}
+	hash := hashKey(key)
+	c.shard(hash).put(key, hash, value, expiresAt)
+}
+
+// SetClock задает часы, по которым отсчитываются сроки жизни, по умолчанию pkg.SystemClock.
+// nil возвращает системные часы. Часы задаются до начала использования кэша: Get и Put
+// читают их без блокировки.
+func (c *Cache) SetClock(clock pkg.Clock) {
+	if clock == nil {
+		clock = pkg.SystemClock
+	}
+	c.clock = clock
+}
+
+// Delete удаляет ключ из кэша. Место в буфере освобождается при вытеснении или уплотнении.
+func (c *Cache) Delete(key string) bool {
+	hash := hashKey(key)
+	return c.shard(hash).delete(key, hash)
+}
+
+// Len возвращает количество живых записей.
+func (c *Cache) Len() int {
+	var n int
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.lock.Lock()
+		n += len(s.index)
+		s.lock.Unlock()
+	}
+	return n
+}
+
+// Stats возвращает счетчики всех шардов.
+func (c *Cache) Stats() Stats {
+	var st Stats
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.lock.Lock()
+		st.Entries += len(s.index)
+		st.Hits += s.stats.Hits
+		st.Misses += s.stats.Misses
+		st.Evictions += s.stats.Evictions
+		st.Expired += s.stats.Expired
+		st.Collisions += s.stats.Collisions
+		st.Rejected += s.stats.Rejected
+		st.UsedBytes += int64(s.size)
+		st.DeadBytes += int64(s.dead)
+		st.Compactions += s.stats.Compactions
+		st.ReclaimedBytes += s.stats.ReclaimedBytes
+		s.lock.Unlock()
+	}
+	return st
+}
+
+func (c *Cache) shard(hash uint64) *shard {
+	return &c.shards[hash&c.mask]
+}
+
+// hashKey - FNV-1a без преобразования строки в []byte.
+func hashKey(key string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	hash := uint64(offset64)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint64(key[i])
+		hash *= prime64
+	}
+	return hash
+}
+
+// shard - кольцевой буфер записей в порядке добавления.
+// Записи занимают байты от head до tail, size учитывает в том числе хвост буфера,
+// пропущенный при переходе в начало.
+type shard struct {
+	lock  sync.Mutex
+	buf   []byte
+	index map[uint64]uint32
+	head  int
+	tail  int
+	size  int
+	dead  int
+	stats Stats
+}
+
+func (s *shard) get(key string, hash uint64, now int64) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	off, ok := s.index[hash]
+	if !ok || !s.keyEquals(int(off), key) {
+		s.stats.Misses++
+		return nil, false
+	}
+	if expiresAt := s.entryExpiresAt(int(off)); expiresAt != 0 && now >= expiresAt {
+		s.killLocked(hash, int(off))
+		s.stats.Expired++
+		s.stats.Misses++
+		return nil, false
+	}
+	s.stats.Hits++
+
+	value := s.entryValue(int(off))
+	result := make([]byte, len(value))
+	copy(result, value)
+	return result, true
+}
+
+func (s *shard) put(key string, hash uint64, value []byte, expiresAt int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if off, ok := s.index[hash]; ok {
+		if !s.keyEquals(int(off), key) {
+			s.stats.Collisions++
+		}
+		s.killLocked(hash, int(off))
+	}
+
+	n := headerSize + len(key) + len(value)
+	if len(key) > maxKeyLength || n > len(s.buf) {
+		s.stats.Rejected++
+		return
+	}
+
+	off := s.reserveLocked(n)
+	entry := s.buf[off : off+n]
+	binary.LittleEndian.PutUint32(entry[0:], uint32(n))
+	binary.LittleEndian.PutUint64(entry[4:], uint64(expiresAt))
+	binary.LittleEndian.PutUint64(entry[12:], hash)
+	binary.LittleEndian.PutUint16(entry[20:], uint16(len(key)))
+	copy(entry[headerSize:], key)
+	copy(entry[headerSize+len(key):], value)
+
+	s.tail = off + n
+	s.size += n
+	s.index[hash] = uint32(off)
+}
+
+func (s *shard) delete(key string, hash uint64) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	off, ok := s.index[hash]
+	if !ok || !s.keyEquals(int(off), key) {
+		return false
+	}
+	s.killLocked(hash, int(off))
+	return true
+}
+
+// killLocked убирает запись из индекса, оставляя ее байты мертвыми до вытеснения.
+func (s *shard) killLocked(hash uint64, off int) {
+	delete(s.index, hash)
+	s.dead += s.entryLen(off)
+}
+
+// reserveLocked возвращает смещение непрерывного участка из n байт в конце очереди,
+// освобождая место вытеснением самых старых записей или уплотнением.
+func (s *shard) reserveLocked(n int) int {
+	for {
+		if s.size == 0 {
+			s.head, s.tail = 0, 0
+		}
+		if s.tail > s.head || s.size == 0 {
+			if len(s.buf)-s.tail >= n {
+				return s.tail
+			}
+			if s.head >= n {
+				// Хвост буфера пропускается, запись начинается с нуля
+				if len(s.buf)-s.tail >= lenPrefix {
+					binary.LittleEndian.PutUint32(s.buf[s.tail:], 0)
+				}
+				s.size += len(s.buf) - s.tail
+				s.tail = 0
+				return 0
+			}
+		} else if s.head-s.tail >= n {
+			return s.tail
+		}
+
+		// Если живую запись пришлось бы вытеснить при большом объеме мертвых байт,
+		// выгоднее уплотнить буфер
+		if s.dead >= n && s.dead*2 >= s.size && s.isLiveLocked(s.head) {
+			s.compactLocked()
+			continue
+		}
+		s.evictOldestLocked()
+	}
+}
+
+// isLiveLocked сообщает, находится ли по смещению off живая запись.
+func (s *shard) isLiveLocked(off int) bool {
+	if s.isWrapMarker(off) {
+		return false
+	}
+	idx, ok := s.index[s.entryHash(off)]
+	return ok && int(idx) == off
+}
+
+// evictOldestLocked удаляет запись в начале очереди.
+func (s *shard) evictOldestLocked() {
+	if s.isWrapMarker(s.head) {
+		s.size -= len(s.buf) - s.head
+		s.head = 0
+		return
+	}
+
+	n := s.entryLen(s.head)
+	if s.isLiveLocked(s.head) {
+		delete(s.index, s.entryHash(s.head))
+		s.stats.Evictions++
+	} else {
+		s.dead -= n
+	}
+	s.head += n
+	s.size -= n
+}
+
+// compactLocked переносит живые записи в новый буфер, сохраняя порядок FIFO.
+func (s *shard) compactLocked() {
+	buf := make([]byte, len(s.buf))
+	var w int
+	pos, remaining := s.head, s.size
+	for remaining > 0 {
+		if s.isWrapMarker(pos) {
+			remaining -= len(s.buf) - pos
+			pos = 0
+			continue
+		}
+		n := s.entryLen(pos)
+		if s.isLiveLocked(pos) {
+			copy(buf[w:], s.buf[pos:pos+n])
+			s.index[s.entryHash(pos)] = uint32(w)
+			w += n
+		}
+		pos += n
+		remaining -= n
+	}
+
+	s.stats.Compactions++
+	s.stats.ReclaimedBytes += int64(s.dead)
+	s.buf = buf
+	s.head = 0
+	s.tail = w
+	s.size = w
+	s.dead = 0
+}
+
+func (s *shard) isWrapMarker(off int) bool {
+	return len(s.buf)-off < lenPrefix || binary.LittleEndian.Uint32(s.buf[off:]) == 0
+}
+
+func (s *shard) entryLen(off int) int {
+	return int(binary.LittleEndian.Uint32(s.buf[off:]))
+}
+
+func (s *shard) entryExpiresAt(off int) int64 {
+	return int64(binary.LittleEndian.Uint64(s.buf[off+4:]))
+}
+
+func (s *shard) entryHash(off int) uint64 {
+	return binary.LittleEndian.Uint64(s.buf[off+12:])
+}
+
+// keyEquals сравнивает ключ записи с key без выделения памяти.
+func (s *shard) keyEquals(off int, key string) bool {
+	keyLen := int(binary.LittleEndian.Uint16(s.buf[off+20:]))
+	return string(s.buf[off+headerSize:off+headerSize+keyLen]) == key
+}
+
+func (s *shard) entryValue(off int) []byte {
+	keyLen := int(binary.LittleEndian.Uint16(s.buf[off+20:]))
+	return s.buf[off+headerSize+keyLen : off+s.entryLen(off)]
+}
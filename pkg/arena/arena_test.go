@@ -0,0 +1,167 @@
+package arena
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+)
+
+func TestCachePutAndGet(t *testing.T) {
+	cache := NewCache(1024, 1)
+
+	cache.Put("key1", []byte("value1"), 0)
+	if v, found := cache.Get("key1"); !found || string(v) != "value1" {
+		t.Errorf("Expected value1, got %s (found: %v)", v, found)
+	}
+
+	cache.Put("key1", []byte("value_updated"), 0)
+	if v, found := cache.Get("key1"); !found || string(v) != "value_updated" {
+		t.Errorf("Expected value_updated, got %s (found: %v)", v, found)
+	}
+
+	if !cache.Delete("key1") {
+		t.Error("Expected key1 to be deleted")
+	}
+	if _, found := cache.Get("key1"); found {
+		t.Error("Expected key1 to be missing after delete")
+	}
+
+	st := cache.Stats()
+	if st.Entries != 0 || st.DeadBytes == 0 {
+		t.Errorf("Expected no entries and dead bytes, got %+v", st)
+	}
+}
+
+// Шард вытесняет самые старые записи по FIFO
+func TestCacheFIFOEviction(t *testing.T) {
+	entry := headerSize + len("key0") + len("value0")
+	cache := NewCache(entry*3, 1)
+
+	for i := 0; i < 4; i++ {
+		cache.Put(fmt.Sprintf("key%d", i), []byte(fmt.Sprintf("value%d", i)), 0)
+	}
+
+	if _, found := cache.Get("key0"); found {
+		t.Error("Expected key0 to be evicted")
+	}
+	for i := 1; i < 4; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, found := cache.Get(key); !found || string(v) != fmt.Sprintf("value%d", i) {
+			t.Errorf("Expected to find %s, got %s (found: %v)", key, v, found)
+		}
+	}
+	if st := cache.Stats(); st.Evictions != 1 {
+		t.Errorf("Expected 1 eviction, got %d", st.Evictions)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache(1024, 1)
+	cache.SetClock(clock)
+
+	cache.Put("key1", []byte("value1"), time.Millisecond*50)
+	cache.Put("key2", []byte("value2"), 0)
+	clock.Advance(time.Millisecond * 49)
+	if _, found := cache.Get("key1"); !found {
+		t.Error("Expected key1 to be present before its TTL")
+	}
+	clock.Advance(time.Millisecond)
+
+	if _, found := cache.Get("key1"); found {
+		t.Error("Expected key1 to be expired")
+	}
+	if _, found := cache.Get("key2"); !found {
+		t.Error("Expected key2 to be present")
+	}
+	if st := cache.Stats(); st.Expired != 1 {
+		t.Errorf("Expected 1 expired entry, got %d", st.Expired)
+	}
+}
+
+// Перезаписи одного ключа копят мертвые байты, которые освобождаются уплотнением,
+// не вытесняя живые записи
+func TestCacheCompaction(t *testing.T) {
+	entry := headerSize + len("key0") + len("value0")
+	cache := NewCache(entry*4, 1)
+
+	cache.Put("key0", []byte("value0"), 0)
+	cache.Put("key1", []byte("value1"), 0)
+	cache.Put("key2", []byte("value2"), 0)
+	cache.Put("key2", []byte("value3"), 0)
+	cache.Put("key2", []byte("value4"), 0)
+
+	st := cache.Stats()
+	if st.Compactions != 1 || st.ReclaimedBytes != int64(2*entry) {
+		t.Errorf("Expected 1 compaction reclaiming %d bytes, got %+v", 2*entry, st)
+	}
+	if st.Evictions != 0 {
+		t.Errorf("Expected no evictions, got %d", st.Evictions)
+	}
+	for i, want := range []string{"value0", "value1", "value4"} {
+		if v, found := cache.Get(fmt.Sprintf("key%d", i)); !found || string(v) != want {
+			t.Errorf("Expected %s, got %s (found: %v)", want, v, found)
+		}
+	}
+}
+
+func TestCacheRejectsLargeValue(t *testing.T) {
+	cache := NewCache(64, 1)
+
+	cache.Put("key1", make([]byte, 64), 0)
+	if _, found := cache.Get("key1"); found {
+		t.Error("Expected oversized value to be rejected")
+	}
+	if st := cache.Stats(); st.Rejected != 1 {
+		t.Errorf("Expected 1 rejected entry, got %d", st.Rejected)
+	}
+}
+
+// Случайные операции с переходом через конец буфера: найденное значение
+// всегда должно совпадать с последним записанным
+func TestCacheWrapAround(t *testing.T) {
+	cache := NewCache(4096, 4)
+	model := make(map[string]string)
+	rnd := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("key%d", rnd.Intn(200))
+		switch rnd.Intn(4) {
+		case 0:
+			cache.Delete(key)
+			delete(model, key)
+		case 1:
+			if v, found := cache.Get(key); found && string(v) != model[key] {
+				t.Fatalf("Key %s: expected %q, got %q", key, model[key], v)
+			}
+		default:
+			value := fmt.Sprintf("%d-%s", i, make([]byte, rnd.Intn(64)))
+			cache.Put(key, []byte(value), 0)
+			model[key] = value
+		}
+	}
+
+	st := cache.Stats()
+	if st.UsedBytes > 4096 || st.DeadBytes > st.UsedBytes {
+		t.Errorf("Inconsistent byte counters: %+v", st)
+	}
+}
+
+func BenchmarkCacheGetHit(b *testing.B) {
+	const size = 1024
+	cache := NewCache(1<<20, 16)
+	keys := make([]string, size)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		cache.Put(keys[i], []byte("value"), 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(keys[i%size])
+	}
+}
@@ -0,0 +1,453 @@
+// Package backing связывает кэш в памяти с постоянным хранилищем: промахи загружаются
+// из хранилища, а записи попадают в него синхронно (write-through) или пачками в фоне (write-behind).
+package backing
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Store - постоянное хранилище за кэшем.
+type Store[KeyT comparable, ValueT any] interface {
+	Load(key KeyT) (ValueT, bool, error)
+	Store(key KeyT, value ValueT) error
+	Delete(key KeyT) error
+}
+
+// Entry - отложенная запись в хранилище.
+type Entry[KeyT comparable, ValueT any] struct {
+	Key     KeyT
+	Value   ValueT
+	Deleted bool
+}
+
+// BatchStore реализуют хранилища, умеющие записывать пачку изменений за одну операцию.
+type BatchStore[KeyT comparable, ValueT any] interface {
+	StoreBatch(entries []Entry[KeyT, ValueT]) error
+}
+
+// Memory - кэш в памяти. Его реализуют lru.Cache и lfu.Cache.
+type Memory[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	OnEvict(fn func(e pkg.Eviction[KeyT, ValueT]))
+}
+
+// Mode определяет, когда изменения попадают в хранилище.
+type Mode int
+
+const (
+	// WriteThrough записывает изменение в хранилище до обновления кэша.
+	WriteThrough Mode = iota
+	// WriteBehind помечает элемент грязным и записывает изменения в фоне пачками.
+	// Повторные записи одного ключа до сброса объединяются.
+	WriteBehind
+)
+
+const (
+	defaultFlushInterval = time.Second
+	defaultBatchSize     = 100
+	defaultMaxBackoff    = 30 * time.Second
+)
+
+// ErrClosed возвращается при записи в закрытый кэш.
+var ErrClosed = errors.New("backing: cache closed")
+
+// Options - настройки кэша. Нулевое значение - сквозная запись.
+type Options struct {
+	Mode Mode
+	// LoadTTL - время жизни значений, загруженных из хранилища. 0 - без ограничения.
+	LoadTTL time.Duration
+	// FlushInterval - период фонового сброса. По умолчанию 1 секунда.
+	FlushInterval time.Duration
+	// BatchSize - наибольший размер пачки. Накопление BatchSize грязных элементов
+	// запускает сброс досрочно. По умолчанию 100.
+	BatchSize int
+	// MaxBackoff - наибольшая пауза между повторами неудачного сброса. По умолчанию 30 секунд.
+	MaxBackoff time.Duration
+	// OnError получает ошибки хранилища, которые не могут быть возвращены вызывающему.
+	OnError func(err error)
+	// Clock - часы, по которым истекают несброшенные записи. Совпадают с часами memory,
+	// по умолчанию pkg.SystemClock.
+	Clock pkg.Clock
+}
+
+// Stats - счетчики записи в хранилище.
+type Stats struct {
+	Loads        int64
+	Writes       int64 // записи и удаления, переданные хранилищу
+	Batches      int64
+	Coalesced    int64 // записи, замененные более новой до сброса
+	Errors       int64
+	Dirty        int   // элементы, ожидающие записи
+	EvictedDirty int64 // грязные элементы, вытесненные из памяти до сброса
+}
+
+type pending[ValueT any] struct {
+	value     ValueT
+	deleted   bool
+	expiresAt time.Time // срок жизни значения в кэше, нулевое значение - без ограничения
+	seq       uint64
+}
+
+// Cache - кэш в памяти, синхронизированный с хранилищем.
+type Cache[KeyT comparable, ValueT any] struct {
+	memory Memory[KeyT, ValueT]
+	store  Store[KeyT, ValueT]
+	opts   Options
+
+	// mu упорядочивает записи и заполнение кэша загруженными значениями
+	mu  sync.Mutex
+	gen uint64
+
+	// dirtyMu защищает очередь отложенных записей. Берется и из обработчика вытеснения,
+	// поэтому под ним нельзя обращаться к memory
+	dirtyMu sync.Mutex
+	dirty   map[KeyT]pending[ValueT]
+	seq     uint64
+	closed  bool
+	stats   Stats
+
+	flushMu sync.Mutex
+	flush   chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewCache создает кэш над memory и store. В режиме WriteBehind запускается фоновый сброс,
+// который останавливает Close.
+func NewCache[KeyT comparable, ValueT any](memory Memory[KeyT, ValueT], store Store[KeyT, ValueT], opts Options) *Cache[KeyT, ValueT] {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultFlushInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.Clock == nil {
+		opts.Clock = pkg.SystemClock
+	}
+
+	c := &Cache[KeyT, ValueT]{
+		memory: memory,
+		store:  store,
+		opts:   opts,
+		dirty:  make(map[KeyT]pending[ValueT]),
+		flush:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	memory.OnEvict(c.onEvict)
+
+	if opts.Mode == WriteBehind {
+		c.wg.Add(1)
+		go c.flushLoop()
+	}
+	return c
+}
+
+// Get возвращает значение из памяти, из очереди несброшенных записей или из хранилища.
+func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	if value, ok := c.memory.Get(key); ok {
+		return value, true
+	}
+
+	var zeroValue ValueT
+
+	// Грязный элемент мог быть вытеснен из памяти раньше, чем попал в хранилище.
+	// Истекший элемент - промах, хотя его запись в хранилище еще не сброшена
+	c.dirtyMu.Lock()
+	p, ok := c.dirty[key]
+	c.dirtyMu.Unlock()
+	if ok {
+		if p.deleted || !p.expiresAt.IsZero() && !c.opts.Clock.Now().Before(p.expiresAt) {
+			return zeroValue, false
+		}
+		return p.value, true
+	}
+
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	value, ok, err := c.store.Load(key)
+	c.dirtyMu.Lock()
+	c.stats.Loads++
+	c.dirtyMu.Unlock()
+	if err != nil {
+		c.reportError(err)
+		return zeroValue, false
+	}
+	if !ok {
+		return zeroValue, false
+	}
+
+	// Загруженное значение не должно затереть запись, сделанную во время загрузки
+	c.mu.Lock()
+	if c.gen == gen {
+		c.memory.Put(key, value, c.opts.LoadTTL)
+	}
+	c.mu.Unlock()
+	return value, true
+}
+
+// Put обновляет кэш. В режиме WriteThrough значение сначала записывается в хранилище;
+// при ошибке устаревшее значение удаляется из кэша, а ошибка передается в OnError.
+func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
+	if err := c.Set(key, value, ttl); err != nil {
+		c.reportError(err)
+	}
+}
+
+// Set - Put, возвращающий ошибку сквозной записи.
+func (c *Cache[KeyT, ValueT]) Set(key KeyT, value ValueT, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if c.opts.Mode == WriteThrough {
+		if err := c.store.Store(key, value); err != nil {
+			c.countError()
+			c.memory.Delete(key)
+			return err
+		}
+		c.countWrites(1)
+		c.memory.Put(key, value, ttl)
+		return nil
+	}
+
+	p := pending[ValueT]{value: value}
+	if ttl > 0 {
+		p.expiresAt = c.opts.Clock.Now().Add(ttl)
+	}
+	if err := c.markDirty(key, p); err != nil {
+		return err
+	}
+	c.memory.Put(key, value, ttl)
+	return nil
+}
+
+// Delete удаляет ключ из кэша и хранилища. Возвращает false, если ключа не было в памяти.
+// Ошибка хранилища в режиме WriteThrough передается в OnError.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	deleted := c.memory.Delete(key)
+	if c.opts.Mode == WriteThrough {
+		if err := c.store.Delete(key); err != nil {
+			c.countError()
+			c.reportError(err)
+			return deleted
+		}
+		c.countWrites(1)
+		return deleted
+	}
+	if err := c.markDirty(key, pending[ValueT]{deleted: true}); err != nil {
+		c.reportError(err)
+	}
+	return deleted
+}
+
+// Flush синхронно записывает в хранилище все грязные элементы.
+func (c *Cache[KeyT, ValueT]) Flush() error {
+	for {
+		n, err := c.flushBatch()
+		if err != nil || n == 0 {
+			return err
+		}
+	}
+}
+
+// Close останавливает фоновый сброс и записывает оставшиеся грязные элементы.
+// Если хранилище недоступно, ошибка возвращается, а элементы остаются в очереди.
+func (c *Cache[KeyT, ValueT]) Close() error {
+	c.dirtyMu.Lock()
+	if c.closed {
+		c.dirtyMu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.dirtyMu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+	return c.Flush()
+}
+
+// Stats возвращает счетчики записи в хранилище.
+func (c *Cache[KeyT, ValueT]) Stats() Stats {
+	c.dirtyMu.Lock()
+	defer c.dirtyMu.Unlock()
+
+	st := c.stats
+	st.Dirty = len(c.dirty)
+	return st
+}
+
+func (c *Cache[KeyT, ValueT]) markDirty(key KeyT, p pending[ValueT]) error {
+	c.dirtyMu.Lock()
+	defer c.dirtyMu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+	if _, ok := c.dirty[key]; ok {
+		c.stats.Coalesced++
+	}
+	c.seq++
+	p.seq = c.seq
+	c.dirty[key] = p
+	if len(c.dirty) >= c.opts.BatchSize {
+		c.signalFlush()
+	}
+	return nil
+}
+
+// onEvict не дает вытеснению молча потерять грязный элемент: значение остается
+// в очереди, а сброс запускается немедленно.
+func (c *Cache[KeyT, ValueT]) onEvict(e pkg.Eviction[KeyT, ValueT]) {
+	c.dirtyMu.Lock()
+	defer c.dirtyMu.Unlock()
+
+	if p, ok := c.dirty[e.Key]; ok && !p.deleted {
+		c.stats.EvictedDirty++
+		c.signalFlush()
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) signalFlush() {
+	select {
+	case c.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) flushLoop() {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(c.opts.FlushInterval)
+	defer timer.Stop()
+	backoff := c.opts.FlushInterval
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.flush:
+		case <-timer.C:
+		}
+
+		err := c.Flush()
+		if err != nil {
+			backoff = min(backoff*2, c.opts.MaxBackoff)
+		} else {
+			backoff = c.opts.FlushInterval
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(backoff)
+
+		// После ошибки досрочный сброс не должен обходить паузу перед повтором
+		if err != nil {
+			select {
+			case <-c.done:
+				return
+			case <-timer.C:
+				timer.Reset(backoff)
+			}
+		}
+	}
+}
+
+// flushBatch записывает до BatchSize грязных элементов и возвращает их количество.
+func (c *Cache[KeyT, ValueT]) flushBatch() (int, error) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.dirtyMu.Lock()
+	batch := make([]Entry[KeyT, ValueT], 0, min(len(c.dirty), c.opts.BatchSize))
+	seqs := make([]uint64, 0, cap(batch))
+	for key, p := range c.dirty {
+		if len(batch) == c.opts.BatchSize {
+			break
+		}
+		batch = append(batch, Entry[KeyT, ValueT]{Key: key, Value: p.value, Deleted: p.deleted})
+		seqs = append(seqs, p.seq)
+	}
+	c.dirtyMu.Unlock()
+	if len(batch) == 0 {
+		return 0, nil
+	}
+
+	written, err := c.writeBatch(batch)
+
+	c.dirtyMu.Lock()
+	// Элементы, измененные во время записи, остаются грязными
+	for i := 0; i < written; i++ {
+		if p, ok := c.dirty[batch[i].Key]; ok && p.seq == seqs[i] {
+			delete(c.dirty, batch[i].Key)
+		}
+	}
+	c.stats.Writes += int64(written)
+	c.stats.Batches++
+	if err != nil {
+		c.stats.Errors++
+	}
+	c.dirtyMu.Unlock()
+
+	if err != nil {
+		c.reportError(err)
+	}
+	return written, err
+}
+
+// writeBatch передает пачку хранилищу и возвращает количество записанных элементов.
+func (c *Cache[KeyT, ValueT]) writeBatch(batch []Entry[KeyT, ValueT]) (int, error) {
+	if bs, ok := c.store.(BatchStore[KeyT, ValueT]); ok {
+		if err := bs.StoreBatch(batch); err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+
+	for i, entry := range batch {
+		var err error
+		if entry.Deleted {
+			err = c.store.Delete(entry.Key)
+		} else {
+			err = c.store.Store(entry.Key, entry.Value)
+		}
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(batch), nil
+}
+
+func (c *Cache[KeyT, ValueT]) countWrites(n int64) {
+	c.dirtyMu.Lock()
+	c.stats.Writes += n
+	c.dirtyMu.Unlock()
+}
+
+func (c *Cache[KeyT, ValueT]) countError() {
+	c.dirtyMu.Lock()
+	c.stats.Errors++
+	c.dirtyMu.Unlock()
+}
+
+func (c *Cache[KeyT, ValueT]) reportError(err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
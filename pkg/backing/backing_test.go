@@ -0,0 +1,234 @@
+package backing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// memStore - хранилище в памяти с отказами по требованию
+type memStore struct {
+	mu      sync.Mutex
+	data    map[string]string
+	writes  int
+	batches int
+	fail    bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string]string)}
+}
+
+func (s *memStore) Load(key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+func (s *memStore) Store(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	s.writes++
+	s.data[key] = value
+	return nil
+}
+
+func (s *memStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("store unavailable")
+	}
+	s.writes++
+	delete(s.data, key)
+	return nil
+}
+
+func (s *memStore) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *memStore) setFail(fail bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = fail
+}
+
+// batchStore дополнительно пишет пачками
+type batchStore struct {
+	*memStore
+}
+
+func (s batchStore) StoreBatch(entries []Entry[string, string]) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	for _, e := range entries {
+		if e.Deleted {
+			delete(s.data, e.Key)
+		} else {
+			s.data[e.Key] = e.Value
+		}
+	}
+	return nil
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newMemStore()
+	store.data["key0"] = "value0"
+	var errs []error
+	cache := NewCache[string, string](lru.NewCache[string, string](2), store, Options{
+		OnError: func(err error) { errs = append(errs, err) },
+	})
+	defer cache.Close()
+
+	cache.Put("key1", "value1", 0)
+	if v, _ := store.get("key1"); v != "value1" {
+		t.Errorf("Expected value1 in store, got %v", v)
+	}
+	if v, found := cache.Get("key0"); !found || v != "value0" {
+		t.Errorf("Expected value0 loaded from store, got %v (found: %v)", v, found)
+	}
+
+	store.setFail(true)
+	if err := cache.Set("key1", "value2", 0); err == nil {
+		t.Error("Expected write-through error")
+	}
+	cache.Put("key1", "value3", 0)
+	if len(errs) != 1 {
+		t.Errorf("Expected 1 reported error, got %d", len(errs))
+	}
+	store.setFail(false)
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected failed write to leave value1, got %v (found: %v)", v, found)
+	}
+
+	cache.Delete("key1")
+	if _, ok := store.get("key1"); ok {
+		t.Error("Expected key1 to be deleted from store")
+	}
+}
+
+// Повторные записи объединяются и попадают в хранилище одной пачкой
+func TestWriteBehindCoalescing(t *testing.T) {
+	store := batchStore{newMemStore()}
+	cache := NewCache[string, string](lru.NewCache[string, string](10), store, Options{Mode: WriteBehind, FlushInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		cache.Put("key1", "value1", 0)
+	}
+	cache.Put("key2", "value2", 0)
+	cache.Delete("key2")
+
+	if _, ok := store.get("key1"); ok {
+		t.Error("Expected write-behind not to write synchronously")
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := store.get("key1"); v != "value1" {
+		t.Errorf("Expected value1 in store, got %v", v)
+	}
+	if _, ok := store.get("key2"); ok {
+		t.Error("Expected key2 to be deleted from store")
+	}
+	st := cache.Stats()
+	if store.batches != 1 || st.Coalesced != 5 || st.Dirty != 0 {
+		t.Errorf("Expected one coalesced batch, got %d batches, stats %+v", store.batches, st)
+	}
+}
+
+// Грязный элемент, вытесненный из памяти, не теряется и сбрасывается немедленно
+func TestWriteBehindFlushOnEvict(t *testing.T) {
+	store := newMemStore()
+	cache := NewCache[string, string](lru.NewCache[string, string](1), store, Options{Mode: WriteBehind, FlushInterval: time.Hour})
+	defer cache.Close()
+
+	cache.Put("key1", "value1", 0)
+	cache.Put("key2", "value2", 0) // вытесняет грязный key1
+
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected evicted dirty value1, got %v (found: %v)", v, found)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if v, _ := store.get("key1"); v == "value1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected evicted key1 to be flushed")
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+	if st := cache.Stats(); st.EvictedDirty != 1 {
+		t.Errorf("Expected 1 evicted dirty entry, got %d", st.EvictedDirty)
+	}
+}
+
+// Несброшенная запись с истекшим сроком жизни не возвращается из очереди
+func TestWriteBehindExpiredDirty(t *testing.T) {
+	store := newMemStore()
+	store.setFail(true)
+	clock := cachetest.NewClock(time.Time{})
+	memory := lru.NewCache[string, string](10)
+	memory.SetClock(clock)
+	cache := NewCache[string, string](memory, store, Options{
+		Mode:          WriteBehind,
+		FlushInterval: time.Hour,
+		OnError:       func(err error) {},
+		Clock:         clock,
+	})
+
+	cache.Put("key1", "value1", time.Minute)
+	clock.Advance(time.Minute) // key1 истекает в памяти, запись остается в очереди
+
+	if v, found := cache.Get("key1"); found {
+		t.Errorf("Expected expired dirty key1 to miss, got %v", v)
+	}
+	if st := cache.Stats(); st.Dirty != 1 {
+		t.Errorf("Expected key1 to stay dirty, got %d", st.Dirty)
+	}
+
+	store.setFail(false)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Неудачный сброс повторяется, элементы остаются грязными до успешной записи
+func TestWriteBehindRetry(t *testing.T) {
+	store := newMemStore()
+	store.setFail(true)
+	cache := NewCache[string, string](lru.NewCache[string, string](10), store, Options{
+		Mode:          WriteBehind,
+		FlushInterval: time.Millisecond * 10,
+		MaxBackoff:    time.Millisecond * 20,
+	})
+
+	cache.Put("key1", "value1", 0)
+	time.Sleep(time.Millisecond * 50)
+	if st := cache.Stats(); st.Errors == 0 || st.Dirty != 1 {
+		t.Errorf("Expected failed flush to keep key1 dirty, got %+v", st)
+	}
+
+	store.setFail(false)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := store.get("key1"); v != "value1" {
+		t.Errorf("Expected value1 in store, got %v", v)
+	}
+}
@@ -0,0 +1,266 @@
+package cachetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Cache - методы кэша, поведение которых одинаково для всех политик вытеснения
+// и проверяется общими тестами пакета. Им удовлетворяют *lru.Cache и *lfu.Cache.
+type Cache[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	GetOrLoad(key KeyT, ttl time.Duration, load func(key KeyT) (ValueT, error)) (ValueT, error)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	Contains(key KeyT) bool
+	TTL(key KeyT) (time.Duration, bool)
+	Expire(key KeyT, ttl time.Duration) bool
+	Len() int
+	Weight() int64
+	Clear()
+	Stats() pkg.Stats
+	SetLatencySampling(every int)
+	SetClock(clock pkg.Clock)
+}
+
+// TestTTL проверяет сроки жизни кэша, созданного newCache: Expire и повторный Put меняют
+// срок жизни, ключ удаляется ровно по его истечении, а таймеры замененных сроков и Clear
+// останавливаются. Каждый случай получает новый кэш на ручных часах.
+func TestTTL(t *testing.T, newCache func(capacity int) Cache[string, string]) {
+	tests := []struct {
+		name string
+		do   func(c Cache[string, string], clock *Clock)
+		// Ожидаемое состояние ключа "a" и кэша после do
+		found   bool
+		value   string
+		ttl     time.Duration
+		len     int
+		pending int
+	}{
+		{
+			name: "missing",
+			do:   func(Cache[string, string], *Clock) {},
+		},
+		{
+			name:  "without limit",
+			do:    func(c Cache[string, string], _ *Clock) { c.Put("a", "1", 0) },
+			found: true, value: "1", len: 1,
+		},
+		{
+			name: "expire",
+			do: func(c Cache[string, string], _ *Clock) {
+				c.Put("a", "1", 0)
+				c.Expire("a", 30*time.Millisecond)
+			},
+			found: true, value: "1", ttl: 30 * time.Millisecond, len: 1, pending: 1,
+		},
+		{
+			// Повторный Put без срока снимает срок, заданный Expire
+			name: "put resets expire",
+			do: func(c Cache[string, string], clock *Clock) {
+				c.Put("a", "1", 0)
+				c.Expire("a", 30*time.Millisecond)
+				c.Put("a", "2", 0)
+				clock.Advance(60 * time.Millisecond)
+			},
+			found: true, value: "2", len: 1,
+		},
+		{
+			// Таймер замененного срока остановлен, остался только часовой
+			name: "expire replaces ttl",
+			do: func(c Cache[string, string], clock *Clock) {
+				c.Put("a", "1", 30*time.Millisecond)
+				c.Expire("a", time.Hour)
+				clock.Advance(60 * time.Millisecond)
+			},
+			found: true, value: "1", ttl: time.Hour - 60*time.Millisecond, len: 1, pending: 1,
+		},
+		{
+			name: "before expiry",
+			do: func(c Cache[string, string], clock *Clock) {
+				c.Put("a", "1", 0)
+				c.Expire("a", 10*time.Millisecond)
+				clock.Advance(9 * time.Millisecond)
+			},
+			found: true, value: "1", ttl: time.Millisecond, len: 1, pending: 1,
+		},
+		{
+			name: "expired",
+			do: func(c Cache[string, string], clock *Clock) {
+				c.Put("a", "1", 10*time.Millisecond)
+				c.Put("b", "1", 0)
+				clock.Advance(10 * time.Millisecond)
+			},
+			len: 1,
+		},
+		{
+			name: "clear",
+			do: func(c Cache[string, string], _ *Clock) {
+				c.Put("a", "1", time.Hour)
+				c.Put("b", "1", time.Hour)
+				c.Clear()
+			},
+		},
+		{
+			name: "put after clear",
+			do: func(c Cache[string, string], _ *Clock) {
+				c.Put("a", "1", time.Hour)
+				c.Clear()
+				c.Put("a", "2", 0)
+			},
+			found: true, value: "2", len: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewClock(time.Time{})
+			cache := newCache(2)
+			cache.SetClock(clock)
+			tt.do(cache, clock)
+
+			if ttl, ok := cache.TTL("a"); ok != tt.found || ttl != tt.ttl {
+				t.Errorf("TTL = %v, %v, want %v, %v", ttl, ok, tt.ttl, tt.found)
+			}
+			if v, ok := cache.Get("a"); ok != tt.found || v != tt.value {
+				t.Errorf("Get = %q, %v, want %q, %v", v, ok, tt.value, tt.found)
+			}
+			if cache.Len() != tt.len {
+				t.Errorf("Len() = %d, want %d", cache.Len(), tt.len)
+			}
+			if clock.Pending() != tt.pending {
+				t.Errorf("Pending() = %d, want %d", clock.Pending(), tt.pending)
+			}
+			if !tt.found && cache.Expire("a", time.Second) {
+				t.Error("Expire of missing key succeeded")
+			}
+		})
+	}
+}
+
+// TestWeighted проверяет учет веса кэша, созданного newCache с MaxWeight 10 и весом,
+// равным длине значения. Шаги выполняются по порядку над одним кэшем и не зависят от
+// того, какие элементы выбирает для вытеснения политика.
+func TestWeighted(t *testing.T, newCache func(maxWeight int64, weigh func(key string, value string) int64) Cache[string, string]) {
+	cache := newCache(10, func(key string, value string) int64 { return int64(len(value)) })
+
+	steps := []struct {
+		name   string
+		key    string
+		value  string
+		delete bool
+		// Ожидаемое состояние после шага
+		found  bool
+		weight int64
+		len    int
+	}{
+		{name: "put", key: "a", value: "aaaaa", found: true, weight: 5, len: 1},
+		{name: "fill", key: "b", value: "bbbbb", found: true, weight: 10, len: 2},
+		// Новый элемент вытесняет другой
+		{name: "evict", key: "c", value: "ccccc", found: true, weight: 10, len: 2},
+		// Элемент тяжелее MaxWeight не сохраняется и удаляет прежнее значение
+		{name: "oversized", key: "c", value: "ccccccccccc", weight: 5, len: 1},
+		// Увеличение веса существующего элемента вытесняет другие, но не его самого
+		{name: "add", key: "e", value: "eeeee", found: true, weight: 10, len: 2},
+		{name: "grow", key: "e", value: "eeeeeeeeee", found: true, weight: 10, len: 1},
+		{name: "delete", key: "e", delete: true, len: 0},
+	}
+
+	for _, step := range steps {
+		if step.delete {
+			cache.Delete(step.key)
+		} else {
+			cache.Put(step.key, step.value, 0)
+		}
+		if cache.Contains(step.key) != step.found || cache.Weight() != step.weight || cache.Len() != step.len {
+			t.Fatalf("%s: contains %s %v, weight %d, len %d, want %v, %d, %d", step.name, step.key,
+				cache.Contains(step.key), cache.Weight(), cache.Len(), step.found, step.weight, step.len)
+		}
+	}
+}
+
+// TestStats проверяет счетчики Stats кэша емкостью 1, созданного newCache. Длительность
+// записывается для каждой операции. Каждый случай получает новый кэш на ручных часах.
+func TestStats(t *testing.T, newCache func(capacity int) Cache[string, int]) {
+	loadErr := errors.New("load failed")
+
+	tests := []struct {
+		name string
+		do   func(t *testing.T, c Cache[string, int], clock *Clock)
+		// Ожидаемые счетчики
+		hits, misses, loadErrors int64
+		evicted, expired         int64
+		len                      int
+		gets, puts, loads        int64
+	}{
+		{
+			name: "hits and misses",
+			do: func(t *testing.T, c Cache[string, int], _ *Clock) {
+				c.Put("a", 1, 0)
+				c.Get("a")
+				c.Get("b")
+			},
+			hits: 1, misses: 1, len: 1, gets: 2, puts: 1,
+		},
+		{
+			name: "capacity eviction",
+			do: func(t *testing.T, c Cache[string, int], _ *Clock) {
+				c.Put("a", 1, 0)
+				c.Put("b", 2, 0)
+			},
+			evicted: 1, len: 1, puts: 2,
+		},
+		{
+			name: "expiry",
+			do: func(t *testing.T, c Cache[string, int], clock *Clock) {
+				c.Put("a", 1, time.Second)
+				clock.Advance(time.Second)
+			},
+			expired: 1, puts: 1,
+		},
+		{
+			name: "load",
+			do: func(t *testing.T, c Cache[string, int], _ *Clock) {
+				if _, err := c.GetOrLoad("c", 0, func(string) (int, error) { return 0, loadErr }); err != loadErr {
+					t.Errorf("GetOrLoad error = %v", err)
+				}
+				if v, err := c.GetOrLoad("c", 0, func(string) (int, error) { return 3, nil }); err != nil || v != 3 {
+					t.Errorf("GetOrLoad = %v, %v", v, err)
+				}
+				if v, _ := c.GetOrLoad("c", 0, nil); v != 3 {
+					t.Errorf("GetOrLoad hit = %v", v)
+				}
+			},
+			hits: 1, misses: 2, loadErrors: 1, len: 1, gets: 3, puts: 1, loads: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewClock(time.Time{})
+			cache := newCache(1)
+			cache.SetClock(clock)
+			cache.SetLatencySampling(1)
+			tt.do(t, cache, clock)
+
+			st := cache.Stats()
+			if st.Hits != tt.hits || st.Misses != tt.misses || st.LoadErrors != tt.loadErrors {
+				t.Errorf("hits %d, misses %d, load errors %d, want %d, %d, %d",
+					st.Hits, st.Misses, st.LoadErrors, tt.hits, tt.misses, tt.loadErrors)
+			}
+			if st.Evictions[pkg.EvictCapacity] != tt.evicted || st.Evictions[pkg.EvictExpired] != tt.expired {
+				t.Errorf("evictions %v, want capacity %d, expired %d", st.Evictions, tt.evicted, tt.expired)
+			}
+			if st.Len != tt.len || st.Weight != int64(tt.len) {
+				t.Errorf("len %d, weight %d, want %d", st.Len, st.Weight, tt.len)
+			}
+			if st.GetLatency.Count != tt.gets || st.PutLatency.Count != tt.puts || st.LoadLatency.Count != tt.loads {
+				t.Errorf("latency counts get %d, put %d, load %d, want %d, %d, %d",
+					st.GetLatency.Count, st.PutLatency.Count, st.LoadLatency.Count, tt.gets, tt.puts, tt.loads)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package cachetest содержит помощники для тестов кода, использующего кэши: ручные часы
+// Clock для детерминированного истечения сроков жизни и общие проверки поведения,
+// одинакового для всех политик вытеснения.
+package cachetest
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Clock - ручные часы, реализующие pkg.Clock. Время стоит на месте, пока тест не вызовет
+// Advance или Set, а таймеры AfterFunc срабатывают синхронно внутри этих вызовов в порядке
+// сроков, поэтому после возврата из Advance все истекшие элементы уже удалены из кэша.
+// Методы можно вызывать из разных горутин.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    int
+	timers timerHeap
+}
+
+// Start - время ручных часов, созданных NewClock с нулевым start.
+var Start = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewClock создает часы, показывающие start, или Start при нулевом start.
+func NewClock(start time.Time) *Clock {
+	if start.IsZero() {
+		start = Start
+	}
+	return &Clock{now: start}
+}
+
+// Now возвращает текущее время часов.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc планирует вызов f, когда часы дойдут до Now()+d. Вызов с d <= 0
+// происходит при ближайшем Advance, в том числе Advance(0).
+func (c *Clock) AfterFunc(d time.Duration, f func()) pkg.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	t := &timer{clock: c, when: c.now.Add(d), seq: c.seq, f: f}
+	heap.Push(&c.timers, t)
+	return t
+}
+
+// Advance продвигает часы на d и вызывает таймеры, срок которых наступил. Перед каждым
+// вызовом часы показывают срок таймера. Таймеры, запланированные из вызовов, тоже
+// срабатывают, если их срок не позже нового времени.
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set переводит часы на время t и вызывает таймеры, срок которых наступил.
+// Время не идет назад: более раннее t только вызывает просроченные таймеры.
+func (c *Clock) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].when.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+		next := heap.Pop(&c.timers).(*timer)
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		c.mu.Unlock()
+
+		// Вызов без блокировки: f обращается к кэшу, а тот - к часам
+		next.f()
+	}
+}
+
+// Pending возвращает число запланированных таймеров.
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+type timer struct {
+	clock *Clock
+	when  time.Time
+	seq   int
+	index int // позиция в куче, -1 - таймер сработал или остановлен
+	f     func()
+}
+
+func (t *timer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t.index < 0 {
+		return false
+	}
+	heap.Remove(&c.timers, t.index)
+	return true
+}
+
+// timerHeap упорядочивает таймеры по сроку, среди равных - по порядку планирования.
+type timerHeap []*timer
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].when.Equal(h[j].when) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].when.Before(h[j].when)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	t := x.(*timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
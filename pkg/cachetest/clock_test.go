@@ -0,0 +1,49 @@
+package cachetest
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	clock := NewClock(time.Time{})
+	if !clock.Now().Equal(Start) {
+		t.Fatalf("Now() = %v, want %v", clock.Now(), Start)
+	}
+
+	var fired []string
+	at := func(name string) func() {
+		return func() { fired = append(fired, name+"@"+clock.Now().Sub(Start).String()) }
+	}
+	clock.AfterFunc(2*time.Second, at("b"))
+	clock.AfterFunc(time.Second, at("a"))
+	stopped := clock.AfterFunc(time.Second, at("stopped"))
+	clock.AfterFunc(2*time.Second, func() {
+		at("c")()
+		clock.AfterFunc(time.Second, at("d"))
+	})
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop must succeed only once")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("fired early: %v", fired)
+	}
+	clock.Advance(3 * time.Second)
+	if want := []string{"a@1s", "b@2s", "c@2s", "d@3s"}; !slices.Equal(fired, want) {
+		t.Errorf("fired %v, want %v", fired, want)
+	}
+	if got := clock.Now().Sub(Start); got != 3500*time.Millisecond {
+		t.Errorf("Now() = Start+%v after Advance", got)
+	}
+	if clock.Pending() != 0 {
+		t.Errorf("Pending() = %d", clock.Pending())
+	}
+
+	clock.Set(Start)
+	if got := clock.Now().Sub(Start); got != 3500*time.Millisecond {
+		t.Errorf("Set moved the clock back to Start+%v", got)
+	}
+}
@@ -0,0 +1,28 @@
+package pkg
+
+import "time"
+
+// Clock - источник времени кэшей: сроки жизни отсчитываются от Now, а истечение
+// планируется через AfterFunc. Подмена часов, например cachetest.Clock, делает
+// истечение сроков в тестах детерминированным.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc вызывает f в отдельной горутине или синхронно при продвижении
+	// часов не раньше чем через d.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer - запланированный вызов Clock.AfterFunc.
+type Timer interface {
+	// Stop отменяет вызов. Возвращает false, если вызов уже произошел или отменен.
+	Stop() bool
+}
+
+// SystemClock - системные часы пакета time. Используются кэшами по умолчанию.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
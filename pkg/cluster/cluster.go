@@ -0,0 +1,301 @@
+// Package cluster распределяет ключи между несколькими узлами кэша на стороне клиента:
+// кольцо согласованного хеширования с виртуальными узлами или хеширование с наибольшим весом,
+// проверка доступности узлов и перенаправление ключей недоступного узла на следующий.
+package cluster
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Node - узел кластера, например rest.Client или локальный lru.Cache.
+type Node[ValueT any] interface {
+	Get(key string) (ValueT, bool)
+	Put(key string, value ValueT, ttl time.Duration)
+}
+
+// Deleter реализуют узлы, поддерживающие удаление.
+type Deleter interface {
+	Delete(key string) bool
+}
+
+// Pinger реализуют узлы, доступность которых можно проверить. Узлы без Ping считаются доступными.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Hashing - способ распределения ключей.
+type Hashing int
+
+const (
+	// Consistent - кольцо согласованного хеширования с виртуальными узлами.
+	Consistent Hashing = iota
+	// Rendezvous - хеширование с наибольшим весом (HRW).
+	Rendezvous
+)
+
+// Options - настройки кластера. Нулевое значение - согласованное хеширование
+// со 160 виртуальными узлами и проверкой доступности раз в секунду.
+type Options struct {
+	Hashing Hashing
+	// VirtualNodes - число точек узла на кольце, по умолчанию 160.
+	VirtualNodes int
+	// HealthInterval - период проверки доступности, по умолчанию 1 секунда.
+	// Отрицательное значение отключает фоновую проверку, ее можно вызвать через CheckHealth.
+	HealthInterval time.Duration
+	// HealthTimeout ограничивает одну проверку, по умолчанию 1 секунда.
+	HealthTimeout time.Duration
+	// FailThreshold - число неудачных проверок подряд, после которого узел считается недоступным, по умолчанию 2.
+	FailThreshold int
+}
+
+// NodeStatus - состояние узла.
+type NodeStatus struct {
+	Name     string
+	Healthy  bool
+	Failures int // неудачные проверки подряд
+}
+
+// Stats - счетчики кластера.
+type Stats struct {
+	// Failovers - обращения, перенаправленные с недоступного владельца ключа на запасной узел.
+	Failovers int64
+}
+
+type member[ValueT any] struct {
+	name    string
+	node    Node[ValueT]
+	healthy atomic.Bool
+	// failures изменяется только проверкой доступности под checkMu
+	failures int
+}
+
+// Cluster - кэш поверх нескольких узлов. Реализует интерфейс Cacher[string, ValueT].
+//
+// Пока владелец ключа недоступен, ключ обслуживает следующий узел, а после восстановления
+// владельца ключ возвращается к нему. Записи, сделанные на запасной узел, не переносятся
+// и остаются там до вытеснения, поэтому после восстановления узел может вернуть устаревшее значение.
+type Cluster[ValueT any] struct {
+	opts Options
+
+	mu     sync.RWMutex
+	picker picker
+	nodes  map[string]*member[ValueT]
+
+	checkMu   sync.Mutex
+	failovers atomic.Int64
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New создает пустой кластер и запускает фоновую проверку доступности, которую останавливает Close.
+func New[ValueT any](opts Options) *Cluster[ValueT] {
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = 160
+	}
+	if opts.HealthInterval == 0 {
+		opts.HealthInterval = time.Second
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = time.Second
+	}
+	if opts.FailThreshold <= 0 {
+		opts.FailThreshold = 2
+	}
+
+	c := &Cluster[ValueT]{
+		opts:  opts,
+		nodes: make(map[string]*member[ValueT]),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if opts.Hashing == Rendezvous {
+		c.picker = &rendezvous{}
+	} else {
+		c.picker = NewRing(opts.VirtualNodes)
+	}
+
+	if opts.HealthInterval > 0 {
+		go c.healthLoop()
+	} else {
+		close(c.done)
+	}
+	return c
+}
+
+// AddNode добавляет узел с именем name или заменяет узел с тем же именем.
+// Имя определяет положение узла на кольце, поэтому должно быть постоянным, например адресом.
+func (c *Cluster[ValueT]) AddNode(name string, node Node[ValueT]) {
+	m := &member[ValueT]{name: name, node: node}
+	m.healthy.Store(true)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.nodes[name]; !ok {
+		c.picker.Add(name)
+	}
+	c.nodes[name] = m
+}
+
+// RemoveNode удаляет узел. Его ключи распределяются между оставшимися узлами.
+func (c *Cluster[ValueT]) RemoveNode(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.nodes[name]; ok {
+		c.picker.Remove(name)
+		delete(c.nodes, name)
+	}
+}
+
+// Owner возвращает имя узла, который сейчас обслуживает ключ, или "" для пустого кластера.
+func (c *Cluster[ValueT]) Owner(key string) string {
+	if m := c.route(key); m != nil {
+		return m.name
+	}
+	return ""
+}
+
+// Get возвращает значение с узла, обслуживающего ключ.
+func (c *Cluster[ValueT]) Get(key string) (ValueT, bool) {
+	m := c.route(key)
+	if m == nil {
+		var zeroValue ValueT
+		return zeroValue, false
+	}
+	return m.node.Get(key)
+}
+
+// Put записывает значение на узел, обслуживающий ключ.
+func (c *Cluster[ValueT]) Put(key string, value ValueT, ttl time.Duration) {
+	if m := c.route(key); m != nil {
+		m.node.Put(key, value, ttl)
+	}
+}
+
+// Delete удаляет ключ с узла, обслуживающего ключ, если узел поддерживает удаление.
+func (c *Cluster[ValueT]) Delete(key string) bool {
+	m := c.route(key)
+	if m == nil {
+		return false
+	}
+	if deleter, ok := m.node.(Deleter); ok {
+		return deleter.Delete(key)
+	}
+	return false
+}
+
+// route возвращает первый доступный узел в порядке предпочтения для ключа.
+// Если недоступны все узлы, возвращает владельца ключа.
+func (c *Cluster[ValueT]) route(key string) *member[ValueT] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := c.picker.LookupN(key, len(c.nodes))
+	for i, name := range names {
+		if m := c.nodes[name]; m.healthy.Load() {
+			if i > 0 {
+				c.failovers.Add(1)
+			}
+			return m
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return c.nodes[names[0]]
+}
+
+// Nodes возвращает состояние узлов.
+func (c *Cluster[ValueT]) Nodes() []NodeStatus {
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make([]NodeStatus, 0, len(c.nodes))
+	for _, m := range c.nodes {
+		statuses = append(statuses, NodeStatus{Name: m.name, Healthy: m.healthy.Load(), Failures: m.failures})
+	}
+	return statuses
+}
+
+// Stats возвращает счетчики кластера.
+func (c *Cluster[ValueT]) Stats() Stats {
+	return Stats{Failovers: c.failovers.Load()}
+}
+
+// CheckHealth проверяет все узлы, поддерживающие Ping, и обновляет их доступность.
+func (c *Cluster[ValueT]) CheckHealth(ctx context.Context) {
+	c.mu.RLock()
+	members := make([]*member[ValueT], 0, len(c.nodes))
+	for _, m := range c.nodes {
+		members = append(members, m)
+	}
+	c.mu.RUnlock()
+
+	errs := make([]error, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		pinger, ok := m.node.(Pinger)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, c.opts.HealthTimeout)
+			defer cancel()
+			errs[i] = pinger.Ping(ctx)
+		}()
+	}
+	wg.Wait()
+
+	c.checkMu.Lock()
+	defer c.checkMu.Unlock()
+
+	for i, m := range members {
+		if errs[i] == nil {
+			m.failures = 0
+			m.healthy.Store(true)
+			continue
+		}
+		m.failures++
+		if m.failures >= c.opts.FailThreshold {
+			m.healthy.Store(false)
+		}
+	}
+}
+
+// Close останавливает фоновую проверку доступности. Узлы не закрываются.
+func (c *Cluster[ValueT]) Close() {
+	c.closeOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+func (c *Cluster[ValueT]) healthLoop() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opts.HealthInterval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.CheckHealth(ctx)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package cluster
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+	"github.com/ivansevryukov1995/cache-sev/pkg/rest"
+)
+
+// startNodes запускает n серверов REST на локальных портах
+func startNodes(t *testing.T, n int) ([]*httptest.Server, []*lru.Cache[string, []byte]) {
+	t.Helper()
+	servers := make([]*httptest.Server, n)
+	caches := make([]*lru.Cache[string, []byte], n)
+	for i := range servers {
+		caches[i] = lru.NewCache[string, []byte](1000)
+		servers[i] = httptest.NewServer(rest.NewHandler(caches[i], rest.Options{}))
+		t.Cleanup(servers[i].Close)
+	}
+	return servers, caches
+}
+
+func TestClusterDistribution(t *testing.T) {
+	for _, hashing := range []Hashing{Consistent, Rendezvous} {
+		servers, caches := startNodes(t, 3)
+		c := New[[]byte](Options{Hashing: hashing, HealthInterval: -1})
+		defer c.Close()
+		for _, srv := range servers {
+			c.AddNode(srv.URL, rest.NewClient(srv.URL, rest.ClientOptions{}))
+		}
+
+		for i := 0; i < 300; i++ {
+			key := "key" + strconv.Itoa(i)
+			c.Put(key, []byte(key), 0)
+		}
+		total := 0
+		for i, cache := range caches {
+			if cache.Len() < 50 {
+				t.Errorf("hashing %d: node %d holds only %d keys", hashing, i, cache.Len())
+			}
+			total += cache.Len()
+		}
+		if total != 300 {
+			t.Errorf("hashing %d: %d keys stored, want 300", hashing, total)
+		}
+
+		for i := 0; i < 300; i++ {
+			key := "key" + strconv.Itoa(i)
+			if v, ok := c.Get(key); !ok || string(v) != key {
+				t.Fatalf("hashing %d: Get(%s) = %q, %v", hashing, key, v, ok)
+			}
+		}
+		if !c.Delete("key0") || c.Delete("key0") {
+			t.Errorf("hashing %d: Delete", hashing)
+		}
+	}
+}
+
+func TestClusterFailover(t *testing.T) {
+	servers, _ := startNodes(t, 3)
+	c := New[[]byte](Options{HealthInterval: -1, FailThreshold: 1, HealthTimeout: time.Second})
+	defer c.Close()
+	for _, srv := range servers {
+		c.AddNode(srv.URL, rest.NewClient(srv.URL, rest.ClientOptions{Timeout: time.Second}))
+	}
+
+	// Ключ, принадлежащий первому серверу
+	var key string
+	for i := 0; ; i++ {
+		key = "key" + strconv.Itoa(i)
+		if c.Owner(key) == servers[0].URL {
+			break
+		}
+	}
+
+	servers[0].Close()
+	c.CheckHealth(context.Background())
+	for _, status := range c.Nodes() {
+		if status.Healthy != (status.Name != servers[0].URL) {
+			t.Errorf("status %+v", status)
+		}
+	}
+
+	owner := c.Owner(key)
+	if owner == servers[0].URL || owner == "" {
+		t.Fatalf("key is still routed to %q", owner)
+	}
+	c.Put(key, []byte("v"), 0)
+	if v, ok := c.Get(key); !ok || string(v) != "v" {
+		t.Errorf("Get after failover: %q, %v", v, ok)
+	}
+	if c.Stats().Failovers == 0 {
+		t.Error("failovers are not counted")
+	}
+
+	// Удаление узла переносит его ключи так же, как недоступность
+	c.RemoveNode(servers[0].URL)
+	if c.Owner(key) != owner {
+		t.Errorf("owner after remove: %s, want %s", c.Owner(key), owner)
+	}
+}
+
+func TestClusterHealthLoop(t *testing.T) {
+	servers, _ := startNodes(t, 2)
+	c := New[[]byte](Options{HealthInterval: 10 * time.Millisecond, FailThreshold: 2})
+	defer c.Close()
+	for _, srv := range servers {
+		c.AddNode(srv.URL, rest.NewClient(srv.URL, rest.ClientOptions{}))
+	}
+
+	servers[1].Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		healthy := 0
+		for _, status := range c.Nodes() {
+			if status.Healthy {
+				healthy++
+			}
+		}
+		if healthy == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("unavailable node is not detected")
+}
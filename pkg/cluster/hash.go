@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// picker выбирает узлы для ключа в порядке предпочтения.
+type picker interface {
+	Add(node string)
+	Remove(node string)
+	// LookupN возвращает до n различных узлов: первый - владелец ключа, остальные - запасные
+	LookupN(key string, n int) []string
+}
+
+// hashString - FNV-1a с перемешиванием SplitMix64: у похожих строк FNV дает близкие значения.
+func hashString(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return mix(h)
+}
+
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// point - виртуальный узел на кольце.
+type point struct {
+	hash uint64
+	node string
+}
+
+// Ring - кольцо согласованного хеширования. Каждый узел представлен vnodes точками,
+// ключ принадлежит первой точке по часовой стрелке. При добавлении или удалении узла
+// переезжает примерно 1/N ключей. Ring не защищен от одновременного изменения и чтения.
+type Ring struct {
+	vnodes int
+	points []point
+}
+
+// NewRing создает пустое кольцо с vnodes виртуальными узлами на каждый узел.
+func NewRing(vnodes int) *Ring {
+	return &Ring{vnodes: vnodes}
+}
+
+// Add добавляет узел на кольцо.
+func (r *Ring) Add(node string) {
+	for i := 0; i < r.vnodes; i++ {
+		r.points = append(r.points, point{hash: hashString(node + "#" + strconv.Itoa(i)), node: node})
+	}
+	// Совпадение хешей разрешается одинаково независимо от порядка добавления
+	slices.SortFunc(r.points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), strings.Compare(a.node, b.node))
+	})
+}
+
+// Remove удаляет узел с кольца.
+func (r *Ring) Remove(node string) {
+	r.points = slices.DeleteFunc(r.points, func(p point) bool { return p.node == node })
+}
+
+// Lookup возвращает владельца ключа или "" для пустого кольца.
+func (r *Ring) Lookup(key string) string {
+	if nodes := r.LookupN(key, 1); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return ""
+}
+
+// LookupN возвращает до n различных узлов в порядке обхода кольца от ключа.
+func (r *Ring) LookupN(key string, n int) []string {
+	if len(r.points) == 0 || n <= 0 {
+		return nil
+	}
+	h := hashString(key)
+	start, _ := slices.BinarySearchFunc(r.points, h, func(p point, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+
+	nodes := make([]string, 0, n)
+	for i := 0; i < len(r.points) && len(nodes) < n; i++ {
+		node := r.points[(start+i)%len(r.points)].node
+		if !slices.Contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// rendezvous - хеширование с наибольшим весом (HRW): ключ принадлежит узлу с наибольшим
+// хешем пары узел-ключ. Не требует виртуальных узлов, но поиск линейный по числу узлов.
+type rendezvous struct {
+	nodes []string
+	seeds []uint64
+}
+
+func (r *rendezvous) Add(node string) {
+	r.nodes = append(r.nodes, node)
+	r.seeds = append(r.seeds, hashString(node))
+}
+
+func (r *rendezvous) Remove(node string) {
+	if i := slices.Index(r.nodes, node); i >= 0 {
+		r.nodes = slices.Delete(r.nodes, i, i+1)
+		r.seeds = slices.Delete(r.seeds, i, i+1)
+	}
+}
+
+func (r *rendezvous) LookupN(key string, n int) []string {
+	type scored struct {
+		score uint64
+		node  string
+	}
+	h := hashString(key)
+	scores := make([]scored, len(r.nodes))
+	for i, node := range r.nodes {
+		scores[i] = scored{score: mix(h ^ r.seeds[i]), node: node}
+	}
+	slices.SortFunc(scores, func(a, b scored) int {
+		return cmp.Or(cmp.Compare(b.score, a.score), strings.Compare(a.node, b.node))
+	})
+
+	nodes := make([]string, 0, min(n, len(scores)))
+	for _, s := range scores[:min(n, len(scores))] {
+		nodes = append(nodes, s.node)
+	}
+	return nodes
+}
@@ -0,0 +1,87 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+)
+
+func pickers() map[string]func() picker {
+	return map[string]func() picker{
+		"ring":       func() picker { return NewRing(160) },
+		"rendezvous": func() picker { return &rendezvous{} },
+	}
+}
+
+func TestPickerBalance(t *testing.T) {
+	for name, newPicker := range pickers() {
+		p := newPicker()
+		for i := 0; i < 4; i++ {
+			p.Add("node" + strconv.Itoa(i))
+		}
+		counts := map[string]int{}
+		const keys = 40000
+		for i := 0; i < keys; i++ {
+			counts[p.LookupN("key"+strconv.Itoa(i), 1)[0]]++
+		}
+		for node, n := range counts {
+			// Ожидается 10000 ключей на узел
+			if n < 7500 || n > 12500 {
+				t.Errorf("%s: %s owns %d of %d keys", name, node, n, keys)
+			}
+		}
+	}
+}
+
+func TestPickerMinimalMovement(t *testing.T) {
+	for name, newPicker := range pickers() {
+		p := newPicker()
+		for i := 0; i < 4; i++ {
+			p.Add("node" + strconv.Itoa(i))
+		}
+		const keys = 20000
+		before := make([]string, keys)
+		for i := range before {
+			before[i] = p.LookupN("key"+strconv.Itoa(i), 1)[0]
+		}
+
+		// Новый узел забирает около 1/5 ключей, остальные ключи не переезжают
+		p.Add("node4")
+		moved := 0
+		for i, owner := range before {
+			now := p.LookupN("key"+strconv.Itoa(i), 1)[0]
+			if now != owner {
+				moved++
+				if now != "node4" {
+					t.Fatalf("%s: key moved from %s to %s", name, owner, now)
+				}
+			}
+		}
+		if moved < keys/10 || moved > keys*3/10 {
+			t.Errorf("%s: %d of %d keys moved after add", name, moved, keys)
+		}
+
+		// После удаления узла ключи возвращаются к прежним владельцам
+		p.Remove("node4")
+		for i, owner := range before {
+			if now := p.LookupN("key"+strconv.Itoa(i), 1)[0]; now != owner {
+				t.Fatalf("%s: key %d owned by %s, was %s", name, i, now, owner)
+			}
+		}
+	}
+}
+
+func TestPickerLookupN(t *testing.T) {
+	for name, newPicker := range pickers() {
+		p := newPicker()
+		if nodes := p.LookupN("k", 3); len(nodes) != 0 {
+			t.Errorf("%s: empty picker returned %v", name, nodes)
+		}
+		p.Add("a")
+		p.Add("b")
+		p.Add("c")
+		nodes := p.LookupN("k", 5)
+		if len(nodes) != 3 || nodes[0] == nodes[1] || nodes[1] == nodes[2] || nodes[0] == nodes[2] {
+			t.Errorf("%s: lookup returned %v", name, nodes)
+		}
+	}
+}
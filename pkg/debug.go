@@ -0,0 +1,7 @@
+//go:build cachedebug
+
+package pkg
+
+// Debug включает проверку инвариантов кэшей lru и lfu после каждого изменения:
+// при нарушении кэш паникует с ошибкой Validate. Включается тегом сборки cachedebug.
+const Debug = true
@@ -0,0 +1,144 @@
+package disk
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Memory - кэш первого уровня в памяти. Его реализуют lru.Cache и lfu.Cache.
+type Memory[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	OnEvict(fn func(e pkg.Eviction[KeyT, ValueT]))
+}
+
+// Stats - счетчики двухуровневого кэша.
+type Stats struct {
+	MemoryHits  int64
+	DiskHits    int64
+	Misses      int64
+	Promotions  int64 // элементы, возвращенные с диска в память
+	Spills      int64 // элементы, вытесненные из памяти на диск
+	SpillErrors int64
+	Disk        StoreStats
+}
+
+// Cache - кэш в памяти с дисковым вторым уровнем. Элемент хранится только на одном уровне:
+// вытесненный из памяти элемент записывается на диск, найденный на диске - возвращается в память.
+type Cache[KeyT comparable, ValueT any] struct {
+	memory Memory[KeyT, ValueT]
+	store  *Store[KeyT, ValueT]
+
+	// mu упорядочивает перенос элементов с диска с записью и удалением
+	mu sync.Mutex
+
+	memoryHits  atomic.Int64
+	diskHits    atomic.Int64
+	misses      atomic.Int64
+	promotions  atomic.Int64
+	spills      atomic.Int64
+	spillErrors atomic.Int64
+}
+
+// NewCache объединяет memory и store в двухуровневый кэш.
+func NewCache[KeyT comparable, ValueT any](memory Memory[KeyT, ValueT], store *Store[KeyT, ValueT]) *Cache[KeyT, ValueT] {
+	c := &Cache[KeyT, ValueT]{
+		memory: memory,
+		store:  store,
+	}
+	memory.OnEvict(c.spill)
+	return c
+}
+
+// Get ищет значение в памяти, затем на диске. Найденный на диске элемент переносится в память.
+func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	if value, ok := c.memory.Get(key); ok {
+		c.memoryHits.Add(1)
+		return value, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Элемент мог быть перенесен в память параллельным Get
+	if value, ok := c.memory.Get(key); ok {
+		c.memoryHits.Add(1)
+		return value, true
+	}
+
+	value, expiresAt, ok := c.store.Get(key)
+	var ttl time.Duration
+	if ok && !expiresAt.IsZero() {
+		ttl = expiresAt.Sub(c.store.opts.Clock.Now())
+		ok = ttl > 0
+	}
+	if !ok {
+		c.misses.Add(1)
+		var zeroValue ValueT
+		return zeroValue, false
+	}
+
+	c.store.Delete(key)
+	c.memory.Put(key, value, ttl)
+	c.diskHits.Add(1)
+	c.promotions.Add(1)
+	return value, true
+}
+
+// Put записывает значение в память и удаляет устаревшую копию с диска.
+func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.memory.Put(key, value, ttl)
+	c.store.Delete(key)
+}
+
+// Delete удаляет ключ с обоих уровней.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := c.memory.Delete(key)
+	if ok, _ := c.store.Delete(key); ok {
+		deleted = true
+	}
+	return deleted
+}
+
+// Stats возвращает счетчики обоих уровней.
+func (c *Cache[KeyT, ValueT]) Stats() Stats {
+	return Stats{
+		MemoryHits:  c.memoryHits.Load(),
+		DiskHits:    c.diskHits.Load(),
+		Misses:      c.misses.Load(),
+		Promotions:  c.promotions.Load(),
+		Spills:      c.spills.Load(),
+		SpillErrors: c.spillErrors.Load(),
+		Disk:        c.store.Stats(),
+	}
+}
+
+// Close закрывает дисковое хранилище.
+func (c *Cache[KeyT, ValueT]) Close() error {
+	return c.store.Close()
+}
+
+// spill записывает на диск элемент, вытесненный из памяти при переполнении.
+func (c *Cache[KeyT, ValueT]) spill(e pkg.Eviction[KeyT, ValueT]) {
+	if e.Reason != pkg.EvictCapacity {
+		return
+	}
+	if !e.ExpiresAt.IsZero() && !c.store.opts.Clock.Now().Before(e.ExpiresAt) {
+		return
+	}
+	if err := c.store.Put(e.Key, e.Value, e.ExpiresAt); err != nil {
+		c.spillErrors.Add(1)
+		return
+	}
+	c.spills.Add(1)
+}
@@ -0,0 +1,50 @@
+package disk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// Вытесненный из памяти элемент переносится на диск и возвращается в память при обращении
+func TestCacheSpillAndPromote(t *testing.T) {
+	store, err := OpenStore[string, string](t.TempDir(), StoreOptions[string, string]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := lru.NewCache[string, string](2)
+	cache := NewCache[string, string](memory, store)
+	defer cache.Close()
+
+	cache.Put("key1", "value1", time.Hour)
+	cache.Put("key2", "value2", 0)
+	cache.Put("key3", "value3", 0) // Должен перенести key1 на диск
+
+	if memory.Contains("key1") {
+		t.Error("Expected key1 to be evicted from memory")
+	}
+	if store.Len() != 1 {
+		t.Errorf("Expected 1 entry on disk, got %d", store.Len())
+	}
+
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected value1, got %v (found: %v)", v, found)
+	}
+	if ttl, _ := memory.TTL("key1"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected promoted key1 to keep its TTL, got %v", ttl)
+	}
+	// key2 вытеснен на диск при возврате key1
+	if _, _, found := store.Get("key2"); !found {
+		t.Error("Expected key2 to be spilled to disk")
+	}
+
+	if _, found := cache.Get("key4"); found {
+		t.Error("Expected key4 to be missing")
+	}
+
+	st := cache.Stats()
+	if st.DiskHits != 1 || st.Promotions != 1 || st.Spills != 2 || st.Misses != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
@@ -0,0 +1,620 @@
+// Package disk реализует второй, дисковый уровень кэша.
+//
+// Store - лог-структурированное хранилище в духе Bitcask: записи только дописываются
+// в файлы данных, а таблица ключей в памяти указывает на последнюю запись каждого ключа.
+// Cache объединяет кэш в памяти (lru или lfu) и Store: вытесненные из памяти элементы
+// переносятся на диск и возвращаются в память при обращении.
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// Формат записи файла данных:
+//
+//	[0:4]   CRC-32 (Castagnoli) байт [4:] заголовка, ключа и значения
+//	[4:8]   длина ключа
+//	[8:12]  длина значения, tombstone для удаленного ключа
+//	[12:20] время истечения срока жизни в наносекундах Unix, 0 - без TTL
+//	[20:]   ключ, затем значение
+const (
+	headerSize      = 20
+	tombstone       = ^uint32(0)
+	dataSuffix      = ".data"
+	defaultFileSize = 16 << 20
+	maxFieldSize    = 1 << 30
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord означает, что запись обрезана или повреждена.
+var errTornRecord = errors.New("disk: torn record")
+
+// StoreOptions - настройки Store. Нулевое значение допустимо.
+type StoreOptions[KeyT comparable, ValueT any] struct {
+	// MaxSize - предельный суммарный размер файлов данных. При превышении удаляется
+	// самый старый файл вместе с живыми записями в нем. 0 - без ограничения.
+	MaxSize int64
+	// FileSize - размер файла данных, после которого начинается новый. По умолчанию 16 МиБ.
+	FileSize int64
+	// CompactRatio - доля мертвых байт в неактивных файлах, после которой они
+	// уплотняются в фоне. 0 отключает автоматическое уплотнение.
+	CompactRatio float64
+	// Keys и Values кодируют ключи и значения. По умолчанию snapshot.Gob.
+	Keys   snapshot.Codec[KeyT]
+	Values snapshot.Codec[ValueT]
+	// Clock - часы для сроков жизни записей. По умолчанию pkg.SystemClock.
+	Clock pkg.Clock
+}
+
+// StoreStats - счетчики дискового хранилища.
+type StoreStats struct {
+	Entries        int
+	Files          int
+	Bytes          int64 // суммарный размер файлов данных
+	DeadBytes      int64 // байты перезаписанных и удаленных записей
+	Hits           int64
+	Misses         int64
+	Evictions      int64 // живые записи, удаленные вместе со старым файлом из-за MaxSize
+	Expired        int64
+	Compactions    int64
+	ReclaimedBytes int64
+}
+
+type location struct {
+	fileID    int
+	offset    int64
+	size      int64
+	expiresAt int64
+}
+
+type dataFile struct {
+	f    *os.File
+	size int64
+	dead int64
+}
+
+// Store - дисковое хранилище ключей и значений.
+type Store[KeyT comparable, ValueT any] struct {
+	dir  string
+	opts StoreOptions[KeyT, ValueT]
+
+	mu         sync.Mutex
+	keydir     map[KeyT]location
+	files      map[int]*dataFile
+	ids        []int
+	active     int
+	buf        []byte
+	compacting bool
+	closed     bool
+	stats      StoreStats
+}
+
+// OpenStore открывает хранилище в каталоге dir и восстанавливает таблицу ключей по файлам данных.
+func OpenStore[KeyT comparable, ValueT any](dir string, opts StoreOptions[KeyT, ValueT]) (*Store[KeyT, ValueT], error) {
+	if opts.FileSize <= 0 {
+		opts.FileSize = defaultFileSize
+	}
+	if opts.Keys == nil {
+		opts.Keys = snapshot.Gob[KeyT]{}
+	}
+	if opts.Values == nil {
+		opts.Values = snapshot.Gob[ValueT]{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = pkg.SystemClock
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &Store[KeyT, ValueT]{
+		dir:    dir,
+		opts:   opts,
+		keydir: make(map[KeyT]location),
+		files:  make(map[int]*dataFile),
+	}
+	ids, err := listDataFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	now := opts.Clock.Now().UnixNano()
+	for i, id := range ids {
+		if err := s.loadFile(id, i == len(ids)-1, now); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	next := 1
+	if len(ids) > 0 {
+		next = ids[len(ids)-1] + 1
+	}
+	if err := s.openFileLocked(next); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get читает значение с диска. Второе значение - время истечения срока жизни.
+func (s *Store[KeyT, ValueT]) Get(key KeyT) (ValueT, time.Time, bool) {
+	var zeroValue ValueT
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc, ok := s.keydir[key]
+	if !ok {
+		s.stats.Misses++
+		return zeroValue, time.Time{}, false
+	}
+	if loc.expiresAt != 0 && s.opts.Clock.Now().UnixNano() >= loc.expiresAt {
+		s.dropLocked(key, loc)
+		s.stats.Expired++
+		s.stats.Misses++
+		return zeroValue, time.Time{}, false
+	}
+
+	data := make([]byte, loc.size)
+	if _, err := s.files[loc.fileID].f.ReadAt(data, loc.offset); err != nil {
+		s.stats.Misses++
+		return zeroValue, time.Time{}, false
+	}
+	_, value, _, err := decodeRecord(data)
+	if err != nil {
+		s.stats.Misses++
+		return zeroValue, time.Time{}, false
+	}
+	var result ValueT
+	if err := s.opts.Values.Unmarshal(value, &result); err != nil {
+		s.stats.Misses++
+		return zeroValue, time.Time{}, false
+	}
+
+	s.stats.Hits++
+	var expiresAt time.Time
+	if loc.expiresAt != 0 {
+		expiresAt = time.Unix(0, loc.expiresAt)
+	}
+	return result, expiresAt, true
+}
+
+// Put дописывает значение в активный файл данных. Нулевое expiresAt - без ограничения времени жизни.
+func (s *Store[KeyT, ValueT]) Put(key KeyT, value ValueT, expiresAt time.Time) error {
+	keyData, err := s.opts.Keys.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("disk: encode key: %w", err)
+	}
+	valueData, err := s.opts.Values.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("disk: encode value: %w", err)
+	}
+	var deadline int64
+	if !expiresAt.IsZero() {
+		deadline = expiresAt.UnixNano()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	loc, err := s.appendLocked(keyData, valueData, deadline, false)
+	if err != nil {
+		return err
+	}
+	if old, ok := s.keydir[key]; ok {
+		s.files[old.fileID].dead += old.size
+	}
+	s.keydir[key] = loc
+
+	return s.afterWriteLocked()
+}
+
+// Delete записывает удаление ключа, чтобы он не восстановился при следующем открытии.
+func (s *Store[KeyT, ValueT]) Delete(key KeyT) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, ok := s.keydir[key]
+	if !ok {
+		return false, nil
+	}
+	keyData, err := s.opts.Keys.Marshal(key)
+	if err != nil {
+		return false, fmt.Errorf("disk: encode key: %w", err)
+	}
+	loc, err := s.appendLocked(keyData, nil, 0, true)
+	if err != nil {
+		return false, err
+	}
+	delete(s.keydir, key)
+	s.files[old.fileID].dead += old.size
+	s.files[loc.fileID].dead += loc.size
+
+	return true, s.afterWriteLocked()
+}
+
+// Len возвращает количество ключей в хранилище.
+func (s *Store[KeyT, ValueT]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.keydir)
+}
+
+// Stats возвращает счетчики хранилища.
+func (s *Store[KeyT, ValueT]) Stats() StoreStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.stats
+	st.Entries = len(s.keydir)
+	st.Files = len(s.ids)
+	for _, file := range s.files {
+		st.Bytes += file.size
+		st.DeadBytes += file.dead
+	}
+	return st
+}
+
+// Compact переписывает живые записи всех неактивных файлов в один новый файл
+// и удаляет старые файлы вместе с мертвыми записями.
+func (s *Store[KeyT, ValueT]) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compactLocked()
+}
+
+// Close закрывает файлы данных.
+func (s *Store[KeyT, ValueT]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var err error
+	for _, file := range s.files {
+		if closeErr := file.f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// dropLocked удаляет ключ из таблицы без записи на диск. Запись с истекшим
+// сроком жизни не восстановится при следующем открытии.
+func (s *Store[KeyT, ValueT]) dropLocked(key KeyT, loc location) {
+	delete(s.keydir, key)
+	s.files[loc.fileID].dead += loc.size
+}
+
+func (s *Store[KeyT, ValueT]) appendLocked(key, value []byte, expiresAt int64, deleted bool) (location, error) {
+	s.buf = appendRecord(s.buf[:0], key, value, expiresAt, deleted)
+	file := s.files[s.active]
+	loc := location{fileID: s.active, offset: file.size, size: int64(len(s.buf)), expiresAt: expiresAt}
+	n, err := file.f.Write(s.buf)
+	file.size += int64(n)
+	if err != nil {
+		return location{}, err
+	}
+	return loc, nil
+}
+
+// afterWriteLocked начинает новый файл данных, соблюдает MaxSize и запускает уплотнение.
+func (s *Store[KeyT, ValueT]) afterWriteLocked() error {
+	if s.files[s.active].size >= s.opts.FileSize {
+		if err := s.openFileLocked(s.active + 1); err != nil {
+			return err
+		}
+	}
+
+	if s.opts.MaxSize > 0 {
+		for len(s.ids) > 1 && s.totalSizeLocked() > s.opts.MaxSize {
+			if err := s.dropOldestLocked(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.opts.CompactRatio > 0 && !s.compacting && s.needsCompactionLocked() {
+		s.compacting = true
+		go func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.compacting = false
+			if s.closed {
+				return
+			}
+			if err := s.compactLocked(); err != nil {
+				log.Printf("disk: уплотнение не выполнено: %v\n", err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (s *Store[KeyT, ValueT]) totalSizeLocked() int64 {
+	var size int64
+	for _, file := range s.files {
+		size += file.size
+	}
+	return size
+}
+
+func (s *Store[KeyT, ValueT]) needsCompactionLocked() bool {
+	var size, dead int64
+	for _, id := range s.ids {
+		if id == s.active {
+			continue
+		}
+		size += s.files[id].size
+		dead += s.files[id].dead
+	}
+	return size > 0 && float64(dead) >= float64(size)*s.opts.CompactRatio
+}
+
+// dropOldestLocked удаляет самый старый файл данных вместе с живыми записями в нем.
+func (s *Store[KeyT, ValueT]) dropOldestLocked() error {
+	oldest := s.ids[0]
+	for key, loc := range s.keydir {
+		if loc.fileID == oldest {
+			delete(s.keydir, key)
+			s.stats.Evictions++
+		}
+	}
+	return s.removeFileLocked(oldest)
+}
+
+func (s *Store[KeyT, ValueT]) compactLocked() error {
+	var old []int
+	for _, id := range s.ids {
+		if id != s.active {
+			old = append(old, id)
+		}
+	}
+	if len(old) == 0 {
+		return nil
+	}
+
+	// Уплотненный файл должен оказаться перед активным, чтобы при открытии
+	// записи активного файла оставались более новыми
+	merged := s.active + 1
+	if err := s.openFileLocked(s.active + 2); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, dataName(merged)), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	out := &dataFile{f: f}
+	s.files[merged] = out
+	s.ids = append(s.ids, merged)
+	sort.Ints(s.ids)
+
+	var reclaimed int64
+	for _, id := range old {
+		reclaimed += s.files[id].dead
+	}
+	now := s.opts.Clock.Now().UnixNano()
+	for key, loc := range s.keydir {
+		if !containsID(old, loc.fileID) {
+			continue
+		}
+		if loc.expiresAt != 0 && now >= loc.expiresAt {
+			delete(s.keydir, key)
+			s.stats.Expired++
+			reclaimed += loc.size
+			continue
+		}
+		data := make([]byte, loc.size)
+		if _, err := s.files[loc.fileID].f.ReadAt(data, loc.offset); err != nil {
+			return err
+		}
+		if _, err := out.f.Write(data); err != nil {
+			return err
+		}
+		s.keydir[key] = location{fileID: merged, offset: out.size, size: loc.size, expiresAt: loc.expiresAt}
+		out.size += loc.size
+	}
+	if err := out.f.Sync(); err != nil {
+		return err
+	}
+
+	for _, id := range old {
+		if err := s.removeFileLocked(id); err != nil {
+			return err
+		}
+	}
+	s.stats.Compactions++
+	s.stats.ReclaimedBytes += reclaimed
+	return nil
+}
+
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store[KeyT, ValueT]) removeFileLocked(id int) error {
+	file := s.files[id]
+	delete(s.files, id)
+	for i, v := range s.ids {
+		if v == id {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			break
+		}
+	}
+	file.f.Close()
+	return os.Remove(filepath.Join(s.dir, dataName(id)))
+}
+
+// openFileLocked делает файл id активным.
+func (s *Store[KeyT, ValueT]) openFileLocked(id int) error {
+	f, err := os.OpenFile(filepath.Join(s.dir, dataName(id)), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.files[id] = &dataFile{f: f}
+	s.ids = append(s.ids, id)
+	sort.Ints(s.ids)
+	s.active = id
+	return nil
+}
+
+// loadFile восстанавливает таблицу ключей по файлу данных. Обрезанный хвост
+// последнего файла, оставшийся после падения, отбрасывается.
+func (s *Store[KeyT, ValueT]) loadFile(id int, last bool, now int64) error {
+	name := filepath.Join(s.dir, dataName(id))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	file := &dataFile{f: f}
+	s.files[id] = file
+	s.ids = append(s.ids, id)
+
+	r := bufio.NewReader(f)
+	for {
+		data, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !last {
+				return fmt.Errorf("disk: corrupted file %s at offset %d", dataName(id), file.size)
+			}
+			return f.Truncate(file.size)
+		}
+		keyData, _, expiresAt, err := decodeRecord(data)
+		deleted := errors.Is(err, errDeleted)
+		if err != nil && !deleted {
+			return err
+		}
+
+		var key KeyT
+		if err := s.opts.Keys.Unmarshal(keyData, &key); err != nil {
+			return fmt.Errorf("disk: decode key: %w", err)
+		}
+		loc := location{fileID: id, offset: file.size, size: int64(len(data)), expiresAt: expiresAt}
+		file.size += loc.size
+
+		if old, ok := s.keydir[key]; ok {
+			s.files[old.fileID].dead += old.size
+			delete(s.keydir, key)
+		}
+		if deleted || expiresAt != 0 && now >= expiresAt {
+			file.dead += loc.size
+			continue
+		}
+		s.keydir[key] = loc
+	}
+}
+
+// errDeleted возвращается decodeRecord для записи об удалении ключа.
+var errDeleted = errors.New("disk: tombstone")
+
+func appendRecord(buf, key, value []byte, expiresAt int64, deleted bool) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, headerSize)...)
+	binary.BigEndian.PutUint32(buf[start+4:], uint32(len(key)))
+	if deleted {
+		binary.BigEndian.PutUint32(buf[start+8:], tombstone)
+	} else {
+		binary.BigEndian.PutUint32(buf[start+8:], uint32(len(value)))
+	}
+	binary.BigEndian.PutUint64(buf[start+12:], uint64(expiresAt))
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	binary.BigEndian.PutUint32(buf[start:], crc32.Checksum(buf[start+4:], castagnoli))
+	return buf
+}
+
+// readRecord читает очередную запись целиком.
+func readRecord(r *bufio.Reader) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errTornRecord
+	}
+	keyLen := binary.BigEndian.Uint32(header[4:])
+	valueLen := binary.BigEndian.Uint32(header[8:])
+	if valueLen == tombstone {
+		valueLen = 0
+	}
+	if keyLen > maxFieldSize || valueLen > maxFieldSize {
+		return nil, errTornRecord
+	}
+	data := make([]byte, headerSize+int(keyLen)+int(valueLen))
+	copy(data, header)
+	if _, err := io.ReadFull(r, data[headerSize:]); err != nil {
+		return nil, errTornRecord
+	}
+	if crc32.Checksum(data[4:], castagnoli) != binary.BigEndian.Uint32(data) {
+		return nil, errTornRecord
+	}
+	return data, nil
+}
+
+// decodeRecord возвращает ключ, значение и время истечения записи.
+// Для записи об удалении возвращается errDeleted.
+func decodeRecord(data []byte) (key, value []byte, expiresAt int64, err error) {
+	if len(data) < headerSize {
+		return nil, nil, 0, errTornRecord
+	}
+	keyLen := int(binary.BigEndian.Uint32(data[4:]))
+	valueLen := binary.BigEndian.Uint32(data[8:])
+	expiresAt = int64(binary.BigEndian.Uint64(data[12:]))
+	if len(data) < headerSize+keyLen {
+		return nil, nil, 0, errTornRecord
+	}
+	key = data[headerSize : headerSize+keyLen]
+	if valueLen == tombstone {
+		return key, nil, expiresAt, errDeleted
+	}
+	return key, data[headerSize+keyLen:], expiresAt, nil
+}
+
+func dataName(id int) string {
+	return fmt.Sprintf("%06d%s", id, dataSuffix)
+}
+
+func listDataFiles(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, dataSuffix) {
+			continue
+		}
+		if id, err := strconv.Atoi(strings.TrimSuffix(name, dataSuffix)); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
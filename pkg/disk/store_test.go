@@ -0,0 +1,128 @@
+package disk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openStore(t *testing.T, dir string, opts StoreOptions[string, string]) *Store[string, string] {
+	t.Helper()
+	store, err := OpenStore[string, string](dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openStore(t, dir, StoreOptions[string, string]{})
+	store.Put("key1", "value1", time.Time{})
+	store.Put("key2", "value2", time.Now().Add(time.Hour))
+	store.Put("key1", "value_updated", time.Time{})
+	store.Put("key3", "value3", time.Time{})
+	store.Delete("key3")
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openStore(t, dir, StoreOptions[string, string]{})
+	defer store.Close()
+
+	if v, _, found := store.Get("key1"); !found || v != "value_updated" {
+		t.Errorf("Expected value_updated, got %v (found: %v)", v, found)
+	}
+	if _, expiresAt, found := store.Get("key2"); !found || expiresAt.IsZero() {
+		t.Errorf("Expected key2 with TTL, got %v (found: %v)", expiresAt, found)
+	}
+	if _, _, found := store.Get("key3"); found {
+		t.Error("Expected key3 to stay deleted")
+	}
+	if st := store.Stats(); st.DeadBytes == 0 {
+		t.Error("Expected dead bytes after overwrite and delete")
+	}
+}
+
+func TestStoreTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openStore(t, dir, StoreOptions[string, string]{})
+	store.Put("key1", "value1", time.Time{})
+	store.Put("key2", "value2", time.Time{})
+	store.Close()
+
+	name := filepath.Join(dir, dataName(1))
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(name, info.Size()-2); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openStore(t, dir, StoreOptions[string, string]{})
+	defer store.Close()
+	if _, _, found := store.Get("key1"); !found {
+		t.Error("Expected key1 to be restored")
+	}
+	if _, _, found := store.Get("key2"); found {
+		t.Error("Expected torn key2 to be dropped")
+	}
+}
+
+// При превышении MaxSize удаляется самый старый файл данных
+func TestStoreMaxSize(t *testing.T) {
+	store := openStore(t, t.TempDir(), StoreOptions[string, string]{FileSize: 256, MaxSize: 1024})
+	defer store.Close()
+
+	for i := 0; i < 100; i++ {
+		store.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i), time.Time{})
+	}
+
+	st := store.Stats()
+	if st.Bytes > 1024+256 || st.Evictions == 0 {
+		t.Errorf("Expected size limit to evict old files, got %+v", st)
+	}
+	if _, _, found := store.Get("key0"); found {
+		t.Error("Expected key0 to be evicted")
+	}
+	if v, _, found := store.Get("key99"); !found || v != "value99" {
+		t.Errorf("Expected value99, got %v (found: %v)", v, found)
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openStore(t, dir, StoreOptions[string, string]{FileSize: 128})
+	for i := 0; i < 50; i++ {
+		store.Put(fmt.Sprintf("key%d", i%5), fmt.Sprintf("value%d", i), time.Time{})
+	}
+	store.Delete("key0")
+
+	before := store.Stats()
+	if err := store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after := store.Stats()
+	if after.Compactions != 1 || after.Bytes >= before.Bytes || after.ReclaimedBytes == 0 {
+		t.Errorf("Expected compaction to reclaim space, before %+v, after %+v", before, after)
+	}
+	store.Close()
+
+	store = openStore(t, dir, StoreOptions[string, string]{})
+	defer store.Close()
+	if _, _, found := store.Get("key0"); found {
+		t.Error("Expected key0 to stay deleted")
+	}
+	for i := 1; i < 5; i++ {
+		want := fmt.Sprintf("value%d", 45+i)
+		if v, _, found := store.Get(fmt.Sprintf("key%d", i)); !found || v != want {
+			t.Errorf("Expected %s, got %v (found: %v)", want, v, found)
+		}
+	}
+}
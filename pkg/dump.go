@@ -0,0 +1,45 @@
+package pkg
+
+import "math/bits"
+
+// Dump - отладочный снимок внутреннего состояния кэша. Ключи приведены к строкам
+// через fmt.Sprint. Поля, не относящиеся к политике кэша, пусты.
+type Dump struct {
+	Capacity  int   `json:"capacity,omitempty"` // 0 у кэша, ограниченного весом
+	MaxWeight int64 `json:"max_weight,omitempty"`
+
+	// lru: первые элементы от недавно использованных (Head) и последние,
+	// заканчивая кандидатом на вытеснение (Tail), в порядке списка
+	Head []string `json:"head,omitempty"`
+	Tail []string `json:"tail,omitempty"`
+
+	// lfu: самые частые ключи по убыванию частоты и распределение ключей по частотам
+	Hottest     []KeyFreq    `json:"hottest,omitempty"`
+	FreqBuckets []FreqBucket `json:"freq_buckets,omitempty"`
+}
+
+// KeyFreq - ключ и его частота обращений.
+type KeyFreq struct {
+	Key  string `json:"key"`
+	Freq int    `json:"freq"`
+}
+
+// FreqBucket - число ключей с частотой в диапазоне [Min, Max]. Границы - степени двойки.
+type FreqBucket struct {
+	Min  int `json:"min"`
+	Max  int `json:"max"`
+	Keys int `json:"keys"`
+}
+
+// AddFreq учитывает n ключей с частотой freq в корзинах, упорядоченных по возрастанию.
+func AddFreq(buckets []FreqBucket, freq, n int) []FreqBucket {
+	if freq < 1 {
+		freq = 1
+	}
+	low := 1 << (bits.Len(uint(freq)) - 1)
+	if last := len(buckets) - 1; last >= 0 && buckets[last].Min == low {
+		buckets[last].Keys += n
+		return buckets
+	}
+	return append(buckets, FreqBucket{Min: low, Max: low<<1 - 1, Keys: n})
+}
@@ -0,0 +1,16 @@
+package pkg
+
+import "time"
+
+// Entry - элемент кэша с метаданными. Чтение Entry не меняет порядок использования
+// и частоту обращений.
+type Entry[KeyT comparable, ValueT any] struct {
+	Key        KeyT
+	Value      ValueT
+	CreatedAt  time.Time // первая запись ключа; повторный Put ее не меняет
+	LastAccess time.Time // последнее попадание Get или запись
+	ExpiresAt  time.Time // нулевое значение - без ограничения времени жизни
+	Hits       int64     // попадания Get с момента создания
+	Frequency  int       // частота обращений lfu, у lru - 0
+	Weight     int64
+}
@@ -0,0 +1,32 @@
+package pkg
+
+import "time"
+
+// EvictReason - причина, по которой кэш удалил элемент сам.
+type EvictReason int
+
+const (
+	// EvictCapacity - элемент вытеснен политикой при переполнении кэша.
+	EvictCapacity EvictReason = iota
+	// EvictExpired - истек срок жизни элемента.
+	EvictExpired
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	default:
+		return "unknown"
+	}
+}
+
+// Eviction описывает элемент, удаленный кэшем.
+type Eviction[KeyT comparable, ValueT any] struct {
+	Key       KeyT
+	Value     ValueT
+	ExpiresAt time.Time // нулевое значение - без ограничения времени жизни
+	Reason    EvictReason
+}
@@ -0,0 +1,42 @@
+package group
+
+import "sync"
+
+// call - выполняющаяся или завершенная загрузка ключа.
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// flight объединяет одновременные загрузки одного ключа: функция выполняется один раз,
+// остальные вызовы ждут ее результата.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// do выполняет fn для key. shared сообщает, что результат получен чужим вызовом.
+func (f *flight) do(key string, fn func() ([]byte, error)) (value []byte, err error, shared bool) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*call)
+	}
+	if c, ok := f.calls[key]; ok {
+		f.mu.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+	c := &call{done: make(chan struct{})}
+	f.calls[key] = c
+	f.mu.Unlock()
+
+	defer func() {
+		f.mu.Lock()
+		delete(f.calls, key)
+		f.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
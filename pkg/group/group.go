@@ -0,0 +1,229 @@
+// Package group - распределенный кэш с загрузкой по требованию в духе groupcache.
+// Каждый процесс хранит локальный lru. Ключ принадлежит одному из процессов по кольцу
+// согласованного хеширования: при промахе процесс запрашивает значение у владельца,
+// а владелец загружает его из источника один раз, объединяя одновременные запросы.
+// Значения популярных чужих ключей копируются в отдельный кэш горячих ключей.
+//
+// Значения считаются неизменяемыми: обновленного значения не увидят процессы,
+// у которых уже есть копия, пока она не будет вытеснена или не истечет Options.TTL.
+package group
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// Getter загружает значение ключа из источника, например из базы данных.
+// Вызывается только в процессе-владельце ключа или когда владелец недоступен.
+type Getter func(ctx context.Context, key string) ([]byte, error)
+
+// Peer - другой процесс группы.
+type Peer interface {
+	Get(ctx context.Context, group, key string) ([]byte, error)
+}
+
+// PeerPicker выбирает владельца ключа. ok == false означает, что ключ принадлежит текущему процессу.
+type PeerPicker interface {
+	PickPeer(key string) (peer Peer, ok bool)
+}
+
+// registrar реализуют транспорты, которые принимают запросы других процессов к группам.
+type registrar interface {
+	register(g *Group)
+}
+
+// Options - настройки группы. Нулевое значение - 1024 своих ключа, 128 горячих
+// и копирование каждого десятого значения, полученного от владельца.
+type Options struct {
+	// CacheSize - число ключей, принадлежащих процессу, в локальном кэше.
+	CacheSize int
+	// HotCacheSize - число копий чужих ключей, по умолчанию CacheSize/8.
+	HotCacheSize int
+	// HotFraction - значение от владельца копируется в кэш горячих ключей с вероятностью 1/HotFraction.
+	// Частые ключи попадают туда быстро, редкие не вытесняют их.
+	HotFraction int
+	// TTL - время жизни значений в обоих кэшах, 0 - без ограничения.
+	TTL time.Duration
+}
+
+// Stats - счетчики группы.
+type Stats struct {
+	Gets           int64 // вызовы Get
+	CacheHits      int64 // попадания в кэш своих ключей
+	HotHits        int64 // попадания в кэш горячих ключей
+	PeerLoads      int64 // значения, полученные от владельца
+	PeerErrors     int64 // неудачные запросы к владельцу
+	Loads          int64 // вызовы Getter
+	LoadsDeduped   int64 // вызовы Get, получившие результат одновременной загрузки
+	ServerRequests int64 // запросы других процессов
+}
+
+// Group - пространство имен кэша с одним источником данных.
+type Group struct {
+	name   string
+	getter Getter
+	peers  PeerPicker
+	opts   Options
+	main   *lru.Cache[string, []byte]
+	hot    *lru.Cache[string, []byte]
+	flight flight
+
+	gets           atomic.Int64
+	cacheHits      atomic.Int64
+	hotHits        atomic.Int64
+	peerLoads      atomic.Int64
+	peerErrors     atomic.Int64
+	loads          atomic.Int64
+	loadsDeduped   atomic.Int64
+	serverRequests atomic.Int64
+}
+
+// New создает группу name. peers может быть nil - тогда все ключи загружаются локально.
+// Если peers - HTTPPool, группа регистрируется в нем и обслуживает запросы других процессов.
+func New(name string, getter Getter, peers PeerPicker, opts Options) *Group {
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = 1024
+	}
+	if opts.HotCacheSize <= 0 {
+		opts.HotCacheSize = max(opts.CacheSize/8, 1)
+	}
+	if opts.HotFraction <= 0 {
+		opts.HotFraction = 10
+	}
+	g := &Group{
+		name:   name,
+		getter: getter,
+		peers:  peers,
+		opts:   opts,
+		main:   lru.NewCache[string, []byte](opts.CacheSize),
+		hot:    lru.NewCache[string, []byte](opts.HotCacheSize),
+	}
+	if r, ok := peers.(registrar); ok {
+		r.register(g)
+	}
+	return g
+}
+
+// Name возвращает имя группы.
+func (g *Group) Name() string {
+	return g.name
+}
+
+// Get возвращает значение ключа из локального кэша, от владельца или из источника.
+// Возвращаемый срез общий с кэшем и не должен изменяться.
+func (g *Group) Get(ctx context.Context, key string) ([]byte, error) {
+	g.gets.Add(1)
+	if value, ok := g.lookup(key); ok {
+		return value, nil
+	}
+
+	value, err, shared := g.flight.do(key, func() ([]byte, error) {
+		// Пока ждали очереди, значение могла положить предыдущая загрузка
+		if value, ok := g.lookup(key); ok {
+			return value, nil
+		}
+		if g.peers != nil {
+			if peer, ok := g.peers.PickPeer(key); ok {
+				return g.getFromPeer(ctx, peer, key)
+			}
+		}
+		value, err := g.load(ctx, key)
+		if err == nil {
+			g.main.Put(key, value, g.opts.TTL)
+		}
+		return value, err
+	})
+	if shared {
+		g.loadsDeduped.Add(1)
+	}
+	return value, err
+}
+
+// getFromPeer запрашивает значение у владельца. Если владелец недоступен, значение
+// загружается локально и сохраняется как горячая копия, чтобы не нагружать источник.
+func (g *Group) getFromPeer(ctx context.Context, peer Peer, key string) ([]byte, error) {
+	value, err := peer.Get(ctx, g.name, key)
+	if err == nil {
+		g.peerLoads.Add(1)
+		if rand.IntN(g.opts.HotFraction) == 0 {
+			g.hot.Put(key, value, g.opts.TTL)
+		}
+		return value, nil
+	}
+	g.peerErrors.Add(1)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	value, err = g.load(ctx, key)
+	if err == nil {
+		g.hot.Put(key, value, g.opts.TTL)
+	}
+	return value, err
+}
+
+// serve отвечает на запрос другого процесса. Запрос не перенаправляется дальше,
+// даже если по мнению этого процесса ключ принадлежит другому: так расхождение
+// списков процессов не приводит к циклам.
+func (g *Group) serve(ctx context.Context, key string) ([]byte, error) {
+	g.serverRequests.Add(1)
+	if value, ok := g.main.Get(key); ok {
+		g.cacheHits.Add(1)
+		return value, nil
+	}
+	value, err, shared := g.flight.do(key, func() ([]byte, error) {
+		if value, ok := g.main.Get(key); ok {
+			return value, nil
+		}
+		value, err := g.load(ctx, key)
+		if err == nil {
+			g.main.Put(key, value, g.opts.TTL)
+		}
+		return value, err
+	})
+	if shared {
+		g.loadsDeduped.Add(1)
+	}
+	return value, err
+}
+
+func (g *Group) lookup(key string) ([]byte, bool) {
+	if value, ok := g.main.Get(key); ok {
+		g.cacheHits.Add(1)
+		return value, true
+	}
+	if value, ok := g.hot.Get(key); ok {
+		g.hotHits.Add(1)
+		return value, true
+	}
+	return nil, false
+}
+
+func (g *Group) load(ctx context.Context, key string) ([]byte, error) {
+	g.loads.Add(1)
+	return g.getter(ctx, key)
+}
+
+// Remove удаляет ключ из локальных кэшей этого процесса. Копии в других процессах остаются.
+func (g *Group) Remove(key string) {
+	g.main.Delete(key)
+	g.hot.Delete(key)
+}
+
+// Stats возвращает счетчики группы.
+func (g *Group) Stats() Stats {
+	return Stats{
+		Gets:           g.gets.Load(),
+		CacheHits:      g.cacheHits.Load(),
+		HotHits:        g.hotHits.Load(),
+		PeerLoads:      g.peerLoads.Load(),
+		PeerErrors:     g.peerErrors.Load(),
+		Loads:          g.loads.Load(),
+		LoadsDeduped:   g.loadsDeduped.Load(),
+		ServerRequests: g.serverRequests.Load(),
+	}
+}
@@ -0,0 +1,196 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// process - один процесс группы на петлевом интерфейсе.
+type process struct {
+	srv   *httptest.Server
+	pool  *HTTPPool
+	group *Group
+}
+
+// startProcesses запускает n процессов группы "test" с общим источником getter.
+func startProcesses(t *testing.T, n int, getter Getter, opts Options) []*process {
+	t.Helper()
+	procs := make([]*process, n)
+	urls := make([]string, n)
+	for i := range procs {
+		p := &process{}
+		p.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.pool.ServeHTTP(w, r)
+		}))
+		t.Cleanup(p.srv.Close)
+		p.pool = NewHTTPPool(p.srv.URL, HTTPPoolOptions{})
+		procs[i] = p
+		urls[i] = p.srv.URL
+	}
+	for _, p := range procs {
+		p.pool.Set(urls...)
+		p.group = New("test", getter, p.pool, opts)
+	}
+	return procs
+}
+
+// countingGetter считает вызовы источника по ключам.
+type countingGetter struct {
+	mu    sync.Mutex
+	calls map[string]int
+	delay time.Duration
+}
+
+func (c *countingGetter) get(ctx context.Context, key string) ([]byte, error) {
+	time.Sleep(c.delay)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = make(map[string]int)
+	}
+	c.calls[key]++
+	if key == "fail" {
+		return nil, errors.New("no such row")
+	}
+	return []byte("value:" + key), nil
+}
+
+func TestGroupLoadsOnceClusterWide(t *testing.T) {
+	var source countingGetter
+	procs := startProcesses(t, 3, source.get, Options{})
+	ctx := context.Background()
+
+	for round := 0; round < 2; round++ {
+		for _, p := range procs {
+			for i := 0; i < 50; i++ {
+				key := "k" + strconv.Itoa(i)
+				value, err := p.group.Get(ctx, key)
+				if err != nil || string(value) != "value:"+key {
+					t.Fatalf("Get(%s) = %q, %v", key, value, err)
+				}
+			}
+		}
+	}
+	for key, n := range source.calls {
+		if n != 1 {
+			t.Errorf("%s loaded %d times", key, n)
+		}
+	}
+
+	// Каждый процесс владеет частью ключей и обслуживает запросы остальных
+	var loads int64
+	for _, p := range procs {
+		stats := p.group.Stats()
+		if stats.Loads == 0 || stats.ServerRequests == 0 {
+			t.Errorf("process %s: %+v", p.srv.URL, stats)
+		}
+		loads += stats.Loads
+	}
+	if loads != 50 {
+		t.Errorf("loads %d, want 50", loads)
+	}
+
+	if _, err := procs[0].group.Get(ctx, "fail"); err == nil {
+		t.Error("getter error not returned")
+	}
+}
+
+func TestGroupSingleflight(t *testing.T) {
+	source := countingGetter{delay: 50 * time.Millisecond}
+	procs := startProcesses(t, 2, source.get, Options{})
+
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(p *process) {
+			defer wg.Done()
+			if _, err := p.group.Get(context.Background(), "slow"); err != nil {
+				failed.Add(1)
+			}
+		}(procs[i%2])
+	}
+	wg.Wait()
+	if failed.Load() != 0 || source.calls["slow"] != 1 {
+		t.Errorf("failed %d, loads %d", failed.Load(), source.calls["slow"])
+	}
+}
+
+func TestGroupHotCache(t *testing.T) {
+	var source countingGetter
+	procs := startProcesses(t, 2, source.get, Options{HotFraction: 1})
+	ctx := context.Background()
+
+	// Ключ, которым владеет второй процесс
+	var key string
+	for i := 0; ; i++ {
+		key = "k" + strconv.Itoa(i)
+		if _, remote := procs[0].pool.PickPeer(key); remote {
+			break
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := procs[0].group.Get(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := procs[0].group.Stats()
+	if stats.PeerLoads != 1 || stats.HotHits != 2 || procs[1].group.Stats().ServerRequests != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestGroupPeerDown(t *testing.T) {
+	var source countingGetter
+	procs := startProcesses(t, 2, source.get, Options{})
+	procs[1].srv.Close()
+
+	var key string
+	for i := 0; ; i++ {
+		key = "k" + strconv.Itoa(i)
+		if _, remote := procs[0].pool.PickPeer(key); remote {
+			break
+		}
+	}
+	for i := 0; i < 2; i++ {
+		value, err := procs[0].group.Get(context.Background(), key)
+		if err != nil || string(value) != "value:"+key {
+			t.Fatalf("Get = %q, %v", value, err)
+		}
+	}
+	if stats := procs[0].group.Stats(); stats.PeerErrors != 1 || stats.Loads != 1 || stats.HotHits != 1 {
+		t.Errorf("stats %+v", stats)
+	}
+}
+
+func TestHTTPPoolRequests(t *testing.T) {
+	var source countingGetter
+	procs := startProcesses(t, 1, source.get, Options{})
+	base := procs[0].srv.URL + DefaultBasePath
+
+	for path, want := range map[string]int{
+		"test/a%2Fb":  http.StatusOK,
+		"missing/key": http.StatusNotFound,
+		"test/fail":   http.StatusInternalServerError,
+		"test":        http.StatusBadRequest,
+	} {
+		resp, err := http.Get(base + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: status %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+	if source.calls["a/b"] != 1 {
+		t.Errorf("escaped key not loaded: %v", source.calls)
+	}
+}
@@ -0,0 +1,172 @@
+package group
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cluster"
+)
+
+// DefaultBasePath - префикс пути, по которому HTTPPool принимает запросы других процессов.
+const DefaultBasePath = "/_group/"
+
+// HTTPPoolOptions - настройки HTTPPool. Нулевое значение - DefaultBasePath,
+// 160 виртуальных узлов на процесс и http.DefaultClient.
+type HTTPPoolOptions struct {
+	BasePath     string
+	VirtualNodes int
+	HTTPClient   *http.Client
+	// MaxValueSize - наибольший размер ответа другого процесса в байтах, по умолчанию 32 МиБ.
+	MaxValueSize int64
+}
+
+// HTTPPool - транспорт по HTTP по умолчанию: выбирает владельца ключа по кольцу
+// согласованного хеширования и обслуживает запросы других процессов как http.Handler.
+//
+//	GET {BasePath}{group}/{key} - значение ключа, имя группы и ключ экранированы
+type HTTPPool struct {
+	self string
+	opts HTTPPoolOptions
+
+	mu     sync.RWMutex
+	ring   *cluster.Ring
+	peers  map[string]*httpPeer
+	groups map[string]*Group
+}
+
+// NewHTTPPool создает транспорт процесса с адресом self, например "http://10.0.0.1:8080".
+// Адрес должен совпадать с тем, под которым процесс указан в Set.
+func NewHTTPPool(self string, opts HTTPPoolOptions) *HTTPPool {
+	if opts.BasePath == "" {
+		opts.BasePath = DefaultBasePath
+	}
+	if opts.VirtualNodes <= 0 {
+		opts.VirtualNodes = 160
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.MaxValueSize <= 0 {
+		opts.MaxValueSize = 32 << 20
+	}
+	return &HTTPPool{
+		self:   strings.TrimSuffix(self, "/"),
+		opts:   opts,
+		ring:   cluster.NewRing(opts.VirtualNodes),
+		groups: make(map[string]*Group),
+	}
+}
+
+// Set заменяет список процессов группы. Список включает и текущий процесс.
+func (p *HTTPPool) Set(peers ...string) {
+	ring := cluster.NewRing(p.opts.VirtualNodes)
+	clients := make(map[string]*httpPeer, len(peers))
+	for _, peer := range peers {
+		peer = strings.TrimSuffix(peer, "/")
+		ring.Add(peer)
+		clients[peer] = &httpPeer{base: peer + p.opts.BasePath, pool: p}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ring = ring
+	p.peers = clients
+}
+
+// PickPeer реализует PeerPicker.
+func (p *HTTPPool) PickPeer(key string) (Peer, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	owner := p.ring.Lookup(key)
+	if owner == "" || owner == p.self {
+		return nil, false
+	}
+	return p.peers[owner], true
+}
+
+func (p *HTTPPool) register(g *Group) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.groups[g.name] = g
+}
+
+// ServeHTTP обслуживает запросы других процессов.
+func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, p.opts.BasePath) {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	escapedName, escapedKey, ok := strings.Cut(path[len(p.opts.BasePath):], "/")
+	if !ok {
+		http.Error(w, "expected "+p.opts.BasePath+"{group}/{key}", http.StatusBadRequest)
+		return
+	}
+	name, err1 := url.PathUnescape(escapedName)
+	key, err2 := url.PathUnescape(escapedKey)
+	if err1 != nil || err2 != nil {
+		http.Error(w, "invalid escaping", http.StatusBadRequest)
+		return
+	}
+
+	p.mu.RLock()
+	g := p.groups[name]
+	p.mu.RUnlock()
+	if g == nil {
+		http.Error(w, "no such group: "+name, http.StatusNotFound)
+		return
+	}
+
+	value, err := g.serve(r.Context(), key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+// httpPeer - клиент к другому процессу.
+type httpPeer struct {
+	base string
+	pool *HTTPPool
+}
+
+func (h *httpPeer) Get(ctx context.Context, group, key string) ([]byte, error) {
+	target := h.base + url.PathEscape(group) + "/" + url.PathEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h.pool.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("group: %s: %s: %s", h.base, resp.Status, strings.TrimSpace(string(message)))
+	}
+	value, err := io.ReadAll(io.LimitReader(resp.Body, h.pool.opts.MaxValueSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(value)) > h.pool.opts.MaxValueSize {
+		return nil, fmt.Errorf("group: %s: value exceeds %d bytes", h.base, h.pool.opts.MaxValueSize)
+	}
+	return value, nil
+}
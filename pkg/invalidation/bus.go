@@ -0,0 +1,170 @@
+// Package invalidation рассылает сообщения об изменении ключей между процессами,
+// каждый из которых держит локальную копию данных в кэше (NearCache).
+//
+// Доставка не гарантируется: сообщение может потеряться при разрыве соединения.
+// Поэтому NearCache ограничивает время жизни локальных копий, а TCPBus после
+// переподключения просит подписчиков сбросить все копии.
+package invalidation
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+)
+
+// ErrClosed возвращают операции закрытой шины.
+var ErrClosed = errors.New("invalidation: closed")
+
+// Message - сообщение об изменении ключей.
+type Message struct {
+	// Source - идентификатор отправителя. Подписчик пропускает собственные сообщения.
+	Source string
+	// Keys - закодированные ключи, копии которых устарели.
+	Keys [][]byte
+	// All - устарели все копии, например после потери сообщений.
+	All bool
+}
+
+// Bus - шина сообщений об изменении ключей.
+type Bus interface {
+	// Publish отправляет сообщение всем подписчикам, в том числе в других процессах.
+	Publish(msg Message) error
+	// Subscribe регистрирует обработчик сообщений и возвращает функцию отмены подписки.
+	// Обработчик не должен блокироваться надолго.
+	Subscribe(fn func(msg Message)) (cancel func())
+	Close() error
+}
+
+// subscribers - список обработчиков, общий для реализаций шины.
+type subscribers struct {
+	mu     sync.RWMutex
+	nextID int
+	fns    map[int]func(msg Message)
+}
+
+func (s *subscribers) add(fn func(msg Message)) func() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fns == nil {
+		s.fns = make(map[int]func(msg Message))
+	}
+	id := s.nextID
+	s.nextID++
+	s.fns[id] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.fns, id)
+		})
+	}
+}
+
+func (s *subscribers) deliver(msg Message) {
+	s.mu.RLock()
+	fns := make([]func(msg Message), 0, len(s.fns))
+	for _, fn := range s.fns {
+		fns = append(fns, fn)
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(msg)
+	}
+}
+
+// LocalBus доставляет сообщения подписчикам в том же процессе синхронно.
+// Подходит для тестов и для нескольких кэшей одного процесса.
+type LocalBus struct {
+	subs   subscribers
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewLocalBus создает шину внутри процесса.
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+// Publish вызывает обработчики всех подписчиков.
+func (b *LocalBus) Publish(msg Message) error {
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+	b.subs.deliver(msg)
+	return nil
+}
+
+// Subscribe реализует Bus.
+func (b *LocalBus) Subscribe(fn func(msg Message)) func() {
+	return b.subs.add(fn)
+}
+
+// Close прекращает доставку сообщений.
+func (b *LocalBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+// Кодирование сообщения: источник, флаг All, число ключей и ключи; строки и ключи
+// предваряются длиной в uvarint.
+func appendMessage(buf []byte, msg Message) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(msg.Source)))
+	buf = append(buf, msg.Source...)
+	if msg.All {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(msg.Keys)))
+	for _, key := range msg.Keys {
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+	}
+	return buf
+}
+
+var errFormat = errors.New("invalidation: malformed message")
+
+func decodeMessage(data []byte) (Message, error) {
+	var msg Message
+	source, data, ok := readField(data)
+	if !ok || len(data) == 0 {
+		return msg, errFormat
+	}
+	msg.Source = string(source)
+	msg.All = data[0] == 1
+	count, n := binary.Uvarint(data[1:])
+	if n <= 0 || count > uint64(len(data)) {
+		return msg, errFormat
+	}
+	data = data[1+n:]
+	msg.Keys = make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var key []byte
+		if key, data, ok = readField(data); !ok {
+			return msg, errFormat
+		}
+		msg.Keys = append(msg.Keys, key)
+	}
+	if len(data) != 0 {
+		return msg, errFormat
+	}
+	return msg, nil
+}
+
+func readField(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, false
+	}
+	return data[n : n+int(size)], data[n+int(size):], true
+}
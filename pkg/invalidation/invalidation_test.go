@@ -0,0 +1,139 @@
+package invalidation
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+func TestMessageEncoding(t *testing.T) {
+	for _, msg := range []Message{
+		{Source: "a", Keys: [][]byte{[]byte("k1"), {}}},
+		{All: true, Keys: [][]byte{}},
+	} {
+		got, err := decodeMessage(appendMessage(nil, msg))
+		if err != nil || !reflect.DeepEqual(got, msg) {
+			t.Errorf("round trip %+v: %+v, %v", msg, got, err)
+		}
+	}
+	if _, err := decodeMessage([]byte{1, 'a', 0, 5}); err == nil {
+		t.Error("truncated message accepted")
+	}
+}
+
+func TestNearCacheLocalBus(t *testing.T) {
+	bus := NewLocalBus()
+	a := NewNearCache[string, int](lru.NewCache[string, int](10), bus, Options[string]{})
+	b := NewNearCache[string, int](lru.NewCache[string, int](10), bus, Options[string]{})
+	defer a.Close()
+
+	a.Put("k", 1, 0)
+	b.Put("k", 2, 0)
+	if _, ok := a.Get("k"); ok {
+		t.Error("a kept a stale copy after b wrote the key")
+	}
+	if v, _ := b.Get("k"); v != 2 {
+		t.Errorf("b.Get = %d", v)
+	}
+
+	a.Put("j", 1, 0)
+	b.Invalidate("j")
+	if _, ok := a.Get("j"); ok {
+		t.Error("invalidated key still in a")
+	}
+	if stats := a.Stats(); stats.Invalidated != 2 || stats.Published != 2 {
+		t.Errorf("a stats %+v", stats)
+	}
+
+	// После отмены подписки сообщения не доходят
+	b.Close()
+	a.Put("k", 3, 0)
+	if v, ok := b.Get("k"); !ok || v != 2 {
+		t.Errorf("unsubscribed b lost its copy: %d %v", v, ok)
+	}
+}
+
+func TestNearCacheMaxTTL(t *testing.T) {
+	local := lru.NewCache[string, int](10)
+	c := NewNearCache[string, int](local, NewLocalBus(), Options[string]{MaxTTL: time.Minute})
+	c.Put("forever", 1, 0)
+	c.Put("long", 1, time.Hour)
+	c.Put("short", 1, time.Second)
+	for key, max := range map[string]time.Duration{"forever": time.Minute, "long": time.Minute, "short": time.Second} {
+		if ttl, ok := local.TTL(key); !ok || ttl <= 0 || ttl > max {
+			t.Errorf("TTL(%s) = %v", key, ttl)
+		}
+	}
+}
+
+func startHub(t *testing.T) (*Hub, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub := NewHub()
+	done := make(chan error, 1)
+	go func() { done <- hub.Serve(ln) }()
+	t.Cleanup(func() {
+		hub.Close()
+		if err := <-done; !errors.Is(err, ErrClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return hub, ln.Addr().String()
+}
+
+func dialBus(t *testing.T, addr string) *TCPBus {
+	t.Helper()
+	bus := DialTCPBus(addr, 20*time.Millisecond)
+	t.Cleanup(func() { bus.Close() })
+	waitFor(t, bus.Connected)
+	return bus
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNearCacheTCP(t *testing.T) {
+	hub, addr := startHub(t)
+	local := lru.NewCache[string, string](10)
+	a := NewNearCache[string, string](lru.NewCache[string, string](10), dialBus(t, addr), Options[string]{})
+	b := NewNearCache[string, string](local, dialBus(t, addr), Options[string]{})
+
+	b.Put("k", "old", 0)
+	// Сообщение b, пришедшее после записи a, удалило бы и свежую копию: это лишний промах, а не ошибка
+	waitFor(t, func() bool { return a.Stats().Received == 1 })
+	a.Put("k", "new", 0)
+	waitFor(t, func() bool { return b.Stats().Invalidated == 1 })
+	if _, ok := b.Get("k"); ok {
+		t.Error("stale copy in b")
+	}
+	if v, _ := a.Get("k"); v != "new" {
+		t.Errorf("a dropped its own write: %q", v)
+	}
+
+	// Разрыв соединения с Hub: после переподключения b сбрасывает все копии
+	b.Put("x", "1", 0)
+	hub.mu.Lock()
+	for c := range hub.clients {
+		c.conn.Close()
+	}
+	hub.mu.Unlock()
+	waitFor(t, func() bool { return b.Stats().Flushes >= 1 })
+	if local.Len() != 0 {
+		t.Errorf("%d copies survived reconnect", local.Len())
+	}
+}
@@ -0,0 +1,155 @@
+package invalidation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// Local - локальный кэш NearCache. Его реализуют lru.Cache и lfu.Cache.
+type Local[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	Clear()
+}
+
+// Options - настройки NearCache. Нулевое значение - время жизни копий 1 минута,
+// ключи кодируются snapshot.Gob.
+type Options[KeyT comparable] struct {
+	// MaxTTL ограничивает время жизни локальных копий: потерянное сообщение
+	// оставляет устаревшую копию не дольше MaxTTL.
+	MaxTTL time.Duration
+	// Keys кодирует ключи в сообщениях. Должен совпадать во всех процессах.
+	Keys snapshot.Codec[KeyT]
+	// Source - идентификатор процесса, по умолчанию случайный.
+	Source string
+}
+
+// Stats - счетчики NearCache.
+type Stats struct {
+	Published     int64 // отправленные сообщения
+	PublishErrors int64 // сообщения, которые не удалось отправить
+	Received      int64 // полученные сообщения других процессов
+	Invalidated   int64 // ключи, удаленные по сообщениям
+	Flushes       int64 // сбросы всех копий
+}
+
+// NearCache - локальный кэш копий данных, которые изменяются в нескольких процессах.
+// Изменение ключа через Put, Delete или Invalidate рассылается остальным процессам,
+// и они удаляют свои копии. Сообщение о более ранней записи другого процесса может прийти
+// после локальной записи и удалить свежую копию - это приводит лишь к промаху.
+// Реализует интерфейс Cacher.
+type NearCache[KeyT comparable, ValueT any] struct {
+	local  Local[KeyT, ValueT]
+	bus    Bus
+	opts   Options[KeyT]
+	cancel func()
+
+	published     atomic.Int64
+	publishErrors atomic.Int64
+	received      atomic.Int64
+	invalidated   atomic.Int64
+	flushes       atomic.Int64
+}
+
+// NewNearCache подписывает local на сообщения bus. Close отменяет подписку.
+func NewNearCache[KeyT comparable, ValueT any](local Local[KeyT, ValueT], bus Bus, opts Options[KeyT]) *NearCache[KeyT, ValueT] {
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = time.Minute
+	}
+	if opts.Keys == nil {
+		opts.Keys = snapshot.Gob[KeyT]{}
+	}
+	if opts.Source == "" {
+		var id [8]byte
+		rand.Read(id[:])
+		opts.Source = hex.EncodeToString(id[:])
+	}
+	c := &NearCache[KeyT, ValueT]{
+		local: local,
+		bus:   bus,
+		opts:  opts,
+	}
+	c.cancel = bus.Subscribe(c.receive)
+	return c
+}
+
+// Get возвращает локальную копию.
+func (c *NearCache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	return c.local.Get(key)
+}
+
+// Put сохраняет копию на время не больше MaxTTL и просит остальные процессы удалить свои.
+func (c *NearCache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
+	if ttl <= 0 || ttl > c.opts.MaxTTL {
+		ttl = c.opts.MaxTTL
+	}
+	c.local.Put(key, value, ttl)
+	c.publish(key)
+}
+
+// Delete удаляет копию здесь и в остальных процессах.
+func (c *NearCache[KeyT, ValueT]) Delete(key KeyT) bool {
+	deleted := c.local.Delete(key)
+	c.publish(key)
+	return deleted
+}
+
+// Invalidate удаляет копию ключа, который изменился в источнике данных, здесь и в остальных процессах.
+func (c *NearCache[KeyT, ValueT]) Invalidate(key KeyT) {
+	c.Delete(key)
+}
+
+func (c *NearCache[KeyT, ValueT]) publish(key KeyT) {
+	raw, err := c.opts.Keys.Marshal(key)
+	if err == nil {
+		err = c.bus.Publish(Message{Source: c.opts.Source, Keys: [][]byte{raw}})
+	}
+	if err != nil {
+		c.publishErrors.Add(1)
+		return
+	}
+	c.published.Add(1)
+}
+
+func (c *NearCache[KeyT, ValueT]) receive(msg Message) {
+	if msg.Source == c.opts.Source {
+		return
+	}
+	c.received.Add(1)
+	if msg.All {
+		c.local.Clear()
+		c.flushes.Add(1)
+		return
+	}
+	for _, raw := range msg.Keys {
+		var key KeyT
+		if err := c.opts.Keys.Unmarshal(raw, &key); err != nil {
+			continue
+		}
+		if c.local.Delete(key) {
+			c.invalidated.Add(1)
+		}
+	}
+}
+
+// Stats возвращает счетчики.
+func (c *NearCache[KeyT, ValueT]) Stats() Stats {
+	return Stats{
+		Published:     c.published.Load(),
+		PublishErrors: c.publishErrors.Load(),
+		Received:      c.received.Load(),
+		Invalidated:   c.invalidated.Load(),
+		Flushes:       c.flushes.Load(),
+	}
+}
+
+// Close отменяет подписку. Шина не закрывается.
+func (c *NearCache[KeyT, ValueT]) Close() error {
+	c.cancel()
+	return nil
+}
@@ -0,0 +1,314 @@
+package invalidation
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxMessageSize ограничивает кадр сообщения.
+const maxMessageSize = 16 << 20
+
+// Кадр TCP: длина сообщения (uvarint), затем сообщение.
+func writeMessage(w *bufio.Writer, msg Message) error {
+	payload := appendMessage(nil, msg)
+	var size [binary.MaxVarintLen64]byte
+	w.Write(size[:binary.PutUvarint(size[:], uint64(len(payload)))])
+	w.Write(payload)
+	return w.Flush()
+}
+
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxMessageSize {
+		return nil, errFormat
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// Hub - узел-ретранслятор: пересылает каждое сообщение всем подключенным TCPBus,
+// включая отправителя.
+type Hub struct {
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	clients   map[*hubClient]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type hubClient struct {
+	conn net.Conn
+	out  chan []byte
+}
+
+// clientQueue - число сообщений в очереди медленного клиента. При переполнении
+// клиент отключается и после переподключения сбрасывает свои копии.
+const clientQueue = 1024
+
+// NewHub создает ретранслятор.
+func NewHub() *Hub {
+	return &Hub{
+		listeners: make(map[net.Listener]struct{}),
+		clients:   make(map[*hubClient]struct{}),
+	}
+}
+
+// ListenAndServe принимает подключения по адресу addr.
+func (h *Hub) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return h.Serve(ln)
+}
+
+// Serve принимает подключения на ln до вызова Close и тогда возвращает ErrClosed.
+func (h *Hub) Serve(ln net.Listener) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		ln.Close()
+		return ErrClosed
+	}
+	h.listeners[ln] = struct{}{}
+	h.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			h.mu.Lock()
+			closed := h.closed
+			delete(h.listeners, ln)
+			h.mu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+
+		c := &hubClient{conn: conn, out: make(chan []byte, clientQueue)}
+		h.mu.Lock()
+		if h.closed {
+			h.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		h.clients[c] = struct{}{}
+		h.wg.Add(2)
+		h.mu.Unlock()
+
+		go h.read(c)
+		go h.write(c)
+	}
+}
+
+// read пересылает сообщения клиента остальным.
+func (h *Hub) read(c *hubClient) {
+	defer h.wg.Done()
+	defer h.drop(c)
+
+	r := bufio.NewReader(c.conn)
+	for {
+		payload, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		frame := binary.AppendUvarint(nil, uint64(len(payload)))
+		frame = append(frame, payload...)
+
+		h.mu.Lock()
+		for other := range h.clients {
+			select {
+			case other.out <- frame:
+			default:
+				other.conn.Close()
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (h *Hub) write(c *hubClient) {
+	defer h.wg.Done()
+	for frame := range c.out {
+		if _, err := c.conn.Write(frame); err != nil {
+			c.conn.Close()
+			// Дочитываем очередь, пока read не закроет ее
+			for range c.out {
+			}
+			return
+		}
+	}
+}
+
+func (h *Hub) drop(c *hubClient) {
+	c.conn.Close()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.out)
+	}
+}
+
+// Close закрывает все подключения и дожидается их завершения.
+func (h *Hub) Close() error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	for ln := range h.listeners {
+		ln.Close()
+	}
+	for c := range h.clients {
+		c.conn.Close()
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	return nil
+}
+
+// TCPBus - шина поверх подключения к Hub. После разрыва соединения TCPBus
+// переподключается и доставляет подписчикам сообщение с All, так как сообщения
+// за время разрыва потеряны.
+type TCPBus struct {
+	addr     string
+	interval time.Duration
+	subs     subscribers
+
+	mu     sync.Mutex
+	conn   net.Conn
+	w      *bufio.Writer
+	closed bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// DialTCPBus подключается к Hub по адресу addr. reconnect - пауза перед
+// повторным подключением, по умолчанию 100 мс.
+func DialTCPBus(addr string, reconnect time.Duration) *TCPBus {
+	if reconnect <= 0 {
+		reconnect = 100 * time.Millisecond
+	}
+	b := &TCPBus{
+		addr:     addr,
+		interval: reconnect,
+		done:     make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+// Publish отправляет сообщение через Hub. Без подключения сообщение теряется
+// и возвращается ошибка.
+func (b *TCPBus) Publish(msg Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	if b.conn == nil {
+		return net.ErrClosed
+	}
+	b.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if err := writeMessage(b.w, msg); err != nil {
+		b.conn.Close()
+		return err
+	}
+	return nil
+}
+
+// Subscribe реализует Bus.
+func (b *TCPBus) Subscribe(fn func(msg Message)) func() {
+	return b.subs.add(fn)
+}
+
+// Connected сообщает, подключена ли шина к Hub.
+func (b *TCPBus) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn != nil
+}
+
+// Close отключается от Hub.
+func (b *TCPBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+func (b *TCPBus) run() {
+	defer b.wg.Done()
+	for connected := false; ; {
+		conn, err := net.DialTimeout("tcp", b.addr, time.Second)
+		if err == nil {
+			b.mu.Lock()
+			if b.closed {
+				b.mu.Unlock()
+				conn.Close()
+				return
+			}
+			b.conn, b.w = conn, bufio.NewWriter(conn)
+			b.mu.Unlock()
+
+			if connected {
+				b.subs.deliver(Message{All: true})
+			}
+			connected = true
+			b.receive(conn)
+
+			b.mu.Lock()
+			b.conn, b.w = nil, nil
+			b.mu.Unlock()
+		}
+
+		select {
+		case <-b.done:
+			return
+		case <-time.After(b.interval):
+		}
+	}
+}
+
+func (b *TCPBus) receive(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		payload, err := readMessage(r)
+		if err != nil {
+			return
+		}
+		msg, err := decodeMessage(payload)
+		if err != nil {
+			return
+		}
+		b.subs.deliver(msg)
+	}
+}
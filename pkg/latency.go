@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Логарифмически-линейные корзины в духе HDR Histogram: значения меньше latencySub наносекунд
+// хранятся точно, а каждый диапазон [2^e, 2^(e+1)) делится на latencySub равных корзин.
+// Относительная погрешность квантиля не больше 1/latencySub. Значения от 2^latencyMaxExp
+// наносекунд (около 18 минут) попадают в последнюю корзину.
+const (
+	latencySubBits = 4
+	latencySub     = 1 << latencySubBits
+	latencyMaxExp  = 40
+	latencyBuckets = (latencyMaxExp-latencySubBits+1)*latencySub + latencySub
+)
+
+// LatencyHistogram - гистограмма длительностей операций. Запись не берет блокировок:
+// каждое наблюдение - одно атомарное сложение. Нулевое значение готово к использованию.
+type LatencyHistogram struct {
+	counts [latencyBuckets]atomic.Int64
+	sum    atomic.Int64
+}
+
+// Observe добавляет weight наблюдений длительностью d. weight больше 1 используется
+// при выборочной записи, чтобы Count оценивал полное число операций.
+func (h *LatencyHistogram) Observe(d time.Duration, weight int64) {
+	h.counts[latencyBucket(d)].Add(weight)
+	h.sum.Add(int64(d) * weight)
+}
+
+// Snapshot возвращает значения гистограммы.
+func (h *LatencyHistogram) Snapshot() LatencySnapshot {
+	var s LatencySnapshot
+	for i := range h.counts {
+		if n := h.counts[i].Load(); n > 0 {
+			if s.Counts == nil {
+				s.Counts = make([]int64, latencyBuckets)
+			}
+			s.Counts[i] = n
+			s.Count += n
+		}
+	}
+	s.Sum = time.Duration(h.sum.Load())
+	return s
+}
+
+// latencyBucket возвращает номер корзины длительности d.
+func latencyBucket(d time.Duration) int {
+	v := uint64(max(d, 0))
+	if v < latencySub {
+		return int(v)
+	}
+	exp := bits.Len64(v) - 1
+	if exp > latencyMaxExp {
+		return latencyBuckets - 1
+	}
+	sub := int(v>>(exp-latencySubBits)) & (latencySub - 1)
+	return (exp-latencySubBits+1)*latencySub + sub
+}
+
+// latencyUpper возвращает верхнюю границу (не включительно) корзины i.
+func latencyUpper(i int) time.Duration {
+	if i < latencySub {
+		return time.Duration(i + 1)
+	}
+	exp := i/latencySub + latencySubBits - 1
+	sub := i % latencySub
+	return time.Duration(uint64(latencySub+sub+1) << (exp - latencySubBits))
+}
+
+// LatencySnapshot - значения LatencyHistogram. Снимки гистограмм разных шардов или кэшей
+// объединяются методом Merge.
+type LatencySnapshot struct {
+	Counts []int64 // по корзинам, nil - наблюдений нет
+	Count  int64
+	Sum    time.Duration
+}
+
+// Percentiles - квантили длительности операции.
+type Percentiles struct {
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	P999 time.Duration
+}
+
+// Merge добавляет к снимку наблюдения other.
+func (s *LatencySnapshot) Merge(other LatencySnapshot) {
+	if other.Counts != nil {
+		if s.Counts == nil {
+			s.Counts = make([]int64, latencyBuckets)
+		}
+		for i, n := range other.Counts {
+			s.Counts[i] += n
+		}
+	}
+	s.Count += other.Count
+	s.Sum += other.Sum
+}
+
+// Mean возвращает среднюю длительность или 0 без наблюдений.
+func (s LatencySnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile возвращает верхнюю границу корзины, в которую попадает квантиль q из [0, 1],
+// или 0 без наблюдений.
+func (s LatencySnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := min(max(int64(math.Ceil(q*float64(s.Count))), 1), s.Count)
+	var seen int64
+	for i, n := range s.Counts {
+		seen += n
+		if seen >= rank {
+			return latencyUpper(i)
+		}
+	}
+	return latencyUpper(len(s.Counts) - 1)
+}
+
+// Percentiles возвращает p50, p90, p99 и p999.
+func (s LatencySnapshot) Percentiles() Percentiles {
+	return Percentiles{
+		P50:  s.Quantile(0.5),
+		P90:  s.Quantile(0.9),
+		P99:  s.Quantile(0.99),
+		P999: s.Quantile(0.999),
+	}
+}
+
+// Histogram раскладывает наблюдения по корзинам с границами bounds, например LoadBuckets.
+// Корзина LatencyHistogram относится к первой границе не меньше ее верхней границы, как
+// в Quantile, поэтому значения меньше границы не больше чем на 1/16 могут попасть в следующую.
+func (s LatencySnapshot) Histogram(bounds []time.Duration) HistogramSnapshot {
+	h := HistogramSnapshot{
+		Bounds: bounds,
+		Counts: make([]int64, len(bounds)+1),
+		Count:  s.Count,
+		Sum:    s.Sum,
+	}
+	j := 0
+	for i, n := range s.Counts {
+		if n == 0 {
+			continue
+		}
+		// Верхняя граница корзины не включается
+		for j < len(bounds) && latencyUpper(i)-1 > bounds[j] {
+			j++
+		}
+		h.Counts[j] += n
+	}
+	return h
+}
@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	prev := time.Duration(0)
+	for i := 0; i < latencyBuckets; i++ {
+		upper := latencyUpper(i)
+		if upper <= prev {
+			t.Fatalf("bucket %d upper %v after %v", i, upper, prev)
+		}
+		if got := latencyBucket(upper - 1); got != i && i != latencyBuckets-1 {
+			t.Fatalf("bucket(%v) = %d, want %d", upper-1, got, i)
+		}
+		prev = upper
+	}
+	if got := latencyBucket(time.Duration(1) << 62); got != latencyBuckets-1 {
+		t.Errorf("overflow bucket %d", got)
+	}
+	if got := latencyBucket(-time.Second); got != 0 {
+		t.Errorf("negative bucket %d", got)
+	}
+}
+
+func TestLatencyQuantiles(t *testing.T) {
+	var h LatencyHistogram
+	for i := 1; i <= 1000; i++ {
+		h.Observe(time.Duration(i)*time.Microsecond, 1)
+	}
+	s := h.Snapshot()
+	if s.Count != 1000 || s.Mean() != 500500*time.Nanosecond {
+		t.Errorf("count %d, mean %v", s.Count, s.Mean())
+	}
+	p := s.Percentiles()
+	for _, c := range []struct {
+		got, want time.Duration
+	}{{p.P50, 500 * time.Microsecond}, {p.P90, 900 * time.Microsecond}, {p.P99, 990 * time.Microsecond}, {p.P999, 999 * time.Microsecond}} {
+		// Верхняя граница корзины превышает значение не больше чем на 1/16
+		if c.got < c.want || c.got > c.want+c.want/latencySub {
+			t.Errorf("quantile %v, want about %v", c.got, c.want)
+		}
+	}
+	if (LatencySnapshot{}).Quantile(0.5) != 0 {
+		t.Error("empty quantile is not zero")
+	}
+}
+
+func TestLatencyMerge(t *testing.T) {
+	var shards [4]LatencyHistogram
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				shards[i].Observe(time.Duration(i+1)*time.Millisecond, 2)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var total Stats
+	for i := range shards {
+		total.Merge(Stats{Hits: 1, GetLatency: shards[i].Snapshot()})
+	}
+	if total.Hits != 4 || total.GetLatency.Count != 8000 || total.GetLatency.Sum != 20*time.Second {
+		t.Errorf("merged hits %d, count %d, sum %v", total.Hits, total.GetLatency.Count, total.GetLatency.Sum)
+	}
+	if p50 := total.GetLatency.Quantile(0.5); p50 < 2*time.Millisecond || p50 > 2*time.Millisecond+2*time.Millisecond/latencySub {
+		t.Errorf("merged p50 %v", p50)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h LatencyHistogram
+	h.Observe(50*time.Microsecond, 1)
+	h.Observe(900*time.Microsecond, 2)
+	h.Observe(time.Minute, 1)
+	bounds := []time.Duration{100 * time.Microsecond, time.Millisecond, time.Second}
+
+	got := h.Snapshot().Histogram(bounds)
+	want := []int64{1, 2, 0, 1}
+	for i := range want {
+		if got.Counts[i] != want[i] {
+			t.Fatalf("counts %v, want %v", got.Counts, want)
+		}
+	}
+	if got.Count != 4 || got.Sum != time.Minute+1850*time.Microsecond {
+		t.Errorf("count %d, sum %v", got.Count, got.Sum)
+	}
+}
+
+func TestCountersSampling(t *testing.T) {
+	var c Counters
+	c.SetSampling(0)
+	if !c.Start().IsZero() {
+		t.Error("disabled sampling returned a start time")
+	}
+	c.SetSampling(1)
+	for i := 0; i < 10; i++ {
+		c.GetDone(c.Start())
+	}
+	c.SetSampling(4)
+	c.PutDone(time.Now())
+	st := c.Stats()
+	if st.GetLatency.Count != 10 || st.PutLatency.Count != 4 {
+		t.Errorf("get count %d, put count %d", st.GetLatency.Count, st.PutLatency.Count)
+	}
+}
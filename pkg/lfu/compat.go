@@ -0,0 +1,34 @@
+package lfu
+
+import "github.com/ivansevryukov1995/cache-sev/pkg"
+
+// Поля Hash, FreqHead и Lock стали закрытыми: изменение их без блокировки нарушало
+// согласованность списков частот и хеш-таблицы. Методы ниже облегчают переход на новые
+// методы и будут удалены в следующей major-версии.
+
+// Hash возвращает копию элементов кэша с метаданными. Выражения cache.Hash[key]
+// переводятся на cache.Hash()[key]; частота узла item.Parent.Freq доступна как Frequency.
+//
+// Deprecated: используйте GetEntry, Contains, TTL или All.
+func (c *Cache[KeyT, ValueT]) Hash() map[KeyT]pkg.Entry[KeyT, ValueT] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make(map[KeyT]pkg.Entry[KeyT, ValueT], len(c.hash))
+	for key, item := range c.hash {
+		entries[key] = item.entry()
+	}
+	return entries
+}
+
+// Frequencies возвращает элементы кэша в порядке возрастания частоты, как обход
+// списка частот от FreqHead.Next.
+//
+// Deprecated: используйте ByFrequency, Entries или Dump.
+func (c *Cache[KeyT, ValueT]) Frequencies() []pkg.Entry[KeyT, ValueT] {
+	var entries []pkg.Entry[KeyT, ValueT]
+	for e := range c.Entries() {
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -1,126 +1,131 @@
 package lfu
 
 import (
-	"log"
+	"fmt"
+	"iter"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/ivansevryukov1995/cache-sev/pkg"
 )
 
-// Node представляет элемент в LFU кэше, который хранит данные и ссылку на его родительский узел частоты.
-type DataNode[KeyT comparable, ValueT any] struct {
-	Parent *FreqNode[KeyT, ValueT]
-	Key    KeyT
-	Value  ValueT
-	Prev   *DataNode[KeyT, ValueT]
-	Next   *DataNode[KeyT, ValueT]
+// dataNode представляет элемент в LFU кэше, который хранит данные и ссылку на его родительский узел частоты.
+type dataNode[KeyT comparable, ValueT any] struct {
+	pkg.Link[dataNode[KeyT, ValueT]]
+	Parent    *freqNode[KeyT, ValueT]
+	Key       KeyT
+	Value     ValueT
+	ExpiresAt time.Time // нулевое значение - без ограничения времени жизни
+	Weight    int64
+	timer     pkg.Timer // таймер истечения, nil - без ограничения времени жизни
+
+	// Метаданные для GetEntry: время в наносекундах Unix и число попаданий
+	createdAt  int64
+	accessedAt int64
+	hits       int64
 }
 
-type FreqNode[KeyT comparable, ValueT any] struct {
-	Freq  int
-	List  *pkg.DLList[KeyT, ValueT]
-	Value ValueT
-	Prev  *FreqNode[KeyT, ValueT]
-	Next  *FreqNode[KeyT, ValueT]
+// freqNode - узел кольцевого списка частот. Хранит список элементов с одинаковой частотой обращений.
+type freqNode[KeyT comparable, ValueT any] struct {
+	Freq int
+	list pkg.List[dataNode[KeyT, ValueT], *dataNode[KeyT, ValueT]]
+	Prev *freqNode[KeyT, ValueT]
+	Next *freqNode[KeyT, ValueT]
 }
 
 // Cache представляет сам LFU кэш.
 type Cache[KeyT comparable, ValueT any] struct {
-	Capacity int
-	Hash     map[KeyT]*DataNode[KeyT, ValueT]
-	FreqHead *FreqNode[KeyT, ValueT]
-	Lock     sync.RWMutex
+	Capacity  int
+	MaxWeight int64 // 0 - без ограничения суммарного веса
+
+	mu   sync.RWMutex
+	hash map[KeyT]*dataNode[KeyT, ValueT]
+	// freqHead - ограничитель кольцевого списка частот, частоты возрастают по Next
+	freqHead *freqNode[KeyT, ValueT]
+	// free - удаленные узлы частоты, связанные через Next, для повторного использования
+	free    *freqNode[KeyT, ValueT]
+	weigh   func(key KeyT, value ValueT) int64
+	weight  int64
+	onEvict []func(e pkg.Eviction[KeyT, ValueT])
+	stats   pkg.Counters
+	trace   pkg.Trace
+	clock   pkg.Clock
 }
 
-// NewDataNode создает новый элемент LFU.
-func NewDataNode[KeyT comparable, ValueT any](data ValueT, key KeyT, parent *FreqNode[KeyT, ValueT]) *DataNode[KeyT, ValueT] {
-	return &DataNode[KeyT, ValueT]{
+// newDataNode создает новый элемент LFU.
+func newDataNode[KeyT comparable, ValueT any](data ValueT, key KeyT, parent *freqNode[KeyT, ValueT]) *dataNode[KeyT, ValueT] {
+	return &dataNode[KeyT, ValueT]{
 		Parent: parent,
 		Key:    key,
 		Value:  data,
 	}
 }
 
-func NewDLList[KeyT comparable, ValueT any]() *pkg.DLList[KeyT, ValueT] {
-	head := &DataNode[KeyT, ValueT]{}
-	tail := &DataNode[KeyT, ValueT]{}
-	head.SetNext(tail)
-	tail.SetPrev(head)
-	return &pkg.DLList[KeyT, ValueT]{Head: head, Tail: tail}
-}
-
-// NewFreqNode создает новый узел частоты с заданным значением.
-func NewFreqNode[KeyT comparable, ValueT any]() *FreqNode[KeyT, ValueT] {
-	return &FreqNode[KeyT, ValueT]{
-		Freq: 0,
-		List: NewDLList[KeyT, ValueT](),
-		Prev: nil,
-		Next: nil,
-	}
+// newFreqNode создает новый узел частоты с заданным значением.
+func newFreqNode[KeyT comparable, ValueT any]() *freqNode[KeyT, ValueT] {
+	return &freqNode[KeyT, ValueT]{}
 }
 
 // NewCache создает новый LFU кэш.
 func NewCache[KeyT comparable, ValueT any](capacity int) *Cache[KeyT, ValueT] {
-	head := NewFreqNode[KeyT, ValueT]()
-	head.SetPrev(head)
-	head.SetNext(head)
+	head := newFreqNode[KeyT, ValueT]()
+	head.Prev = head
+	head.Next = head
 	return &Cache[KeyT, ValueT]{
 		Capacity: capacity,
-		Hash:     make(map[KeyT]*DataNode[KeyT, ValueT]),
-		FreqHead: head,
+		hash:     make(map[KeyT]*dataNode[KeyT, ValueT]),
+		freqHead: head,
+		clock:    pkg.SystemClock,
 	}
 }
 
-// GetNewFreqNode создает новый узел частоты с заданным значением и устанавливает ссылки на предыдущий и следующий узлы.
-func GetNewFreqNode[KeyT comparable, ValueT any](value int, prev, next *FreqNode[KeyT, ValueT]) *FreqNode[KeyT, ValueT] {
-	newNode := NewFreqNode[KeyT, ValueT]()
-	newNode.Freq = value
-	newNode.SetPrev(prev)
-	newNode.SetNext(next)
-	prev.SetNext(newNode)
-	next.SetPrev(newNode)
-	return newNode
-}
-
-// DeleteFreqNode удаляет узел из списка.
-func DeleteFreqNode[KeyT comparable, ValueT any](node *FreqNode[KeyT, ValueT]) {
-	next := node.GetNext()
-	prev := node.GetPrev()
-	node.GetPrev().SetNext(next)
-	node.GetNext().SetPrev(prev)
-}
-
-func (n *DataNode[KeyT, ValueT]) GetPrev() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Prev
-}
-
-func (n *DataNode[KeyT, ValueT]) GetNext() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Next
-}
-
-func (n *DataNode[KeyT, ValueT]) SetPrev(prev pkg.NodeInterface[KeyT, ValueT]) {
-	n.Prev = prev.(*DataNode[KeyT, ValueT])
+// NewWeightedCache создает кэш, ограниченный суммарным весом элементов, например их размером в байтах.
+// Элемент тяжелее maxWeight не сохраняется.
+func NewWeightedCache[KeyT comparable, ValueT any](maxWeight int64, weigh func(key KeyT, value ValueT) int64) *Cache[KeyT, ValueT] {
+	c := NewCache[KeyT, ValueT](math.MaxInt)
+	c.MaxWeight = maxWeight
+	c.weigh = weigh
+	return c
 }
 
-func (n *DataNode[KeyT, ValueT]) SetNext(next pkg.NodeInterface[KeyT, ValueT]) {
-	n.Next = next.(*DataNode[KeyT, ValueT])
+// getNewFreqNode создает новый узел частоты с заданным значением и устанавливает ссылки на предыдущий и следующий узлы.
+func getNewFreqNode[KeyT comparable, ValueT any](value int, prev, next *freqNode[KeyT, ValueT]) *freqNode[KeyT, ValueT] {
+	return linkFreqNode(newFreqNode[KeyT, ValueT](), value, prev, next)
 }
 
-func (n *FreqNode[KeyT, ValueT]) GetPrev() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Prev
+// deleteFreqNode удаляет узел из списка.
+func deleteFreqNode[KeyT comparable, ValueT any](node *freqNode[KeyT, ValueT]) {
+	node.Prev.Next = node.Next
+	node.Next.Prev = node.Prev
 }
 
-func (n *FreqNode[KeyT, ValueT]) GetNext() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Next
+// linkFreqNode вставляет node со значением частоты value между prev и next.
+func linkFreqNode[KeyT comparable, ValueT any](node *freqNode[KeyT, ValueT], value int, prev, next *freqNode[KeyT, ValueT]) *freqNode[KeyT, ValueT] {
+	node.Freq = value
+	node.Prev = prev
+	node.Next = next
+	prev.Next = node
+	next.Prev = node
+	return node
 }
 
-func (n *FreqNode[KeyT, ValueT]) SetPrev(prev pkg.NodeInterface[KeyT, ValueT]) {
-	n.Prev = prev.(*FreqNode[KeyT, ValueT])
+// newFreqNodeLocked вставляет узел частоты, по возможности переиспользуя ранее удаленный.
+func (c *Cache[KeyT, ValueT]) newFreqNodeLocked(value int, prev, next *freqNode[KeyT, ValueT]) *freqNode[KeyT, ValueT] {
+	node := c.free
+	if node == nil {
+		return getNewFreqNode(value, prev, next)
+	}
+	c.free = node.Next
+	return linkFreqNode(node, value, prev, next)
 }
 
-func (n *FreqNode[KeyT, ValueT]) SetNext(next pkg.NodeInterface[KeyT, ValueT]) {
-	n.Next = next.(*FreqNode[KeyT, ValueT])
+// deleteFreqNodeLocked удаляет пустой узел частоты и сохраняет его для повторного использования.
+func (c *Cache[KeyT, ValueT]) deleteFreqNodeLocked(node *freqNode[KeyT, ValueT]) {
+	deleteFreqNode(node)
+	node.Prev = nil
+	node.Next = c.free
+	c.free = node
 }
 
 // При повторном обращении к этому элементу ищется узел частоты элемента и запрашивается значение его следующего брата.
@@ -130,86 +135,238 @@ func (n *FreqNode[KeyT, ValueT]) SetNext(next pkg.NodeInterface[KeyT, ValueT]) {
 // Например, если к узлу z обращаются ещё раз (1), то он удаляется из списка частот со значением 2 и добавляется в список частот со значением 3 (2).
 // Таким образом, временная сложность доступа к элементу составляет O(1).
 // Get получает элемент из кэша и увеличивает его счетчик использования.
+// Get перестраивает списки частот, поэтому берет блокировку на запись.
 func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
-	c.Lock.RLock()
-	defer c.Lock.RUnlock()
+	start := c.stats.Start()
+	defer c.stats.GetDone(start)
+
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span := tracer.Start(pkg.OpGet, pkg.Attr{Key: pkg.AttrPolicy, Value: "lfu"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+		value, ok := c.get(key)
+		span.End(pkg.Attr{Key: pkg.AttrHit, Value: ok})
+		return value, ok
+	}
+	return c.get(key)
+}
 
-	item, ok := c.Hash[key]
+func (c *Cache[KeyT, ValueT]) get(key KeyT) (ValueT, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	item, ok := c.hash[key]
 	if ok {
-		value := item.Value
-		c.updateLocked(key, value)
-		log.Printf("Ключ %v получен, частота обращения к элементу увеличена\n", key)
+		c.updateLocked(item, item.Value)
+		item.hits++
+		c.stats.Hit()
 		return item.Value, true
 	}
+	c.stats.Miss()
 	var zeroValue ValueT
-	log.Printf("Значение по ключу %v не существует\n", key)
 	return zeroValue, false
 }
 
+// GetOrLoad возвращает значение ключа, а при промахе вызывает load и сохраняет результат
+// с временем жизни ttl. Ошибка load возвращается, и ничего не сохраняется. load вызывается
+// без блокировки кэша, поэтому одновременные промахи по одному ключу загружают его несколько раз.
+func (c *Cache[KeyT, ValueT]) GetOrLoad(key KeyT, ttl time.Duration, load func(key KeyT) (ValueT, error)) (ValueT, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+	var span pkg.Span
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span = tracer.Start(pkg.OpLoad, pkg.Attr{Key: pkg.AttrPolicy, Value: "lfu"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+	}
+	start := time.Now()
+	value, err := load(key)
+	c.stats.Loaded(time.Since(start), err)
+	if span != nil {
+		span.End(pkg.Attr{Key: pkg.AttrError, Value: err})
+	}
+	if err != nil {
+		return value, err
+	}
+	c.Put(key, value, ttl)
+	return value, nil
+}
+
 func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
-	c.Lock.Lock()
-	defer c.Lock.Unlock()
+	start := c.stats.Start()
+	defer c.stats.PutDone(start)
 
-	if _, ok := c.Hash[key]; ok {
-		c.updateLocked(key, value)
-		log.Printf("Элемент по ключю %v перезаписан\n", key)
-		return
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span := tracer.Start(pkg.OpPut, pkg.Attr{Key: pkg.AttrPolicy, Value: "lfu"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+		defer span.End()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
 	}
 
-	if len(c.Hash) >= c.Capacity {
-		log.Printf("Объем хранилища кэша переполнен\n")
-		c.evictLocked()
+	if item, ok := c.hash[key]; ok {
+		weight := c.weighLocked(key, value)
+		if c.MaxWeight > 0 && weight > c.MaxWeight {
+			c.removeLocked(item)
+			return
+		}
+		c.updateLocked(item, value)
+		c.weight += weight - item.Weight
+		item.Weight = weight
+		c.setTTLLocked(item, ttl)
+		c.shrinkLocked(item)
+		return
 	}
 
-	// Если следующая частота после частотной головы не равна 1,
-	// создаем новый узел частоты
-	freq := c.FreqHead.Next
+	c.insertLocked(key, value, ttl, 1)
+}
 
-	if freq.Freq != 1 {
-		freq = GetNewFreqNode(1, c.FreqHead, freq)
+// insertLocked добавляет новый ключ с частотой обращений freq.
+func (c *Cache[KeyT, ValueT]) insertLocked(key KeyT, value ValueT, ttl time.Duration, freq int) {
+	weight := c.weighLocked(key, value)
+	if c.MaxWeight > 0 && weight > c.MaxWeight {
+		return
+	}
+
+	if len(c.hash) >= c.Capacity {
+		c.evictLocked()
 	}
 
 	// Создаем новый элемент и вставляем его
 	// в начало двусвязного списка данной частоты,
 	// добавляем в хеш-таблицу
-	newNode := NewDataNode(value, key, freq)
-	freq.List.PushToFront(newNode)
-	c.Hash[key] = newNode
-	log.Printf("Ключ %v добавлен в хранилище\n", key)
-
-	if ttl > 0 {
-		go func() {
-			<-time.After(ttl)
-			c.Lock.Lock()
-			defer c.Lock.Unlock()
-			if _, exists := c.Hash[key]; exists {
-				parent := newNode.Parent
-				parent.List.Remove(newNode)
-				delete(c.Hash, key)
-				// Удаляем родительский узел частоты
-				// если двусвязного списка частоты пуст
-				if parent.List.Head.GetNext() == parent.List.Tail {
-					DeleteFreqNode(parent)
-				}
-				log.Printf("Срок жизни ключа %v истек, он будет удален\n", key)
+	parent := c.freqNodeLocked(freq)
+	newNode := newDataNode(value, key, parent)
+	newNode.Weight = weight
+	now := c.clock.Now().UnixNano()
+	newNode.createdAt, newNode.accessedAt = now, now
+	parent.list.PushToFront(newNode)
+	c.hash[key] = newNode
+	c.weight += weight
+	c.setTTLLocked(newNode, ttl)
+	c.shrinkLocked(newNode)
+}
+
+// weighLocked возвращает вес элемента. Без функции веса каждый элемент весит 1.
+func (c *Cache[KeyT, ValueT]) weighLocked(key KeyT, value ValueT) int64 {
+	if c.weigh == nil {
+		return 1
+	}
+	return c.weigh(key, value)
+}
+
+// shrinkLocked вытесняет наименее часто используемые элементы, кроме keep,
+// пока суммарный вес превышает MaxWeight.
+func (c *Cache[KeyT, ValueT]) shrinkLocked(keep *dataNode[KeyT, ValueT]) {
+	for c.MaxWeight > 0 && c.weight > c.MaxWeight && len(c.hash) > 1 {
+		minFreqNode := c.freqHead.Next
+		victim := minFreqNode.list.Back()
+		if victim == keep {
+			victim = minFreqNode.list.Prev(victim)
+			if victim == nil {
+				victim = minFreqNode.Next.list.Back()
 			}
-		}()
+		}
+		c.evictItemLocked(victim)
 	}
 }
 
-// updateLocked обновляет частоту использования элемента
-func (c *Cache[KeyT, ValueT]) updateLocked(key KeyT, value ValueT) {
-	item, _ := c.Hash[key]
+// setTTLLocked устанавливает время жизни элемента. Нулевой ttl снимает ограничение.
+func (c *Cache[KeyT, ValueT]) setTTLLocked(item *dataNode[KeyT, ValueT], ttl time.Duration) {
+	stopTimer(item)
+	if ttl <= 0 {
+		item.ExpiresAt = time.Time{}
+		return
+	}
+	item.ExpiresAt = c.clock.Now().Add(ttl)
+	item.timer = c.clock.AfterFunc(ttl, func() { c.expire(item) })
+}
 
+// stopTimer останавливает таймер истечения удаляемого или продлеваемого элемента,
+// чтобы часы не удерживали его до срока.
+func stopTimer[KeyT comparable, ValueT any](item *dataNode[KeyT, ValueT]) {
+	if item.timer != nil {
+		item.timer.Stop()
+		item.timer = nil
+	}
+}
+
+// expire удаляет элемент по истечении срока жизни.
+func (c *Cache[KeyT, ValueT]) expire(item *dataNode[KeyT, ValueT]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	// Ключ мог быть вытеснен и добавлен заново другим узлом,
+	// а срок жизни - продлен или снят
+	if c.hash[item.Key] != item || item.ExpiresAt.IsZero() || c.clock.Now().Before(item.ExpiresAt) {
+		return
+	}
+	c.removeLocked(item)
+	c.notifyEvictLocked(item, pkg.EvictExpired)
+}
+
+// freqNodeLocked возвращает узел частоты freq, создавая его при необходимости.
+func (c *Cache[KeyT, ValueT]) freqNodeLocked(freq int) *freqNode[KeyT, ValueT] {
+	if freq <= 1 {
+		// Если следующая частота после частотной головы не равна 1,
+		// создаем новый узел частоты
+		next := c.freqHead.Next
+		if next.Freq != 1 {
+			next = c.newFreqNodeLocked(1, c.freqHead, next)
+		}
+		return next
+	}
+
+	// Большие частоты встречаются при восстановлении снимка в порядке возрастания,
+	// поэтому место ищется с конца списка частот
+	prev := c.freqHead.Prev
+	for prev != c.freqHead && prev.Freq > freq {
+		prev = prev.Prev
+	}
+	if prev != c.freqHead && prev.Freq == freq {
+		return prev
+	}
+	return c.newFreqNodeLocked(freq, prev, prev.Next)
+}
+
+// removeLocked удаляет элемент из кэша
+func (c *Cache[KeyT, ValueT]) removeLocked(item *dataNode[KeyT, ValueT]) {
+	parent := item.Parent
+	parent.list.Remove(item)
+	delete(c.hash, item.Key)
+	c.weight -= item.Weight
+	stopTimer(item)
+	// Удаляем родительский узел частоты
+	// если двусвязного списка частоты пуст
+	if parent.list.Len() == 0 {
+		c.deleteFreqNodeLocked(parent)
+	}
+}
+
+// updateLocked обновляет частоту использования элемента
+func (c *Cache[KeyT, ValueT]) updateLocked(item *dataNode[KeyT, ValueT], value ValueT) {
 	item.Value = value
+	item.accessedAt = c.clock.Now().UnixNano()
 
-	// Если следующий узел частоты не существует
-	// или его частота не на 1 больше, создаем новый узел
 	freqParent := item.Parent
 	nextFreq := freqParent.Next
 
-	if nextFreq == c.FreqHead || nextFreq.Freq != freqParent.Freq+1 {
-		nextFreq = GetNewFreqNode(freqParent.Freq+1, freqParent, nextFreq)
+	// Если элемент единственный в своем узле частоты и следующей частоты не существует,
+	// достаточно увеличить частоту узла на месте
+	if freqParent.list.Len() == 1 && (nextFreq == c.freqHead || nextFreq.Freq != freqParent.Freq+1) {
+		freqParent.Freq++
+		return
+	}
+
+	// Если следующий узел частоты не существует
+	// или его частота не на 1 больше, создаем новый узел
+	if nextFreq == c.freqHead || nextFreq.Freq != freqParent.Freq+1 {
+		nextFreq = c.newFreqNodeLocked(freqParent.Freq+1, freqParent, nextFreq)
 	}
 
 	// Обновляем ссылку на родительский узел частоты
@@ -218,36 +375,339 @@ func (c *Cache[KeyT, ValueT]) updateLocked(key KeyT, value ValueT) {
 	// Удаляем элемент из двусвязного списка прошлой частоты
 	// Вставляем элемент, полученный по ключю,
 	// в начало двусвязного списка данной частоты
-	freqParent.List.Remove(item)
-	nextFreq.List.PushToFront(item)
+	freqParent.list.Remove(item)
+	nextFreq.list.PushToFront(item)
 
 	// Удаляем родительский узел частоты
 	// если двусвязного списка частоты пуст
-	if freqParent.List.Head.GetNext() == freqParent.List.Tail {
-		DeleteFreqNode(freqParent)
+	if freqParent.list.Len() == 0 {
+		c.deleteFreqNodeLocked(freqParent)
 	}
 }
 
 // Наименее часто использовавшиеся (Least Frequently Used — LFU):
 // убирает запись, которая использовалась наименее часто
 func (c *Cache[KeyT, ValueT]) evictLocked() {
-	minFreqNode := c.FreqHead.Next
-	if minFreqNode == c.FreqHead {
+	minFreqNode := c.freqHead.Next
+	if minFreqNode == c.freqHead {
 		panic("No item to evict")
 	}
 
-	back := minFreqNode.List.Back()
+	back := minFreqNode.list.Back()
 
 	if back != nil {
-		minFreqNode.List.Remove(back)
-		key := back.(*DataNode[KeyT, ValueT]).Key
-		delete(c.Hash, key)
-
-		// Удаляем родительский узел частоты
-		// если двусвязного списка частоты пуст
-		if minFreqNode.List.Head.GetNext() == minFreqNode.List.Tail {
-			DeleteFreqNode(minFreqNode)
+		c.evictItemLocked(back)
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) evictItemLocked(item *dataNode[KeyT, ValueT]) {
+	c.removeLocked(item)
+	c.notifyEvictLocked(item, pkg.EvictCapacity)
+}
+
+// All возвращает итератор по парам ключ-значение в произвольном порядке. Обход слабо
+// согласован: ключи копируются при начале обхода, а значение каждого читается в момент
+// выдачи, поэтому ключи, удаленные до своей очереди, пропускаются, а добавленные после
+// начала обхода не выдаются. Обход не меняет порядок использования, тело цикла может
+// обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) All() iter.Seq2[KeyT, ValueT] {
+	return func(yield func(KeyT, ValueT) bool) {
+		c.mu.RLock()
+		keys := make([]KeyT, 0, len(c.hash))
+		for key := range c.hash {
+			keys = append(keys, key)
 		}
-		log.Printf("Элемент по ключу %v вытеснен\n", key)
+		c.mu.RUnlock()
+
+		for _, key := range keys {
+			c.mu.RLock()
+			item, ok := c.hash[key]
+			var value ValueT
+			if ok {
+				value = item.Value
+			}
+			c.mu.RUnlock()
+
+			if ok && !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys возвращает итератор по ключам с семантикой All.
+func (c *Cache[KeyT, ValueT]) Keys() iter.Seq[KeyT] {
+	return func(yield func(KeyT) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values возвращает итератор по значениям с семантикой All.
+func (c *Cache[KeyT, ValueT]) Values() iter.Seq[ValueT] {
+	return func(yield func(ValueT) bool) {
+		for _, value := range c.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// ByFrequency возвращает итератор по парам ключ-значение в порядке возрастания частоты
+// обращений по цепочке freqNode, внутри одной частоты - в порядке вытеснения. Порядок имеет
+// смысл только на один момент, поэтому обход идет по снимку, сделанному под блокировкой
+// при начале обхода: изменения во время обхода не видны.
+func (c *Cache[KeyT, ValueT]) ByFrequency() iter.Seq2[KeyT, ValueT] {
+	return func(yield func(KeyT, ValueT) bool) {
+		c.mu.RLock()
+		pairs := make([]pair[KeyT, ValueT], 0, len(c.hash))
+		for freq := c.freqHead.Next; freq != c.freqHead; freq = freq.Next {
+			for item := freq.list.Back(); item != nil; item = freq.list.Prev(item) {
+				pairs = append(pairs, pair[KeyT, ValueT]{item.Key, item.Value})
+			}
+		}
+		c.mu.RUnlock()
+
+		for _, p := range pairs {
+			if !yield(p.key, p.value) {
+				return
+			}
+		}
+	}
+}
+
+// pair - ключ и значение в снимке для обхода.
+type pair[KeyT comparable, ValueT any] struct {
+	key   KeyT
+	value ValueT
+}
+
+// GetEntry возвращает элемент с метаданными, не меняя частоту обращений.
+func (c *Cache[KeyT, ValueT]) GetEntry(key KeyT) (pkg.Entry[KeyT, ValueT], bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.hash[key]
+	if !ok {
+		return pkg.Entry[KeyT, ValueT]{}, false
+	}
+	return item.entry(), true
+}
+
+// Entries возвращает итератор по элементам с метаданными в порядке возрастания частоты,
+// внутри одной частоты - от давно использованных к недавно использованным, то есть
+// в порядке вытеснения. Элементы копируются под блокировкой при начале обхода,
+// поэтому тело цикла может обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) Entries() iter.Seq[pkg.Entry[KeyT, ValueT]] {
+	return func(yield func(pkg.Entry[KeyT, ValueT]) bool) {
+		c.mu.RLock()
+		entries := make([]pkg.Entry[KeyT, ValueT], 0, len(c.hash))
+		for freq := c.freqHead.Next; freq != c.freqHead; freq = freq.Next {
+			for item := freq.list.Back(); item != nil; item = freq.list.Prev(item) {
+				entries = append(entries, item.entry())
+			}
+		}
+		c.mu.RUnlock()
+
+		for _, e := range entries {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+func (item *dataNode[KeyT, ValueT]) entry() pkg.Entry[KeyT, ValueT] {
+	return pkg.Entry[KeyT, ValueT]{
+		Key:        item.Key,
+		Value:      item.Value,
+		CreatedAt:  time.Unix(0, item.createdAt),
+		LastAccess: time.Unix(0, item.accessedAt),
+		ExpiresAt:  item.ExpiresAt,
+		Hits:       item.hits,
+		Frequency:  item.Parent.Freq,
+		Weight:     item.Weight,
+	}
+}
+
+// Delete удаляет ключ из кэша. Возвращает false, если ключа не было.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	item, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.removeLocked(item)
+	return true
+}
+
+// Contains сообщает, есть ли ключ в кэше, не меняя частоту использования.
+func (c *Cache[KeyT, ValueT]) Contains(key KeyT) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.hash[key]
+	return ok
+}
+
+// TTL возвращает оставшееся время жизни ключа, 0 - если оно не ограничено.
+// Второе значение false, если ключа нет.
+func (c *Cache[KeyT, ValueT]) TTL(key KeyT) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	item, ok := c.hash[key]
+	if !ok {
+		return 0, false
+	}
+	if item.ExpiresAt.IsZero() {
+		return 0, true
+	}
+	return max(item.ExpiresAt.Sub(c.clock.Now()), time.Nanosecond), true
+}
+
+// Expire устанавливает новое время жизни ключа. Нулевой ttl снимает ограничение.
+// Возвращает false, если ключа нет.
+func (c *Cache[KeyT, ValueT]) Expire(key KeyT, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	item, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.setTTLLocked(item, ttl)
+	return true
+}
+
+// Len возвращает количество элементов в кэше.
+func (c *Cache[KeyT, ValueT]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.hash)
+}
+
+// Weight возвращает суммарный вес элементов. Без функции веса он равен числу элементов.
+func (c *Cache[KeyT, ValueT]) Weight() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.weight
+}
+
+// Clear удаляет все элементы без вызова обработчиков вытеснения.
+func (c *Cache[KeyT, ValueT]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	for _, item := range c.hash {
+		c.removeLocked(item)
+	}
+}
+
+// Stats возвращает счетчики обращений, вытеснений и загрузок, длительность операций,
+// размер и вес кэша.
+func (c *Cache[KeyT, ValueT]) Stats() pkg.Stats {
+	st := c.stats.Stats()
+	c.mu.RLock()
+	st.Len = len(c.hash)
+	st.Weight = c.weight
+	c.mu.RUnlock()
+	return st
+}
+
+// Dump возвращает отладочный снимок: емкость, n самых частых ключей
+// и распределение ключей по частотам.
+func (c *Cache[KeyT, ValueT]) Dump(n int) pkg.Dump {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d := pkg.Dump{MaxWeight: c.MaxWeight}
+	if c.MaxWeight == 0 {
+		d.Capacity = c.Capacity
+	}
+	for freq := c.freqHead.Next; freq != c.freqHead; freq = freq.Next {
+		d.FreqBuckets = pkg.AddFreq(d.FreqBuckets, freq.Freq, freq.list.Len())
+	}
+	for freq := c.freqHead.Prev; freq != c.freqHead && len(d.Hottest) < n; freq = freq.Prev {
+		for item := freq.list.Front(); item != nil && len(d.Hottest) < n; item = freq.list.Next(item) {
+			d.Hottest = append(d.Hottest, pkg.KeyFreq{Key: fmt.Sprint(item.Key), Freq: freq.Freq})
+		}
+	}
+	return d
+}
+
+// SetLatencySampling задает выборочную запись длительности Get и Put в Stats:
+// одна операция из every, по умолчанию pkg.DefaultLatencySampling. 1 - каждая операция,
+// 0 - запись отключена.
+func (c *Cache[KeyT, ValueT]) SetLatencySampling(every int) {
+	c.stats.SetSampling(every)
+}
+
+// SetTracer устанавливает Tracer, получающий span'ы Get, Put, загрузок GetOrLoad
+// и вытеснений. nil отключает трассировку.
+func (c *Cache[KeyT, ValueT]) SetTracer(tracer pkg.Tracer) {
+	c.trace.Set(tracer)
+}
+
+// SetClock задает часы, по которым отсчитываются сроки жизни и время обращений,
+// по умолчанию pkg.SystemClock. nil возвращает системные часы. Уже запланированные
+// истечения остаются на прежних часах, поэтому часы задаются до добавления элементов.
+func (c *Cache[KeyT, ValueT]) SetClock(clock pkg.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if clock == nil {
+		clock = pkg.SystemClock
+	}
+	c.clock = clock
+}
+
+// Clock возвращает часы кэша, заданные SetClock.
+func (c *Cache[KeyT, ValueT]) Clock() pkg.Clock {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.clock
+}
+
+// OnEvict добавляет обработчик, который вызывается, когда кэш сам удаляет элемент:
+// при вытеснении или по истечении срока жизни. Обработчик вызывается под блокировкой
+// кэша и не должен обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) OnEvict(fn func(e pkg.Eviction[KeyT, ValueT])) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = append(c.onEvict, fn)
+}
+
+func (c *Cache[KeyT, ValueT]) notifyEvictLocked(item *dataNode[KeyT, ValueT], reason pkg.EvictReason) {
+	c.stats.Evicted(reason)
+	if tracer := c.trace.Tracer(); tracer != nil {
+		tracer.Start(pkg.OpEvict, pkg.Attr{Key: pkg.AttrPolicy, Value: "lfu"}, pkg.Attr{Key: pkg.AttrKey, Value: item.Key},
+			pkg.Attr{Key: pkg.AttrReason, Value: reason.String()}).End()
+	}
+	if len(c.onEvict) == 0 {
+		return
+	}
+	e := pkg.Eviction[KeyT, ValueT]{Key: item.Key, Value: item.Value, ExpiresAt: item.ExpiresAt, Reason: reason}
+	for _, fn := range c.onEvict {
+		fn(e)
 	}
 }
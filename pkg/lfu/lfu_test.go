@@ -1,9 +1,14 @@
 package lfu
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
 )
 
 func TestCachePutAndGet(t *testing.T) {
@@ -140,42 +145,49 @@ func TestCacheEviction(t *testing.T) {
 
 }
 
-// func TestCacheTTLExpiration(t *testing.T) {
-// 	const cacheCapacity = 2
-// 	const ttl = time.Millisecond * 100
-
-// 	cache := NewCache[int, string](cacheCapacity)
-
-// 	cache.Put(1, "value1", ttl)
-// 	// Подождем, чтобы считываемое значение истекло
-// 	time.Sleep(ttl + time.Millisecond*10)
+func TestCacheTTLExpiration(t *testing.T) {
+	const cacheCapacity = 2
+	const ttl = time.Millisecond * 100
 
-// 	if _, found := cache.Get(1); found {
-// 		t.Errorf("Expected to not find key 1 after TTL expiration")
-// 	}
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache[int, string](cacheCapacity)
+	cache.SetClock(clock)
 
-// }
+	cache.Put(1, "value1", ttl)
+	clock.Advance(ttl - time.Millisecond)
+	if _, found := cache.Get(1); !found {
+		t.Errorf("Expected to find key 1 before TTL expiration")
+	}
 
-// func TestCacheCleanup(t *testing.T) {
-// 	const cacheCapacity = 2
-// 	const ttl = time.Millisecond * 100
+	clock.Advance(time.Millisecond)
+	if _, found := cache.Get(1); found {
+		t.Errorf("Expected to not find key 1 after TTL expiration")
+	}
+}
 
-// 	cache := NewCache[int, string](cacheCapacity)
+// Истекшие ключи удаляются из кэша без обращения к ним
+func TestCacheCleanup(t *testing.T) {
+	const cacheCapacity = 2
+	const ttl = time.Millisecond * 100
 
-// 	cache.Put(1, "value1", ttl)
-// 	cache.Put(2, "value2", ttl)
-// 	// Подождем, чтобы ключи истекли
-// 	time.Sleep(ttl + time.Millisecond*10)
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache[int, string](cacheCapacity)
+	cache.SetClock(clock)
 
-// 	// Запускаем очистку
+	cache.Put(1, "value1", ttl)
+	cache.Put(2, "value2", ttl)
+	clock.Advance(ttl)
 
-// 	if _, found := cache.Get(1); found {
-// 		t.Errorf("Expected to not find key 1 after TTL expiration")
-// 	}
-// 	if _, found := cache.Get(2); found {
-// 		t.Errorf("Expected to not find key 2 after TTL expiration")
-// 	}
-// }
+	if cache.Len() != 0 {
+		t.Errorf("Expected expired keys to be removed, got %d", cache.Len())
+	}
+	if _, found := cache.Get(1); found {
+		t.Errorf("Expected to not find key 1 after TTL expiration")
+	}
+	if _, found := cache.Get(2); found {
+		t.Errorf("Expected to not find key 2 after TTL expiration")
+	}
+}
 
 // func TestLFUCache() {
 // 	inputCommands := []string{"put", "put", "put", "put", "put", "get", "put", "get", "get", "put", "get", "put", "put", "put", "get", "put", "get", "get", "get", "get", "put", "put", "get", "get", "get", "put", "put", "get", "put", "get", "put", "get", "get", "get", "put", "put", "put", "get", "put", "get", "get", "put", "put", "get", "put", "put", "put", "put", "get", "put", "put", "get", "put", "put", "get", "put", "put", "put", "put", "put", "get", "put", "put", "get", "put", "get", "get", "get", "put", "get", "get", "put", "put", "put", "put", "get", "put", "put", "put", "put", "get", "get", "get", "put", "put", "put", "get", "put", "put", "put", "get", "put", "put", "put", "get", "get", "get", "put", "put", "put", "put", "get", "put", "put", "put", "put", "put", "put", "put"}
@@ -212,3 +224,234 @@ func TestCacheEviction(t *testing.T) {
 // 		fmt.Printf("Actual: %v\n", actualOutput)
 // 	}
 // }
+
+// Expire и повторный Put меняют срок жизни, ключ удаляется ровно по его истечении
+func TestCacheTTL(t *testing.T) {
+	cachetest.TestTTL(t, func(capacity int) cachetest.Cache[string, string] {
+		return NewCache[string, string](capacity)
+	})
+}
+
+func TestWeightedCache(t *testing.T) {
+	cachetest.TestWeighted(t, func(maxWeight int64, weigh func(key string, value string) int64) cachetest.Cache[string, string] {
+		return NewWeightedCache(maxWeight, weigh)
+	})
+
+	// Вытесняются редко используемые элементы, пока вес не станет допустимым
+	cache := NewWeightedCache(10, func(key string, value string) int64 { return int64(len(value)) })
+	cache.Put("a", "aaaa", 0)
+	cache.Put("b", "bbbb", 0)
+	cache.Put("c", "cc", 0)
+	cache.Get("a")
+	cache.Get("c")
+	cache.Put("d", "d", 0)
+	if cache.Contains("b") || !cache.Contains("a") || cache.Weight() != 7 {
+		t.Errorf("after eviction: contains a %v, b %v, weight %d", cache.Contains("a"), cache.Contains("b"), cache.Weight())
+	}
+
+	// Недавно добавленный, но чаще используемый "d" переживает "c"
+	cache.Get("d")
+	cache.Get("d")
+	cache.Put("a", "aaaaaaaaa", 0)
+	if cache.Contains("c") || !cache.Contains("d") || cache.Weight() != 10 {
+		t.Errorf("grown value: contains c %v, d %v, weight %d", cache.Contains("c"), cache.Contains("d"), cache.Weight())
+	}
+}
+
+// Попадания в кэш не должны выделять память, в том числе при переходе на новую частоту
+func TestCacheHitAllocs(t *testing.T) {
+	cache := NewCache[int, int](3)
+	cache.Put(1, 1, 0)
+	cache.Put(2, 2, 0)
+	cache.Put(3, 3, 0)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Get(1)
+		cache.Get(2)
+		cache.Get(2)
+		cache.Put(3, 30, 0)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected 0 allocs on hits, got %v", allocs)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	cachetest.TestStats(t, func(capacity int) cachetest.Cache[string, int] {
+		return NewCache[string, int](capacity)
+	})
+}
+
+func TestCacheEntries(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache[string, int](10)
+	cache.SetClock(clock)
+	cache.Put("a", 1, 0)
+	cache.Put("b", 2, 0)
+	cache.Put("c", 3, 0)
+	clock.Advance(time.Second)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Put("c", 4, 0)
+
+	e, ok := cache.GetEntry("a")
+	if !ok || e.Hits != 2 || e.Frequency != 3 || !e.CreatedAt.Equal(cachetest.Start) ||
+		!e.LastAccess.Equal(cachetest.Start.Add(time.Second)) {
+		t.Errorf("entry a %+v", e)
+	}
+	// Put увеличивает частоту, но не число попаданий
+	if c, _ := cache.GetEntry("c"); c.Hits != 0 || c.Frequency != 2 || c.Value != 4 {
+		t.Errorf("entry c %+v", c)
+	}
+
+	// Порядок вытеснения, GetEntry частоту не меняет
+	var got []string
+	for e := range cache.Entries() {
+		got = append(got, fmt.Sprintf("%s:%d", e.Key, e.Frequency))
+	}
+	if fmt.Sprint(got) != "[b:1 c:2 a:3]" {
+		t.Errorf("entries %v", got)
+	}
+	if _, ok := cache.GetEntry("missing"); ok {
+		t.Error("missing key has an entry")
+	}
+}
+
+func TestCacheIterators(t *testing.T) {
+	cache := NewCache[string, int](10)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		cache.Put(key, i, 0)
+	}
+	cache.Get("b")
+	cache.Get("b")
+	cache.Get("c")
+
+	var ordered []string
+	for key, value := range cache.ByFrequency() {
+		ordered = append(ordered, fmt.Sprintf("%s=%d", key, value))
+	}
+	if fmt.Sprint(ordered) != "[a=0 d=3 c=2 b=1]" {
+		t.Errorf("ByFrequency %v", ordered)
+	}
+
+	keys := slices.Sorted(cache.Keys())
+	values := slices.Sorted(cache.Values())
+	if fmt.Sprint(keys) != "[a b c d]" || fmt.Sprint(values) != "[0 1 2 3]" {
+		t.Errorf("Keys %v, Values %v", keys, values)
+	}
+
+	// All слабо согласован: удаленные до своей очереди ключи пропускаются,
+	// добавленные во время обхода не выдаются, значения читаются в момент выдачи
+	seen := map[string]int{}
+	var deleted, updated string
+	for key, value := range cache.All() {
+		if len(seen) == 0 {
+			var rest []string
+			for _, other := range []string{"a", "b", "c", "d"} {
+				if other != key {
+					rest = append(rest, other)
+				}
+			}
+			deleted, updated = rest[0], rest[1]
+			cache.Delete(deleted)
+			cache.Put(updated, 100, 0)
+			cache.Put("e", 4, 0)
+		}
+		seen[key] = value
+	}
+	if _, ok := seen[deleted]; ok || len(seen) != 3 || seen[updated] != 100 {
+		t.Errorf("All saw %v, deleted %s, updated %s", seen, deleted, updated)
+	}
+
+	// Упорядоченный обход идет по снимку: изменения во время обхода не видны
+	n := 0
+	for range cache.ByFrequency() {
+		if n == 0 {
+			cache.Clear()
+		}
+		n++
+	}
+	if n != 4 {
+		t.Errorf("ByFrequency snapshot yielded %d", n)
+	}
+}
+
+func BenchmarkCacheGetHit(b *testing.B) {
+	const size = 1024
+	cache := NewCache[int, int](size)
+	for i := 0; i < size; i++ {
+		cache.Put(i, i, 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(i % size)
+	}
+}
+
+func BenchmarkCachePutHit(b *testing.B) {
+	const size = 1024
+	cache := NewCache[int, int](size)
+	for i := 0; i < size; i++ {
+		cache.Put(i, i, 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Put(i%size, i, 0)
+	}
+}
+
+func TestCompat(t *testing.T) {
+	cache := NewCache[string, int](2)
+	cache.Put("a", 1, 0)
+	cache.Put("b", 2, 0)
+	cache.Get("a")
+
+	if e, found := cache.Hash()["a"]; !found || e.Frequency != 2 {
+		t.Errorf("Hash()[a] = %+v, %v", e, found)
+	}
+	if list := cache.Frequencies(); len(list) != 2 || list[0].Key != "b" {
+		t.Errorf("Frequencies() = %+v", list)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cache := NewCache[int, int](4)
+	for i := 1; i <= 6; i++ {
+		cache.Put(i, i, 0)
+		for j := 0; j < i%3; j++ {
+			cache.Get(i)
+		}
+	}
+	cache.Delete(6)
+	if err := cache.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := cache.freqHead.Next, cache.freqHead.Next.Next
+	first.Freq, second.Freq = second.Freq, first.Freq
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("decreasing frequencies: %v", err)
+	}
+	first.Freq, second.Freq = second.Freq, first.Freq
+
+	item := first.list.Front()
+	item.Parent = second
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("wrong parent: %v", err)
+	}
+	item.Parent = first
+
+	empty := cache.newFreqNodeLocked(first.Freq+1, first, second)
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("empty frequency: %v", err)
+	}
+	cache.deleteFreqNodeLocked(empty)
+
+	if err := cache.Validate(); err != nil {
+		t.Errorf("restored cache: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package lfu
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// SaveTo пишет снимок кэша в w в порядке возрастания частоты, внутри частоты - от
+// наиболее давнего элемента к наиболее свежему. Записи сохраняют частоту обращений и оставшийся TTL.
+// Нулевые кодеки заменяются на snapshot.Gob.
+func (c *Cache[KeyT, ValueT]) SaveTo(w io.Writer, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error {
+	savedAt, records := c.snapshotRecords()
+
+	sw, err := snapshot.NewWriter[KeyT, ValueT](w, snapshot.Header{Policy: "lfu", SavedAt: savedAt}, keys, values)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := sw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// LoadFrom добавляет в кэш записи снимка с их частотами. Снимок проверяется целиком
+// до изменения кэша. Существующие ключи заменяются. Время жизни записей уменьшается на время,
+// прошедшее после сохранения, истекшие записи пропускаются. Снимок другой политики
+// отклоняется с ошибкой snapshot.ErrPolicy.
+func (c *Cache[KeyT, ValueT]) LoadFrom(r io.Reader, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error {
+	h, records, err := snapshot.Read(r, keys, values)
+	if err != nil {
+		return err
+	}
+	if h.Policy != "lfu" {
+		return fmt.Errorf("%w: %q snapshot loaded into lfu cache", snapshot.ErrPolicy, h.Policy)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	now := c.clock.Now()
+	for _, rec := range records {
+		ttl, ok := h.Remaining(rec.TTL, now)
+		if !ok {
+			continue
+		}
+		if item, ok := c.hash[rec.Key]; ok {
+			c.removeLocked(item)
+		}
+		c.insertLocked(rec.Key, rec.Value, ttl, max(rec.Freq, 1))
+	}
+	return nil
+}
+
+// snapshotRecords копирует содержимое кэша под блокировкой, чтобы запись в w ее не удерживала.
+func (c *Cache[KeyT, ValueT]) snapshotRecords() (time.Time, []snapshot.Record[KeyT, ValueT]) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+
+	records := make([]snapshot.Record[KeyT, ValueT], 0, len(c.hash))
+	for freq := c.freqHead.Next; freq != c.freqHead; freq = freq.Next {
+		for node := freq.list.Back(); node != nil; node = freq.list.Prev(node) {
+			rec := snapshot.Record[KeyT, ValueT]{Key: node.Key, Value: node.Value, Freq: freq.Freq}
+			if !node.ExpiresAt.IsZero() {
+				rec.TTL = node.ExpiresAt.Sub(now)
+				if rec.TTL <= 0 {
+					continue
+				}
+			}
+			records = append(records, rec)
+		}
+	}
+	return now, records
+}
@@ -0,0 +1,43 @@
+package lfu
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// Снимок сохраняет частоты обращений и оставшийся TTL
+func TestCacheSnapshot(t *testing.T) {
+	cache := NewCache[int, string](3)
+	cache.Put(1, "value1", 0)
+	cache.Put(2, "value2", time.Hour)
+	cache.Put(3, "value3", 0)
+	cache.Get(1)
+	cache.Get(1)
+	cache.Get(3)
+
+	var buf bytes.Buffer
+	if err := cache.SaveTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCache[int, string](3)
+	if err := restored.LoadFrom(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, freq := range map[int]int{1: 3, 2: 1, 3: 2} {
+		item, ok := restored.hash[key]
+		if !ok || item.Parent.Freq != freq {
+			t.Errorf("Expected key %d with frequency %d", key, freq)
+		}
+	}
+	if ttl := time.Until(restored.hash[2].ExpiresAt); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected key 2 to keep its TTL, got %v", ttl)
+	}
+
+	restored.Put(4, "value4", 0) // Должен удалить ключ 2 с наименьшей частотой
+	if _, found := restored.Get(2); found {
+		t.Error("Expected key 2 to be evicted")
+	}
+}
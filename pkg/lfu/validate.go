@@ -0,0 +1,82 @@
+package lfu
+
+import (
+	"fmt"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Validate проверяет внутреннюю согласованность кэша: ссылки списка частот и списков
+// элементов в обе стороны, что частоты строго возрастают и их списки не пусты, что каждый
+// элемент хеш-таблицы достижим ровно один раз и ссылается на свой узел частоты, число
+// элементов и суммарный вес. Ошибка оборачивает pkg.ErrCorrupted. Предназначен для тестов
+// и отладки: обходит весь кэш под блокировкой на чтение.
+func (c *Cache[KeyT, ValueT]) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.validateLocked()
+}
+
+func (c *Cache[KeyT, ValueT]) validateLocked() error {
+	// Узлы списков различны, а каждый из них - значение хеш-таблицы по своему ключу,
+	// поэтому при равных размерах каждый элемент хеш-таблицы встречается ровно раз
+	count := 0
+	var weight int64
+	prev := c.freqHead
+	for freq := c.freqHead.Next; freq != c.freqHead; freq = freq.Next {
+		if freq == nil {
+			return fmt.Errorf("%w: nil next link after frequency %d", pkg.ErrCorrupted, prev.Freq)
+		}
+		if freq.Prev != prev {
+			return fmt.Errorf("%w: prev link of frequency %d does not point back", pkg.ErrCorrupted, freq.Freq)
+		}
+		if freq.Freq <= prev.Freq {
+			return fmt.Errorf("%w: frequency %d follows %d", pkg.ErrCorrupted, freq.Freq, prev.Freq)
+		}
+		if freq.list.Len() == 0 {
+			return fmt.Errorf("%w: frequency %d is empty", pkg.ErrCorrupted, freq.Freq)
+		}
+		if err := freq.list.Validate(); err != nil {
+			return fmt.Errorf("frequency %d: %w", freq.Freq, err)
+		}
+		for item := freq.list.Front(); item != nil; item = freq.list.Next(item) {
+			if item.Parent != freq {
+				return fmt.Errorf("%w: item %v in frequency %d has another parent", pkg.ErrCorrupted, item.Key, freq.Freq)
+			}
+			if c.hash[item.Key] != item {
+				return fmt.Errorf("%w: item %v is not in the hash", pkg.ErrCorrupted, item.Key)
+			}
+			weight += item.Weight
+		}
+		// Цикл в обход ограничителя повторяет элементы, поэтому обход прерывается
+		if count += freq.list.Len(); count > len(c.hash) {
+			return fmt.Errorf("%w: frequency lists have more than %d items", pkg.ErrCorrupted, len(c.hash))
+		}
+		prev = freq
+	}
+	if c.freqHead.Prev != prev {
+		return fmt.Errorf("%w: head prev link does not point to the last frequency", pkg.ErrCorrupted)
+	}
+	if count != len(c.hash) {
+		return fmt.Errorf("%w: frequency lists have %d items, hash %d", pkg.ErrCorrupted, count, len(c.hash))
+	}
+	if weight != c.weight {
+		return fmt.Errorf("%w: weight %d, sum of items %d", pkg.ErrCorrupted, c.weight, weight)
+	}
+	if c.Capacity > 0 && len(c.hash) > c.Capacity {
+		return fmt.Errorf("%w: %d entries exceed capacity %d", pkg.ErrCorrupted, len(c.hash), c.Capacity)
+	}
+	if c.MaxWeight > 0 && c.weight > c.MaxWeight {
+		return fmt.Errorf("%w: weight %d exceeds %d", pkg.ErrCorrupted, c.weight, c.MaxWeight)
+	}
+	return nil
+}
+
+// checkLocked паникует при нарушении инвариантов. Вызывается после изменений
+// в сборке с тегом cachedebug (pkg.Debug).
+func (c *Cache[KeyT, ValueT]) checkLocked() {
+	if err := c.validateLocked(); err != nil {
+		panic(err)
+	}
+}
@@ -1,49 +1,167 @@
 package pkg
 
-type DLList[KeyT comparable, ValueT any] struct {
-	Head NodeInterface[KeyT, ValueT]
-	Tail NodeInterface[KeyT, ValueT]
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCorrupted возвращают методы Validate при нарушении внутренних инвариантов списка или кэша.
+var ErrCorrupted = errors.New("cache: corrupted structure")
+
+// Link хранит типизированные ссылки узла на соседей.
+// Встраивая Link в структуру узла, тип становится элементом интрузивного списка List.
+type Link[N any] struct {
+	prev *N
+	next *N
 }
 
-func (l *DLList[KeyT, ValueT]) PushToFront(node NodeInterface[KeyT, ValueT]) {
-	node.SetPrev(l.Head)
-	node.SetNext(l.Head.GetNext())
-	l.Head.GetNext().SetPrev(node)
-	l.Head.SetNext(node)
+// Links возвращает ссылки узла. Метод продвигается в тип, который встраивает Link.
+func (l *Link[N]) Links() *Link[N] {
+	return l
 }
 
-func (l *DLList[KeyT, ValueT]) Remove(node NodeInterface[KeyT, ValueT]) {
-	if node == nil {
-		return
+// Linker описывает указатель на узел, встраивающий Link.
+type Linker[N any] interface {
+	*N
+	Links() *Link[N]
+}
+
+// List - интрузивный двусвязный список с ограничителем (sentinel).
+// Ссылки хранятся в самих узлах, поэтому операции со списком не выделяют память
+// и не используют интерфейсы и приведения типов.
+// Нулевое значение List готово к использованию. Список нельзя копировать после первого использования.
+type List[N any, P Linker[N]] struct {
+	root N
+	len  int
+}
+
+// lazyInit инициализирует ограничитель при первом обращении к нулевому списку.
+func (l *List[N, P]) lazyInit() {
+	root := P(&l.root).Links()
+	if root.next == nil {
+		root.next = &l.root
+		root.prev = &l.root
+	}
+}
+
+// Len возвращает количество узлов в списке.
+func (l *List[N, P]) Len() int {
+	return l.len
+}
+
+// Front возвращает первый узел списка или nil, если список пуст.
+func (l *List[N, P]) Front() P {
+	if l.len == 0 {
+		return nil
+	}
+	return P(P(&l.root).Links().next)
+}
+
+// Back возвращает последний узел списка или nil, если список пуст.
+func (l *List[N, P]) Back() P {
+	if l.len == 0 {
+		return nil
 	}
+	return P(P(&l.root).Links().prev)
+}
 
-	if node == l.Head {
-		l.Head = node.GetNext()
+// Next возвращает узел, следующий за node, или nil, если node последний.
+func (l *List[N, P]) Next(node P) P {
+	next := node.Links().next
+	if next == nil || next == &l.root {
+		return nil
 	}
+	return P(next)
+}
 
-	if node == l.Tail {
-		l.Tail = node.GetPrev()
+// Prev возвращает узел, предшествующий node, или nil, если node первый.
+func (l *List[N, P]) Prev(node P) P {
+	prev := node.Links().prev
+	if prev == nil || prev == &l.root {
+		return nil
 	}
+	return P(prev)
+}
+
+// insertAfter вставляет node сразу после at.
+func (l *List[N, P]) insertAfter(node P, at *N) {
+	link := node.Links()
+	atLink := P(at).Links()
+	link.prev = at
+	link.next = atLink.next
+	P(atLink.next).Links().prev = (*N)(node)
+	atLink.next = (*N)(node)
+	l.len++
+}
+
+// PushToFront добавляет node в начало списка.
+func (l *List[N, P]) PushToFront(node P) {
+	l.lazyInit()
+	l.insertAfter(node, &l.root)
+}
 
-	if node.GetPrev() != nil {
-		node.GetPrev().SetNext(node.GetNext())
+// Remove удаляет node из списка. Узел, не состоящий в списке, игнорируется.
+func (l *List[N, P]) Remove(node P) {
+	if node == nil {
+		return
 	}
-	if node.GetNext() != nil {
-		node.GetNext().SetPrev(node.GetPrev())
+	link := node.Links()
+	if link.prev == nil || link.next == nil {
+		return
 	}
+	P(link.prev).Links().next = link.next
+	P(link.next).Links().prev = link.prev
+	link.prev = nil
+	link.next = nil
+	l.len--
 }
 
-func (l *DLList[KeyT, ValueT]) MoveToFront(node NodeInterface[KeyT, ValueT]) {
-	if node == nil || node.GetPrev() == nil {
+// MoveToFront перемещает node в начало списка.
+func (l *List[N, P]) MoveToFront(node P) {
+	if node == nil {
 		return
 	}
-	l.Remove(node)
-	l.PushToFront(node)
+	link := node.Links()
+	if link.prev == nil || link.prev == &l.root {
+		return
+	}
+	// Вырезаем узел и вставляем его после ограничителя без изменения длины
+	P(link.prev).Links().next = link.next
+	P(link.next).Links().prev = link.prev
+	l.len--
+	l.insertAfter(node, &l.root)
 }
 
-func (l *DLList[KeyT, ValueT]) Back() NodeInterface[KeyT, ValueT] {
-	if l.Tail.GetPrev() == l.Head {
+// Validate проверяет, что ссылки узлов согласованы в обе стороны, список замкнут
+// через ограничитель и число узлов равно Len. Обход ограничен Len+1 шагами,
+// поэтому цикл в обход ограничителя не приводит к зависанию.
+func (l *List[N, P]) Validate() error {
+	root := P(&l.root).Links()
+	if root.next == nil || root.prev == nil {
+		if l.len != 0 {
+			return fmt.Errorf("%w: uninitialized list has length %d", ErrCorrupted, l.len)
+		}
 		return nil
 	}
-	return l.Tail.GetPrev()
+	n := 0
+	prev := &l.root
+	for node := root.next; node != &l.root; node = P(node).Links().next {
+		if node == nil {
+			return fmt.Errorf("%w: nil next link after node %d", ErrCorrupted, n)
+		}
+		if P(node).Links().prev != prev {
+			return fmt.Errorf("%w: prev link of node %d does not point back", ErrCorrupted, n)
+		}
+		if n++; n > l.len {
+			return fmt.Errorf("%w: list has more than %d nodes", ErrCorrupted, l.len)
+		}
+		prev = node
+	}
+	if root.prev != prev {
+		return fmt.Errorf("%w: sentinel prev link does not point to the last node", ErrCorrupted)
+	}
+	if n != l.len {
+		return fmt.Errorf("%w: list has %d nodes, length %d", ErrCorrupted, n, l.len)
+	}
+	return nil
 }
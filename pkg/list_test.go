@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"errors"
+	"testing"
+)
+
+type testNode struct {
+	Link[testNode]
+	Value int
+}
+
+func listValues(l *List[testNode, *testNode]) []int {
+	var values []int
+	for node := l.Front(); node != nil; node = l.Next(node) {
+		values = append(values, node.Value)
+	}
+	return values
+}
+
+func TestList(t *testing.T) {
+	var l List[testNode, *testNode]
+	if l.Front() != nil || l.Back() != nil {
+		t.Fatal("Expected empty list")
+	}
+
+	nodes := []*testNode{{Value: 1}, {Value: 2}, {Value: 3}}
+	for _, node := range nodes {
+		l.PushToFront(node)
+	}
+	if got := listValues(&l); len(got) != 3 || got[0] != 3 || got[2] != 1 {
+		t.Errorf("Expected [3 2 1], got %v", got)
+	}
+
+	l.MoveToFront(nodes[0])
+	if got := listValues(&l); got[0] != 1 || got[1] != 3 || got[2] != 2 {
+		t.Errorf("Expected [1 3 2], got %v", got)
+	}
+	if back := l.Back(); back != nodes[1] {
+		t.Errorf("Expected back 2, got %v", back.Value)
+	}
+
+	l.Remove(nodes[2])
+	l.Remove(nodes[2]) // повторное удаление игнорируется
+	if got := listValues(&l); l.Len() != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("Expected [1 2], got %v (len %d)", got, l.Len())
+	}
+	if l.Prev(l.Back()) != nodes[0] || l.Prev(nodes[0]) != nil {
+		t.Error("Expected backward links to match")
+	}
+}
+
+func TestListAllocs(t *testing.T) {
+	var l List[testNode, *testNode]
+	a, b := &testNode{Value: 1}, &testNode{Value: 2}
+	l.PushToFront(a)
+	l.PushToFront(b)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		l.MoveToFront(a)
+		l.Remove(b)
+		l.PushToFront(b)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected 0 allocs, got %v", allocs)
+	}
+}
+
+func TestListValidate(t *testing.T) {
+	var l List[testNode, *testNode]
+	if err := l.Validate(); err != nil {
+		t.Fatalf("empty list: %v", err)
+	}
+	nodes := []*testNode{{Value: 1}, {Value: 2}, {Value: 3}}
+	for _, node := range nodes {
+		l.PushToFront(node)
+	}
+	if err := l.Validate(); err != nil {
+		t.Fatalf("valid list: %v", err)
+	}
+
+	nodes[1].prev = nodes[0]
+	if err := l.Validate(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("broken prev link: %v", err)
+	}
+	nodes[1].prev = nodes[2]
+
+	l.len = 2
+	if err := l.Validate(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("wrong length: %v", err)
+	}
+	l.len = 3
+
+	nodes[0].next = nodes[1] // цикл в обход ограничителя
+	if err := l.Validate(); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("cycle: %v", err)
+	}
+}
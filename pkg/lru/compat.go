@@ -0,0 +1,33 @@
+package lru
+
+import "github.com/ivansevryukov1995/cache-sev/pkg"
+
+// Поля Hash, List и Lock стали закрытыми: изменение их без блокировки нарушало
+// согласованность списка и хеш-таблицы. Методы ниже облегчают переход на новые методы
+// и будут удалены в следующей major-версии.
+
+// Hash возвращает копию элементов кэша с метаданными. Выражения cache.Hash[key]
+// переводятся на cache.Hash()[key] без других изменений.
+//
+// Deprecated: используйте GetEntry, Contains, TTL или All.
+func (c *Cache[KeyT, ValueT]) Hash() map[KeyT]pkg.Entry[KeyT, ValueT] {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make(map[KeyT]pkg.Entry[KeyT, ValueT], len(c.hash))
+	for key, node := range c.hash {
+		entries[key] = node.entry()
+	}
+	return entries
+}
+
+// List возвращает элементы кэша от недавно использованных к давно использованным.
+//
+// Deprecated: используйте Recent или Entries.
+func (c *Cache[KeyT, ValueT]) List() []pkg.Entry[KeyT, ValueT] {
+	var entries []pkg.Entry[KeyT, ValueT]
+	for e := range c.Entries() {
+		entries = append(entries, e)
+	}
+	return entries
+}
@@ -0,0 +1,186 @@
+package lru
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+)
+
+// Операции FuzzCache. Вход декодируется по два байта на операцию: код и аргумент.
+// Младшие 4 бита аргумента - ключ, следующие 2 бита - TTL Put в секундах (0 - без TTL);
+// у opAdvance младшие 3 бита - сдвиг часов в секундах.
+const (
+	opPut = iota
+	opGet
+	opDelete
+	opAdvance // продвижение часов
+	opCount
+)
+
+// model - эталонная LRU на срезе: элементы от недавно к давно использованным.
+// Операции линейные, зато очевидно верные.
+type model struct {
+	capacity int
+	now      time.Duration
+	entries  []modelEntry
+}
+
+type modelEntry struct {
+	key, value int
+	expires    time.Duration // 0 - без TTL
+}
+
+func (m *model) find(key int) int {
+	return slices.IndexFunc(m.entries, func(e modelEntry) bool { return e.key == key })
+}
+
+// touch перемещает элемент i в начало.
+func (m *model) touch(i int) {
+	e := m.entries[i]
+	m.entries = slices.Insert(slices.Delete(m.entries, i, i+1), 0, e)
+}
+
+func (m *model) get(key int) (int, bool) {
+	i := m.find(key)
+	if i < 0 {
+		return 0, false
+	}
+	m.touch(i)
+	return m.entries[0].value, true
+}
+
+// put возвращает вытесненные ключи.
+func (m *model) put(key, value int, ttl time.Duration) []int {
+	var expires time.Duration
+	if ttl > 0 {
+		expires = m.now + ttl
+	}
+	if i := m.find(key); i >= 0 {
+		m.entries[i].value = value
+		m.entries[i].expires = expires
+		m.touch(i)
+		return nil
+	}
+	var evicted []int
+	if len(m.entries) >= m.capacity {
+		evicted = append(evicted, m.entries[len(m.entries)-1].key)
+		m.entries = m.entries[:len(m.entries)-1]
+	}
+	m.entries = slices.Insert(m.entries, 0, modelEntry{key, value, expires})
+	return evicted
+}
+
+func (m *model) delete(key int) bool {
+	i := m.find(key)
+	if i < 0 {
+		return false
+	}
+	m.entries = slices.Delete(m.entries, i, i+1)
+	return true
+}
+
+// ttl возвращает оставшийся срок жизни ключа, как Cache.TTL.
+func (m *model) ttl(key int) (time.Duration, bool) {
+	i := m.find(key)
+	if i < 0 {
+		return 0, false
+	}
+	if m.entries[i].expires == 0 {
+		return 0, true
+	}
+	return m.entries[i].expires - m.now, true
+}
+
+// advance продвигает часы на d и возвращает отсортированные истекшие ключи.
+func (m *model) advance(d time.Duration) []int {
+	m.now += d
+	var expired []int
+	m.entries = slices.DeleteFunc(m.entries, func(e modelEntry) bool {
+		if e.expires != 0 && e.expires <= m.now {
+			expired = append(expired, e.key)
+			return true
+		}
+		return false
+	})
+	slices.Sort(expired)
+	return expired
+}
+
+// FuzzCache выполняет одну и ту же последовательность операций над кэшем и моделью
+// на ручных часах и после каждой операции сравнивает результаты, вытесненные и истекшие ключи, порядок
+// использования и инварианты Validate.
+func FuzzCache(f *testing.F) {
+	f.Add([]byte{2, opPut, 1, opPut, 2, opGet, 1, opPut, 3, opGet, 2, opGet, 1})
+	f.Add([]byte{0, opPut, 1, opPut, 1, opGet, 1, opDelete, 1, opGet, 1})
+	f.Add([]byte{3, opPut, 1, opPut, 2, opPut, 3, opAdvance, 5, opPut, 0x26, opPut, 0x17, opAdvance, 1, opDelete, 2, opAdvance, 2, opPut, 4, opPut, 5, opGet, 3})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		m := &model{capacity: int(data[0]%8) + 1}
+		clock := cachetest.NewClock(time.Time{})
+		cache := NewCache[int, int](m.capacity)
+		cache.SetClock(clock)
+		var evicted, expired []int
+		cache.OnEvict(func(e pkg.Eviction[int, int]) {
+			if e.Reason == pkg.EvictExpired {
+				expired = append(expired, e.Key)
+			} else {
+				evicted = append(evicted, e.Key)
+			}
+		})
+
+		for i := 1; i+1 < len(data); i += 2 {
+			op, arg, value := data[i]%opCount, data[i+1], i
+			key, ttl := int(arg%16), time.Duration(arg/16%4)*time.Second
+			evicted, expired = evicted[:0], expired[:0]
+			switch op {
+			case opPut:
+				want := m.put(key, value, ttl)
+				cache.Put(key, value, ttl)
+				if !slices.Equal(evicted, want) {
+					t.Fatalf("step %d: Put(%d) evicted %v, want %v", i/2, key, evicted, want)
+				}
+			case opGet:
+				wantValue, wantOk := m.get(key)
+				if got, ok := cache.Get(key); got != wantValue || ok != wantOk {
+					t.Fatalf("step %d: Get(%d) = %d, %v, want %d, %v", i/2, key, got, ok, wantValue, wantOk)
+				}
+				wantTTL, _ := m.ttl(key)
+				if got, ok := cache.TTL(key); got != wantTTL || ok != wantOk {
+					t.Fatalf("step %d: TTL(%d) = %v, %v, want %v, %v", i/2, key, got, ok, wantTTL, wantOk)
+				}
+			case opDelete:
+				if got, want := cache.Delete(key), m.delete(key); got != want {
+					t.Fatalf("step %d: Delete(%d) = %v, want %v", i/2, key, got, want)
+				}
+			case opAdvance:
+				d := time.Duration(arg%8) * time.Second
+				want := m.advance(d)
+				clock.Advance(d)
+				slices.Sort(expired)
+				if !slices.Equal(expired, want) {
+					t.Fatalf("step %d: Advance(%v) expired %v, want %v", i/2, d, expired, want)
+				}
+			}
+
+			if err := cache.Validate(); err != nil {
+				t.Fatalf("step %d: %v", i/2, err)
+			}
+			var got, want []int
+			for key := range cache.Recent() {
+				got = append(got, key)
+			}
+			for _, e := range m.entries {
+				want = append(want, e.key)
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("step %d: order %v, want %v", i/2, got, want)
+			}
+		}
+	})
+}
@@ -1,123 +1,560 @@
 package lru
 
 import (
+	"fmt"
+	"iter"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/ivansevryukov1995/cache-sev/pkg"
 )
 
-type DataNode[KeyT comparable, ValueT any] struct {
-	Key   KeyT
-	Value ValueT
-	Prev  *DataNode[KeyT, ValueT]
-	Next  *DataNode[KeyT, ValueT]
-}
-
-func (n *DataNode[KeyT, ValueT]) GetPrev() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Prev
-}
-
-func (n *DataNode[KeyT, ValueT]) GetNext() pkg.NodeInterface[KeyT, ValueT] {
-	return n.Next
-}
+// dataNode - элемент LRU кэша. Ссылки на соседей встроены в сам узел.
+type dataNode[KeyT comparable, ValueT any] struct {
+	pkg.Link[dataNode[KeyT, ValueT]]
+	Key       KeyT
+	Value     ValueT
+	ExpiresAt time.Time // нулевое значение - без ограничения времени жизни
+	Weight    int64
+	timer     pkg.Timer // таймер истечения, nil - без ограничения времени жизни
 
-func (n *DataNode[KeyT, ValueT]) SetPrev(prev pkg.NodeInterface[KeyT, ValueT]) {
-	n.Prev = prev.(*DataNode[KeyT, ValueT])
-}
-
-func (n *DataNode[KeyT, ValueT]) SetNext(next pkg.NodeInterface[KeyT, ValueT]) {
-	n.Next = next.(*DataNode[KeyT, ValueT])
-}
-
-func NewDLList[KeyT comparable, ValueT any]() *pkg.DLList[KeyT, ValueT] {
-	head := &DataNode[KeyT, ValueT]{}
-	tail := &DataNode[KeyT, ValueT]{}
-	head.SetNext(tail)
-	tail.SetPrev(head)
-	return &pkg.DLList[KeyT, ValueT]{Head: head, Tail: tail}
+	// Метаданные для GetEntry: время в наносекундах Unix и число попаданий
+	createdAt  int64
+	accessedAt int64
+	hits       int64
 }
 
 // Структура Cache: Описывает, что кэш использует хеш-таблицу для быстрого доступа к элементам и
 // двусвязный список для отслеживания порядка использования элементов.
 type Cache[KeyT comparable, ValueT any] struct {
-	Capacity int
-	Hash     map[KeyT]*DataNode[KeyT, ValueT]
-	List     *pkg.DLList[KeyT, ValueT]
-	Lock     sync.RWMutex
+	Capacity  int
+	MaxWeight int64 // 0 - без ограничения суммарного веса
+
+	mu      sync.RWMutex
+	hash    map[KeyT]*dataNode[KeyT, ValueT]
+	list    pkg.List[dataNode[KeyT, ValueT], *dataNode[KeyT, ValueT]]
+	weigh   func(key KeyT, value ValueT) int64
+	weight  int64
+	onEvict []func(e pkg.Eviction[KeyT, ValueT])
+	stats   pkg.Counters
+	trace   pkg.Trace
+	clock   pkg.Clock
 }
 
 func NewCache[KeyT comparable, ValueT any](capacity int) *Cache[KeyT, ValueT] {
 	return &Cache[KeyT, ValueT]{
 		Capacity: capacity,
-		Hash:     make(map[KeyT]*DataNode[KeyT, ValueT]),
-		List:     NewDLList[KeyT, ValueT](),
+		hash:     make(map[KeyT]*dataNode[KeyT, ValueT]),
+		clock:    pkg.SystemClock,
+	}
+}
+
+// NewWeightedCache создает кэш, ограниченный суммарным весом элементов, например их размером в байтах.
+// Элемент тяжелее maxWeight не сохраняется.
+func NewWeightedCache[KeyT comparable, ValueT any](maxWeight int64, weigh func(key KeyT, value ValueT) int64) *Cache[KeyT, ValueT] {
+	return &Cache[KeyT, ValueT]{
+		Capacity:  math.MaxInt,
+		MaxWeight: maxWeight,
+		hash:      make(map[KeyT]*dataNode[KeyT, ValueT]),
+		weigh:     weigh,
+		clock:     pkg.SystemClock,
 	}
 }
 
 // Get извлекает значение из кэша по заданному ключу.
 // Возвращает значение и true, если ключ найден, иначе возвращает нулевое значение и false.
+// Get перемещает узел в списке, поэтому берет блокировку на запись.
 func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
-	c.Lock.RLock()
-	defer c.Lock.RUnlock()
+	start := c.stats.Start()
+	defer c.stats.GetDone(start)
+
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span := tracer.Start(pkg.OpGet, pkg.Attr{Key: pkg.AttrPolicy, Value: "lru"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+		value, ok := c.get(key)
+		span.End(pkg.Attr{Key: pkg.AttrHit, Value: ok})
+		return value, ok
+	}
+	return c.get(key)
+}
+
+func (c *Cache[KeyT, ValueT]) get(key KeyT) (ValueT, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
 
-	node, ok := c.Hash[key]
+	node, ok := c.hash[key]
 	if ok {
-		c.List.MoveToFront(node)
+		c.list.MoveToFront(node)
+		node.accessedAt = c.clock.Now().UnixNano()
+		node.hits++
+		c.stats.Hit()
 
 		return node.Value, true
 	}
 
+	c.stats.Miss()
 	var zeroValue ValueT
 	return zeroValue, false
 }
 
+// GetOrLoad возвращает значение ключа, а при промахе вызывает load и сохраняет результат
+// с временем жизни ttl. Ошибка load возвращается, и ничего не сохраняется. load вызывается
+// без блокировки кэша, поэтому одновременные промахи по одному ключу загружают его несколько раз.
+func (c *Cache[KeyT, ValueT]) GetOrLoad(key KeyT, ttl time.Duration, load func(key KeyT) (ValueT, error)) (ValueT, error) {
+	if value, ok := c.Get(key); ok {
+		return value, nil
+	}
+	var span pkg.Span
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span = tracer.Start(pkg.OpLoad, pkg.Attr{Key: pkg.AttrPolicy, Value: "lru"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+	}
+	start := time.Now()
+	value, err := load(key)
+	c.stats.Loaded(time.Since(start), err)
+	if span != nil {
+		span.End(pkg.Attr{Key: pkg.AttrError, Value: err})
+	}
+	if err != nil {
+		return value, err
+	}
+	c.Put(key, value, ttl)
+	return value, nil
+}
+
 // Put добавляет новое значение в кэш по заданному ключу с установленным временем жизни.
-// Если ключ уже существует, обновляет значение и перемещает его на переднюю позицию.
+// Если ключ уже существует, обновляет значение и время жизни и перемещает его на переднюю позицию.
 func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
-	c.Lock.Lock()
-	defer c.Lock.Unlock()
+	start := c.stats.Start()
+	defer c.stats.PutDone(start)
+
+	if tracer := c.trace.Tracer(); tracer != nil {
+		span := tracer.Start(pkg.OpPut, pkg.Attr{Key: pkg.AttrPolicy, Value: "lru"}, pkg.Attr{Key: pkg.AttrKey, Value: key})
+		defer span.End()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
 
-	if node, ok := c.Hash[key]; ok {
+	c.putLocked(key, value, ttl)
+}
+
+func (c *Cache[KeyT, ValueT]) putLocked(key KeyT, value ValueT, ttl time.Duration) {
+	weight := c.weighLocked(key, value)
+	if c.MaxWeight > 0 && weight > c.MaxWeight {
+		if node, ok := c.hash[key]; ok {
+			c.removeLocked(node)
+		}
+		return
+	}
+
+	if node, ok := c.hash[key]; ok {
 		// Обновляем значение, перемещаем его на переднюю позицию
 		node.Value = value
-		c.List.MoveToFront(node)
+		c.weight += weight - node.Weight
+		node.Weight = weight
+		node.accessedAt = c.clock.Now().UnixNano()
+		c.list.MoveToFront(node)
+		c.setTTLLocked(node, ttl)
+		c.shrinkLocked()
 
 		return
 	}
 
-	if len(c.Hash) >= c.Capacity {
+	if len(c.hash) >= c.Capacity {
 		c.evictLocked()
 	}
 
 	// Создаем новый узел и добавляем его в кэш
-	newNode := &DataNode[KeyT, ValueT]{
-		Key:   key,
-		Value: value,
-	}
-	c.List.PushToFront(newNode)
-	c.Hash[key] = newNode
-
-	if ttl > 0 {
-		go func() {
-			<-time.After(ttl)
-			c.Lock.Lock()
-			defer c.Lock.Unlock()
-			if _, exists := c.Hash[key]; exists {
-				c.List.Remove(newNode)
-				delete(c.Hash, key)
+	now := c.clock.Now().UnixNano()
+	newNode := &dataNode[KeyT, ValueT]{
+		Key:        key,
+		Value:      value,
+		Weight:     weight,
+		createdAt:  now,
+		accessedAt: now,
+	}
+	c.list.PushToFront(newNode)
+	c.hash[key] = newNode
+	c.weight += weight
+	c.setTTLLocked(newNode, ttl)
+	c.shrinkLocked()
+}
 
-			}
-		}()
+// weighLocked возвращает вес элемента. Без функции веса каждый элемент весит 1.
+func (c *Cache[KeyT, ValueT]) weighLocked(key KeyT, value ValueT) int64 {
+	if c.weigh == nil {
+		return 1
 	}
+	return c.weigh(key, value)
+}
+
+// shrinkLocked вытесняет элементы, пока суммарный вес превышает MaxWeight.
+// Только что записанный узел находится в начале списка и вытесняется последним.
+func (c *Cache[KeyT, ValueT]) shrinkLocked() {
+	for c.MaxWeight > 0 && c.weight > c.MaxWeight && c.list.Len() > 1 {
+		c.evictLocked()
+	}
+}
+
+// removeLocked удаляет узел из списка и хеш-таблицы.
+func (c *Cache[KeyT, ValueT]) removeLocked(node *dataNode[KeyT, ValueT]) {
+	c.list.Remove(node)
+	delete(c.hash, node.Key)
+	c.weight -= node.Weight
+	stopTimer(node)
+}
+
+// setTTLLocked устанавливает время жизни узла. Нулевой ttl снимает ограничение.
+func (c *Cache[KeyT, ValueT]) setTTLLocked(node *dataNode[KeyT, ValueT], ttl time.Duration) {
+	stopTimer(node)
+	if ttl <= 0 {
+		node.ExpiresAt = time.Time{}
+		return
+	}
+	node.ExpiresAt = c.clock.Now().Add(ttl)
+	node.timer = c.clock.AfterFunc(ttl, func() { c.expire(node) })
+}
+
+// stopTimer останавливает таймер истечения удаляемого или продлеваемого узла,
+// чтобы часы не удерживали его до срока.
+func stopTimer[KeyT comparable, ValueT any](node *dataNode[KeyT, ValueT]) {
+	if node.timer != nil {
+		node.timer.Stop()
+		node.timer = nil
+	}
+}
+
+// expire удаляет узел по истечении срока жизни.
+func (c *Cache[KeyT, ValueT]) expire(node *dataNode[KeyT, ValueT]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	// Ключ мог быть вытеснен и добавлен заново другим узлом,
+	// а срок жизни - продлен или снят
+	if c.hash[node.Key] != node || node.ExpiresAt.IsZero() || c.clock.Now().Before(node.ExpiresAt) {
+		return
+	}
+	c.removeLocked(node)
+	c.notifyEvictLocked(node, pkg.EvictExpired)
 }
 
 // Наиболее давно использовавшиеся (Least Recently Used – LRU):
 // убирает запись, которая использовалась наиболее давно.
 func (c *Cache[KeyT, ValueT]) evictLocked() {
-	back := c.List.Back()
+	back := c.list.Back()
 	if back != nil {
-		c.List.Remove(back)
-		delete(c.Hash, back.(*DataNode[KeyT, ValueT]).Key)
+		c.removeLocked(back)
+		c.notifyEvictLocked(back, pkg.EvictCapacity)
+	}
+}
+
+// All возвращает итератор по парам ключ-значение в произвольном порядке. Обход слабо
+// согласован: ключи копируются при начале обхода, а значение каждого читается в момент
+// выдачи, поэтому ключи, удаленные до своей очереди, пропускаются, а добавленные после
+// начала обхода не выдаются. Обход не меняет порядок использования, тело цикла может
+// обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) All() iter.Seq2[KeyT, ValueT] {
+	return func(yield func(KeyT, ValueT) bool) {
+		c.mu.RLock()
+		keys := make([]KeyT, 0, len(c.hash))
+		for key := range c.hash {
+			keys = append(keys, key)
+		}
+		c.mu.RUnlock()
+
+		for _, key := range keys {
+			c.mu.RLock()
+			node, ok := c.hash[key]
+			var value ValueT
+			if ok {
+				value = node.Value
+			}
+			c.mu.RUnlock()
+
+			if ok && !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// Keys возвращает итератор по ключам с семантикой All.
+func (c *Cache[KeyT, ValueT]) Keys() iter.Seq[KeyT] {
+	return func(yield func(KeyT) bool) {
+		for key := range c.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// Values возвращает итератор по значениям с семантикой All.
+func (c *Cache[KeyT, ValueT]) Values() iter.Seq[ValueT] {
+	return func(yield func(ValueT) bool) {
+		for _, value := range c.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Recent возвращает итератор по парам ключ-значение от недавно использованных к давно
+// использованным. Порядок имеет смысл только на один момент, поэтому обход идет по снимку,
+// сделанному под блокировкой при начале обхода: изменения во время обхода не видны.
+func (c *Cache[KeyT, ValueT]) Recent() iter.Seq2[KeyT, ValueT] {
+	return func(yield func(KeyT, ValueT) bool) {
+		c.mu.RLock()
+		pairs := make([]pair[KeyT, ValueT], 0, c.list.Len())
+		for node := c.list.Front(); node != nil; node = c.list.Next(node) {
+			pairs = append(pairs, pair[KeyT, ValueT]{node.Key, node.Value})
+		}
+		c.mu.RUnlock()
+
+		for _, p := range pairs {
+			if !yield(p.key, p.value) {
+				return
+			}
+		}
+	}
+}
+
+// pair - ключ и значение в снимке для обхода.
+type pair[KeyT comparable, ValueT any] struct {
+	key   KeyT
+	value ValueT
+}
+
+// GetEntry возвращает элемент с метаданными, не меняя порядок использования.
+func (c *Cache[KeyT, ValueT]) GetEntry(key KeyT) (pkg.Entry[KeyT, ValueT], bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, ok := c.hash[key]
+	if !ok {
+		return pkg.Entry[KeyT, ValueT]{}, false
+	}
+	return node.entry(), true
+}
+
+// Entries возвращает итератор по элементам с метаданными от недавно использованных
+// к давно использованным. Элементы копируются под блокировкой при начале обхода,
+// поэтому тело цикла может обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) Entries() iter.Seq[pkg.Entry[KeyT, ValueT]] {
+	return func(yield func(pkg.Entry[KeyT, ValueT]) bool) {
+		c.mu.RLock()
+		entries := make([]pkg.Entry[KeyT, ValueT], 0, c.list.Len())
+		for node := c.list.Front(); node != nil; node = c.list.Next(node) {
+			entries = append(entries, node.entry())
+		}
+		c.mu.RUnlock()
+
+		for _, e := range entries {
+			if !yield(e) {
+				return
+			}
+		}
+	}
+}
+
+func (node *dataNode[KeyT, ValueT]) entry() pkg.Entry[KeyT, ValueT] {
+	return pkg.Entry[KeyT, ValueT]{
+		Key:        node.Key,
+		Value:      node.Value,
+		CreatedAt:  time.Unix(0, node.createdAt),
+		LastAccess: time.Unix(0, node.accessedAt),
+		ExpiresAt:  node.ExpiresAt,
+		Hits:       node.hits,
+		Weight:     node.Weight,
+	}
+}
+
+// Delete удаляет ключ из кэша. Возвращает false, если ключа не было.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	node, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.removeLocked(node)
+	return true
+}
+
+// Contains сообщает, есть ли ключ в кэше, не меняя порядок использования.
+func (c *Cache[KeyT, ValueT]) Contains(key KeyT) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.hash[key]
+	return ok
+}
+
+// TTL возвращает оставшееся время жизни ключа, 0 - если оно не ограничено.
+// Второе значение false, если ключа нет.
+func (c *Cache[KeyT, ValueT]) TTL(key KeyT) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	node, ok := c.hash[key]
+	if !ok {
+		return 0, false
+	}
+	if node.ExpiresAt.IsZero() {
+		return 0, true
+	}
+	return max(node.ExpiresAt.Sub(c.clock.Now()), time.Nanosecond), true
+}
+
+// Expire устанавливает новое время жизни ключа. Нулевой ttl снимает ограничение.
+// Возвращает false, если ключа нет.
+func (c *Cache[KeyT, ValueT]) Expire(key KeyT, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	node, ok := c.hash[key]
+	if !ok {
+		return false
+	}
+	c.setTTLLocked(node, ttl)
+	return true
+}
+
+// Len возвращает количество элементов в кэше.
+func (c *Cache[KeyT, ValueT]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.hash)
+}
+
+// Weight возвращает суммарный вес элементов. Без функции веса он равен числу элементов.
+func (c *Cache[KeyT, ValueT]) Weight() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.weight
+}
+
+// Clear удаляет все элементы без вызова обработчиков вытеснения.
+func (c *Cache[KeyT, ValueT]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	for _, node := range c.hash {
+		stopTimer(node)
+	}
+	c.hash = make(map[KeyT]*dataNode[KeyT, ValueT])
+	c.list = pkg.List[dataNode[KeyT, ValueT], *dataNode[KeyT, ValueT]]{}
+	c.weight = 0
+}
+
+// Stats возвращает счетчики обращений, вытеснений и загрузок, длительность операций,
+// размер и вес кэша.
+func (c *Cache[KeyT, ValueT]) Stats() pkg.Stats {
+	st := c.stats.Stats()
+	c.mu.RLock()
+	st.Len = len(c.hash)
+	st.Weight = c.weight
+	c.mu.RUnlock()
+	return st
+}
+
+// Dump возвращает отладочный снимок: емкость и по n элементов с начала и с конца списка.
+func (c *Cache[KeyT, ValueT]) Dump(n int) pkg.Dump {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	d := pkg.Dump{MaxWeight: c.MaxWeight}
+	if c.MaxWeight == 0 {
+		d.Capacity = c.Capacity
+	}
+	for node := c.list.Front(); node != nil && len(d.Head) < n; node = c.list.Next(node) {
+		d.Head = append(d.Head, fmt.Sprint(node.Key))
+	}
+	tail := max(0, min(n, c.list.Len()-len(d.Head)))
+	d.Tail = make([]string, tail)
+	for node := c.list.Back(); tail > 0; node = c.list.Prev(node) {
+		tail--
+		d.Tail[tail] = fmt.Sprint(node.Key)
+	}
+	return d
+}
+
+// SetLatencySampling задает выборочную запись длительности Get и Put в Stats:
+// одна операция из every, по умолчанию pkg.DefaultLatencySampling. 1 - каждая операция,
+// 0 - запись отключена.
+func (c *Cache[KeyT, ValueT]) SetLatencySampling(every int) {
+	c.stats.SetSampling(every)
+}
+
+// SetTracer устанавливает Tracer, получающий span'ы Get, Put, загрузок GetOrLoad
+// и вытеснений. nil отключает трассировку.
+func (c *Cache[KeyT, ValueT]) SetTracer(tracer pkg.Tracer) {
+	c.trace.Set(tracer)
+}
+
+// SetClock задает часы, по которым отсчитываются сроки жизни и время обращений,
+// по умолчанию pkg.SystemClock. nil возвращает системные часы. Уже запланированные
+// истечения остаются на прежних часах, поэтому часы задаются до добавления элементов.
+func (c *Cache[KeyT, ValueT]) SetClock(clock pkg.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if clock == nil {
+		clock = pkg.SystemClock
+	}
+	c.clock = clock
+}
+
+// Clock возвращает часы кэша, заданные SetClock.
+func (c *Cache[KeyT, ValueT]) Clock() pkg.Clock {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.clock
+}
+
+// OnEvict добавляет обработчик, который вызывается, когда кэш сам удаляет элемент:
+// при вытеснении или по истечении срока жизни. Обработчик вызывается под блокировкой
+// кэша и не должен обращаться к кэшу.
+func (c *Cache[KeyT, ValueT]) OnEvict(fn func(e pkg.Eviction[KeyT, ValueT])) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onEvict = append(c.onEvict, fn)
+}
+
+func (c *Cache[KeyT, ValueT]) notifyEvictLocked(node *dataNode[KeyT, ValueT], reason pkg.EvictReason) {
+	c.stats.Evicted(reason)
+	if tracer := c.trace.Tracer(); tracer != nil {
+		tracer.Start(pkg.OpEvict, pkg.Attr{Key: pkg.AttrPolicy, Value: "lru"}, pkg.Attr{Key: pkg.AttrKey, Value: node.Key},
+			pkg.Attr{Key: pkg.AttrReason, Value: reason.String()}).End()
+	}
+	if len(c.onEvict) == 0 {
+		return
+	}
+	e := pkg.Eviction[KeyT, ValueT]{Key: node.Key, Value: node.Value, ExpiresAt: node.ExpiresAt, Reason: reason}
+	for _, fn := range c.onEvict {
+		fn(e)
 	}
 }
@@ -1,8 +1,15 @@
 package lru
 
 import (
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
 )
 
 func TestCache(t *testing.T) {
@@ -63,3 +70,233 @@ func TestCacheOldestEviction(t *testing.T) {
 // 	}
 
 // }
+
+// Expire и повторный Put меняют срок жизни, ключ удаляется ровно по его истечении
+func TestCacheTTL(t *testing.T) {
+	cachetest.TestTTL(t, func(capacity int) cachetest.Cache[string, string] {
+		return NewCache[string, string](capacity)
+	})
+}
+
+func TestWeightedCache(t *testing.T) {
+	cachetest.TestWeighted(t, func(maxWeight int64, weigh func(key string, value string) int64) cachetest.Cache[string, string] {
+		return NewWeightedCache(maxWeight, weigh)
+	})
+
+	// Вытесняются давно не использованные элементы, пока вес не станет допустимым
+	cache := NewWeightedCache(10, func(key string, value string) int64 { return int64(len(value)) })
+	cache.Put("a", "aaaa", 0)
+	cache.Put("b", "bbbb", 0)
+	cache.Put("c", "cc", 0)
+	cache.Get("a")
+	cache.Put("d", "d", 0)
+	if cache.Contains("b") || !cache.Contains("a") || cache.Weight() != 7 {
+		t.Errorf("after eviction: contains a %v, b %v, weight %d", cache.Contains("a"), cache.Contains("b"), cache.Weight())
+	}
+
+	cache.Put("a", "aaaaaaaaa", 0)
+	if cache.Contains("c") || !cache.Contains("d") || cache.Weight() != 10 {
+		t.Errorf("grown value: contains c %v, d %v, weight %d", cache.Contains("c"), cache.Contains("d"), cache.Weight())
+	}
+}
+
+// Попадания в кэш не должны выделять память
+func TestCacheHitAllocs(t *testing.T) {
+	cache := NewCache[int, int](2)
+	cache.Put(1, 1, 0)
+	cache.Put(2, 2, 0)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.Get(1)
+		cache.Get(2)
+		cache.Put(1, 10, 0)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected 0 allocs on hits, got %v", allocs)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	cachetest.TestStats(t, func(capacity int) cachetest.Cache[string, int] {
+		return NewCache[string, int](capacity)
+	})
+}
+
+func TestCacheEntries(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache[string, int](10)
+	cache.SetClock(clock)
+	cache.Put("a", 1, 0)
+	cache.Put("b", 2, time.Hour)
+	clock.Advance(time.Second)
+	cache.Get("a")
+	cache.Get("a")
+
+	e, ok := cache.GetEntry("b")
+	if !ok || e.Value != 2 || e.Hits != 0 || e.Weight != 1 || !e.ExpiresAt.Equal(cachetest.Start.Add(time.Hour)) {
+		t.Errorf("entry b %+v", e)
+	}
+	if !e.CreatedAt.Equal(cachetest.Start) || !e.LastAccess.Equal(e.CreatedAt) {
+		t.Errorf("entry b times %v %v", e.CreatedAt, e.LastAccess)
+	}
+
+	// GetEntry не меняет порядок: "b" остается кандидатом на вытеснение
+	if got := fmt.Sprint(keysOf(cache.Entries())); got != "[a b]" {
+		t.Errorf("entries %s", got)
+	}
+	clock.Advance(time.Second)
+	cache.Put("a", 3, 0)
+	a, _ := cache.GetEntry("a")
+	if a.Hits != 2 || a.Value != 3 || !a.CreatedAt.Equal(cachetest.Start) ||
+		!a.LastAccess.Equal(cachetest.Start.Add(2*time.Second)) || a.Frequency != 0 {
+		t.Errorf("entry a %+v", a)
+	}
+	if _, ok := cache.GetEntry("c"); ok {
+		t.Error("missing key has an entry")
+	}
+
+	// Тело цикла может изменять кэш
+	for e := range cache.Entries() {
+		cache.Delete(e.Key)
+		break
+	}
+	if cache.Len() != 1 {
+		t.Errorf("len %d after delete in loop", cache.Len())
+	}
+}
+
+func keysOf[KeyT comparable, ValueT any](entries iter.Seq[pkg.Entry[KeyT, ValueT]]) []KeyT {
+	var keys []KeyT
+	for e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+func TestCacheIterators(t *testing.T) {
+	cache := NewCache[string, int](10)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		cache.Put(key, i, 0)
+	}
+	cache.Get("b")
+
+	var ordered []string
+	for key, value := range cache.Recent() {
+		ordered = append(ordered, fmt.Sprintf("%s=%d", key, value))
+	}
+	if fmt.Sprint(ordered) != "[b=1 d=3 c=2 a=0]" {
+		t.Errorf("Recent %v", ordered)
+	}
+
+	keys := slices.Sorted(cache.Keys())
+	values := slices.Sorted(cache.Values())
+	if fmt.Sprint(keys) != "[a b c d]" || fmt.Sprint(values) != "[0 1 2 3]" {
+		t.Errorf("Keys %v, Values %v", keys, values)
+	}
+
+	// All слабо согласован: удаленные до своей очереди ключи пропускаются,
+	// добавленные во время обхода не выдаются, значения читаются в момент выдачи
+	seen := map[string]int{}
+	var deleted, updated string
+	for key, value := range cache.All() {
+		if len(seen) == 0 {
+			var rest []string
+			for _, other := range []string{"a", "b", "c", "d"} {
+				if other != key {
+					rest = append(rest, other)
+				}
+			}
+			deleted, updated = rest[0], rest[1]
+			cache.Delete(deleted)
+			cache.Put(updated, 100, 0)
+			cache.Put("e", 4, 0)
+		}
+		seen[key] = value
+	}
+	if _, ok := seen[deleted]; ok || len(seen) != 3 || seen[updated] != 100 {
+		t.Errorf("All saw %v, deleted %s, updated %s", seen, deleted, updated)
+	}
+
+	// Упорядоченный обход идет по снимку: изменения во время обхода не видны
+	n := 0
+	for range cache.Recent() {
+		if n == 0 {
+			cache.Clear()
+		}
+		n++
+	}
+	if n != 4 {
+		t.Errorf("Recent snapshot yielded %d", n)
+	}
+}
+
+func BenchmarkCacheGetHit(b *testing.B) {
+	const size = 1024
+	cache := NewCache[int, int](size)
+	for i := 0; i < size; i++ {
+		cache.Put(i, i, 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(i % size)
+	}
+}
+
+func BenchmarkCachePutHit(b *testing.B) {
+	const size = 1024
+	cache := NewCache[int, int](size)
+	for i := 0; i < size; i++ {
+		cache.Put(i, i, 0)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Put(i%size, i, 0)
+	}
+}
+
+func TestCompat(t *testing.T) {
+	cache := NewCache[string, int](2)
+	cache.Put("a", 1, time.Hour)
+	cache.Put("b", 2, 0)
+
+	if e, found := cache.Hash()["a"]; !found || e.Value != 1 || e.ExpiresAt.IsZero() {
+		t.Errorf("Hash()[a] = %+v, %v", e, found)
+	}
+	if list := cache.List(); len(list) != 2 || list[0].Key != "b" {
+		t.Errorf("List() = %+v", list)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cache := NewWeightedCache[int, int](10, func(_, value int) int64 { return int64(value) })
+	for i := 1; i <= 6; i++ {
+		cache.Put(i, i%4+1, 0)
+		cache.Get(i / 2)
+	}
+	cache.Delete(5)
+	if err := cache.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.weight++
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("wrong weight: %v", err)
+	}
+	cache.weight--
+
+	front := cache.list.Front()
+	delete(cache.hash, front.Key)
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("node missing from hash: %v", err)
+	}
+	cache.hash[front.Key] = front
+
+	cache.hash[100] = &dataNode[int, int]{Key: 100}
+	if err := cache.Validate(); !errors.Is(err, pkg.ErrCorrupted) {
+		t.Errorf("unreachable hash entry: %v", err)
+	}
+}
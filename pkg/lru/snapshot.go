@@ -0,0 +1,78 @@
+package lru
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// SaveTo пишет снимок кэша в w от наиболее давно к наиболее недавно использованному элементу,
+// поэтому LoadFrom восстанавливает тот же порядок вытеснения. Записи сохраняют оставшийся TTL.
+// Нулевые кодеки заменяются на snapshot.Gob.
+func (c *Cache[KeyT, ValueT]) SaveTo(w io.Writer, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error {
+	savedAt, records := c.snapshotRecords()
+
+	sw, err := snapshot.NewWriter[KeyT, ValueT](w, snapshot.Header{Policy: "lru", SavedAt: savedAt}, keys, values)
+	if err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := sw.Write(rec); err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
+
+// LoadFrom добавляет в кэш записи снимка. Снимок проверяется целиком до изменения кэша.
+// Время жизни записей уменьшается на время, прошедшее после сохранения, истекшие записи
+// пропускаются. Снимок другой политики отклоняется с ошибкой snapshot.ErrPolicy.
+func (c *Cache[KeyT, ValueT]) LoadFrom(r io.Reader, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error {
+	h, records, err := snapshot.Read(r, keys, values)
+	if err != nil {
+		return err
+	}
+	if h.Policy != "lru" {
+		return fmt.Errorf("%w: %q snapshot loaded into lru cache", snapshot.ErrPolicy, h.Policy)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if pkg.Debug {
+		defer c.checkLocked()
+	}
+
+	now := c.clock.Now()
+	for _, rec := range records {
+		ttl, ok := h.Remaining(rec.TTL, now)
+		if !ok {
+			continue
+		}
+		c.putLocked(rec.Key, rec.Value, ttl)
+	}
+	return nil
+}
+
+// snapshotRecords копирует содержимое кэша под блокировкой, чтобы запись в w ее не удерживала.
+func (c *Cache[KeyT, ValueT]) snapshotRecords() (time.Time, []snapshot.Record[KeyT, ValueT]) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.clock.Now()
+
+	records := make([]snapshot.Record[KeyT, ValueT], 0, len(c.hash))
+	for node := c.list.Back(); node != nil; node = c.list.Prev(node) {
+		rec := snapshot.Record[KeyT, ValueT]{Key: node.Key, Value: node.Value}
+		if !node.ExpiresAt.IsZero() {
+			rec.TTL = node.ExpiresAt.Sub(now)
+			if rec.TTL <= 0 {
+				continue
+			}
+		}
+		records = append(records, rec)
+	}
+	return now, records
+}
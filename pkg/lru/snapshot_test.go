@@ -0,0 +1,106 @@
+package lru
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// Снимок сохраняет порядок вытеснения и оставшийся TTL
+func TestCacheSnapshot(t *testing.T) {
+	cache := NewCache[string, string](3)
+	cache.Put("key1", "value1", 0)
+	cache.Put("key2", "value2", time.Hour)
+	cache.Put("key3", "value3", 0)
+	cache.Get("key1") // key2 становится наиболее давно использованным
+
+	var buf bytes.Buffer
+	if err := cache.SaveTo(&buf, nil, snapshot.JSON[string]{}); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewCache[string, string](3)
+	if err := restored.LoadFrom(&buf, nil, snapshot.JSON[string]{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := time.Until(restored.hash["key2"].ExpiresAt); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected key2 to keep its TTL, got %v", ttl)
+	}
+
+	restored.Put("key4", "value4", 0) // Должен удалить key2
+	if _, found := restored.Get("key2"); found {
+		t.Error("Expected key2 to be evicted")
+	}
+	for _, key := range []string{"key1", "key3", "key4"} {
+		if _, found := restored.Get(key); !found {
+			t.Errorf("Expected to find %s", key)
+		}
+	}
+}
+
+func TestCacheLoadCorrupted(t *testing.T) {
+	cache := NewCache[string, string](2)
+	cache.Put("key1", "value1", 0)
+
+	var buf bytes.Buffer
+	if err := cache.SaveTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	data[len(data)-1] ^= 0xff
+
+	restored := NewCache[string, string](2)
+	if err := restored.LoadFrom(bytes.NewReader(data), nil, nil); err == nil {
+		t.Error("Expected checksum error")
+	}
+	if len(restored.hash) != 0 {
+		t.Error("Expected corrupted snapshot not to be loaded")
+	}
+}
+
+// Время между сохранением и загрузкой вычитается из TTL, снимок другой политики отклоняется
+func TestCacheSnapshotDowntime(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := NewCache[string, string](3)
+	cache.SetClock(clock)
+	cache.Put("short", "1", time.Minute)
+	cache.Put("long", "2", time.Hour)
+	cache.Put("forever", "3", 0)
+
+	var buf bytes.Buffer
+	if err := cache.SaveTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Minute)
+
+	restored := NewCache[string, string](3)
+	restored.SetClock(clock)
+	if err := restored.LoadFrom(bytes.NewReader(buf.Bytes()), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Contains("short") {
+		t.Error("Expected short to expire during downtime")
+	}
+	if ttl, _ := restored.TTL("long"); ttl != 30*time.Minute {
+		t.Errorf("Expected long to have 30m left, got %v", ttl)
+	}
+	if ttl, ok := restored.TTL("forever"); !ok || ttl != 0 {
+		t.Errorf("Expected forever without TTL, got %v, %v", ttl, ok)
+	}
+
+	other := lfu.NewCache[string, string](3)
+	other.Put("key", "value", 0)
+	buf.Reset()
+	if err := other.SaveTo(&buf, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.LoadFrom(&buf, nil, nil); !errors.Is(err, snapshot.ErrPolicy) {
+		t.Errorf("Expected ErrPolicy, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package lru
+
+import (
+	"fmt"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Validate проверяет внутреннюю согласованность кэша: ссылки списка в обе стороны,
+// что каждый элемент хеш-таблицы достижим по списку ровно один раз, число элементов
+// и суммарный вес. Ошибка оборачивает pkg.ErrCorrupted. Предназначен для тестов и отладки:
+// обходит весь кэш под блокировкой на чтение.
+func (c *Cache[KeyT, ValueT]) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.validateLocked()
+}
+
+func (c *Cache[KeyT, ValueT]) validateLocked() error {
+	if err := c.list.Validate(); err != nil {
+		return err
+	}
+	// Узлы списка различны, а каждый из них - значение хеш-таблицы по своему ключу,
+	// поэтому при равных размерах каждый элемент хеш-таблицы встречается в списке ровно раз
+	var weight int64
+	for node := c.list.Front(); node != nil; node = c.list.Next(node) {
+		if c.hash[node.Key] != node {
+			return fmt.Errorf("%w: list node %v is not in the hash", pkg.ErrCorrupted, node.Key)
+		}
+		weight += node.Weight
+	}
+	if c.list.Len() != len(c.hash) {
+		return fmt.Errorf("%w: list has %d nodes, hash %d", pkg.ErrCorrupted, c.list.Len(), len(c.hash))
+	}
+	if weight != c.weight {
+		return fmt.Errorf("%w: weight %d, sum of nodes %d", pkg.ErrCorrupted, c.weight, weight)
+	}
+	if c.Capacity > 0 && len(c.hash) > c.Capacity {
+		return fmt.Errorf("%w: %d entries exceed capacity %d", pkg.ErrCorrupted, len(c.hash), c.Capacity)
+	}
+	if c.MaxWeight > 0 && c.weight > c.MaxWeight {
+		return fmt.Errorf("%w: weight %d exceeds %d", pkg.ErrCorrupted, c.weight, c.MaxWeight)
+	}
+	return nil
+}
+
+// checkLocked паникует при нарушении инвариантов. Вызывается после изменений
+// в сборке с тегом cachedebug (pkg.Debug).
+func (c *Cache[KeyT, ValueT]) checkLocked() {
+	if err := c.validateLocked(); err != nil {
+		panic(err)
+	}
+}
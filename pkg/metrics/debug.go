@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Dumper реализуют кэши с отладочным снимком внутреннего состояния: lru.Cache и lfu.Cache.
+type Dumper interface {
+	Dump(n int) pkg.Dump
+}
+
+// DefaultTop - число ключей в списках снимка, если в запросе не задан параметр n.
+const DefaultTop = 10
+
+// maxTop ограничивает параметр n, чтобы страница не выводила весь кэш.
+const maxTop = 1000
+
+// CacheInfo - состояние кэша для отладочной страницы и expvar.
+type CacheInfo struct {
+	Name     string  `json:"name"`
+	Policy   string  `json:"policy"`
+	Len      int     `json:"len"`
+	Weight   int64   `json:"weight"`
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	// Latency - квантили длительности операций get, put и load
+	Latency map[string]pkg.Percentiles `json:"latency"`
+	pkg.Dump
+}
+
+// Inspect возвращает состояние всех кэшей в порядке имен. n ограничивает списки ключей
+// снимка у кэшей, реализующих Dumper.
+func (r *Registry) Inspect(n int) []CacheInfo {
+	caches := r.sorted()
+	infos := make([]CacheInfo, len(caches))
+	for i, c := range caches {
+		st := c.source.Stats()
+		info := CacheInfo{
+			Name:   c.name,
+			Policy: c.policy,
+			Len:    st.Len,
+			Weight: st.Weight,
+			Hits:   st.Hits,
+			Misses: st.Misses,
+			Latency: map[string]pkg.Percentiles{
+				"get":  st.GetLatency.Percentiles(),
+				"put":  st.PutLatency.Percentiles(),
+				"load": st.LoadLatency.Percentiles(),
+			},
+		}
+		if total := st.Hits + st.Misses; total > 0 {
+			info.HitRatio = float64(st.Hits) / float64(total)
+		}
+		if d, ok := c.source.(Dumper); ok {
+			info.Dump = d.Dump(n)
+		}
+		infos[i] = info
+	}
+	return infos
+}
+
+// Var возвращает expvar.Var с состоянием кэшей, например для expvar.Publish("caches", r.Var()).
+func (r *Registry) Var() expvar.Var {
+	return expvar.Func(func() any { return r.Inspect(DefaultTop) })
+}
+
+// DebugHandler возвращает отладочный обработчик реестра Default.
+func DebugHandler() http.Handler {
+	return Default.DebugHandler()
+}
+
+// DebugHandler возвращает обработчик страницы /debug/cache: HTML по умолчанию, JSON при
+// параметре format=json или заголовке Accept: application/json. Параметр n задает длину
+// списков ключей, по умолчанию DefaultTop.
+func (r *Registry) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := DefaultTop
+		if v := req.URL.Query().Get("n"); v != "" {
+			parsed, err := strconv.Atoi(v)
+			if err != nil || parsed < 0 {
+				http.Error(w, "invalid n", http.StatusBadRequest)
+				return
+			}
+			n = min(parsed, maxTop)
+		}
+		infos := r.Inspect(n)
+
+		if req.URL.Query().Get("format") == "json" || strings.Contains(req.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(infos)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		debugPage.Execute(w, infos)
+	})
+}
+
+var debugPage = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"percent": func(ratio float64) string { return strconv.FormatFloat(ratio*100, 'f', 1, 64) + "%" },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Caches</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Caches</h1>
+{{- if not .}}<p>No caches registered.</p>{{end}}
+{{- range .}}
+<h2>{{.Name}} ({{.Policy}})</h2>
+<table>
+<tr><th>Capacity</th><td>{{if .Capacity}}{{.Capacity}}{{else}}-{{end}}</td></tr>
+{{- if .MaxWeight}}
+<tr><th>Max weight</th><td>{{.MaxWeight}}</td></tr>
+{{- end}}
+<tr><th>Size</th><td>{{.Len}}</td></tr>
+<tr><th>Weight</th><td>{{.Weight}}</td></tr>
+<tr><th>Hits / misses</th><td>{{.Hits}} / {{.Misses}}</td></tr>
+<tr><th>Hit ratio</th><td>{{percent .HitRatio}}</td></tr>
+</table>
+<table>
+<tr><th>Operation</th><th>p50</th><th>p90</th><th>p99</th><th>p99.9</th></tr>
+{{- range $op, $p := .Latency}}
+<tr><td>{{$op}}</td><td>{{$p.P50}}</td><td>{{$p.P90}}</td><td>{{$p.P99}}</td><td>{{$p.P999}}</td></tr>
+{{- end}}
+</table>
+{{- if .Hottest}}
+<h3>Hottest keys</h3>
+<table>
+<tr><th>Key</th><th>Frequency</th></tr>
+{{- range .Hottest}}
+<tr><td>{{.Key}}</td><td>{{.Freq}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if .FreqBuckets}}
+<h3>Frequency histogram</h3>
+<table>
+<tr><th>Frequency</th><th>Keys</th></tr>
+{{- range .FreqBuckets}}
+<tr><td>{{.Min}}{{if ne .Min .Max}}–{{.Max}}{{end}}</td><td>{{.Keys}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- if or .Head .Tail}}
+<h3>Recency list</h3>
+<table>
+<tr><th>Most recently used</th><td>{{range $i, $k := .Head}}{{if $i}}, {{end}}{{$k}}{{end}}</td></tr>
+<tr><th>Least recently used</th><td>{{range $i, $k := .Tail}}{{if $i}}, {{end}}{{$k}}{{end}}</td></tr>
+</table>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
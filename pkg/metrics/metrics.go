@@ -0,0 +1,232 @@
+// Package metrics отдает счетчики зарегистрированных кэшей в текстовом формате Prometheus
+// (или OpenMetrics, если его запрашивает сборщик) без внешних зависимостей.
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// ErrDuplicate возвращает Register для уже зарегистрированного имени.
+var ErrDuplicate = errors.New("metrics: cache already registered")
+
+// Source - кэш, счетчики которого публикуются. Его реализуют lru.Cache и lfu.Cache.
+type Source interface {
+	Stats() pkg.Stats
+}
+
+// Типы содержимого ответа.
+const (
+	contentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Registry - набор кэшей, публикуемых одним обработчиком. Registry реализует http.Handler.
+type Registry struct {
+	mu     sync.RWMutex
+	caches map[string]registered
+}
+
+type registered struct {
+	name   string
+	policy string
+	source Source
+}
+
+// Default - реестр функций Register и Handler.
+var Default = NewRegistry()
+
+// NewRegistry создает пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{caches: make(map[string]registered)}
+}
+
+// Register добавляет кэш с метками name и policy в реестр Default.
+func Register(name, policy string, source Source) error {
+	return Default.Register(name, policy, source)
+}
+
+// Handler возвращает обработчик реестра Default.
+func Handler() http.Handler {
+	return Default
+}
+
+// Register добавляет кэш. Метки name и policy различают кэши в выводе, name должен быть уникален.
+func (r *Registry) Register(name, policy string, source Source) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.caches[name]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicate, name)
+	}
+	r.caches[name] = registered{name: name, policy: policy, source: source}
+	return nil
+}
+
+// Unregister удаляет кэш из реестра. Возвращает false, если его не было.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.caches[name]
+	delete(r.caches, name)
+	return ok
+}
+
+// sample - счетчики одного кэша на момент сбора.
+type sample struct {
+	labels string
+	stats  pkg.Stats
+}
+
+// sorted возвращает зарегистрированные кэши в порядке имен.
+func (r *Registry) sorted() []registered {
+	r.mu.RLock()
+	caches := make([]registered, 0, len(r.caches))
+	for _, c := range r.caches {
+		caches = append(caches, c)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(caches, func(i, j int) bool { return caches[i].name < caches[j].name })
+	return caches
+}
+
+// collect снимает счетчики всех кэшей в порядке имен.
+func (r *Registry) collect() []sample {
+	caches := r.sorted()
+	samples := make([]sample, len(caches))
+	for i, c := range caches {
+		samples[i] = sample{
+			labels: `name="` + escape(c.name) + `",policy="` + escape(c.policy) + `"`,
+			stats:  c.source.Stats(),
+		}
+	}
+	return samples
+}
+
+// ServeHTTP отвечает счетчиками всех кэшей. Формат OpenMetrics выбирается по заголовку Accept.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+	var buf bytes.Buffer
+	r.write(&buf, openMetrics)
+
+	if openMetrics {
+		w.Header().Set("Content-Type", contentTypeOpenMetrics)
+	} else {
+		w.Header().Set("Content-Type", contentTypeText)
+	}
+	w.Write(buf.Bytes())
+}
+
+// write выводит все семейства метрик. В формате OpenMetrics имя семейства счетчика
+// указывается без суффикса _total, а вывод завершается строкой # EOF.
+func (r *Registry) write(buf *bytes.Buffer, openMetrics bool) {
+	samples := r.collect()
+
+	counter := func(name, help string, value func(st *pkg.Stats) int64) {
+		family := name
+		if openMetrics {
+			family = strings.TrimSuffix(name, "_total")
+		}
+		header(buf, family, "counter", help)
+		for i := range samples {
+			fmt.Fprintf(buf, "%s{%s} %d\n", name, samples[i].labels, value(&samples[i].stats))
+		}
+	}
+	gauge := func(name, help string, value func(st *pkg.Stats) int64) {
+		header(buf, name, "gauge", help)
+		for i := range samples {
+			fmt.Fprintf(buf, "%s{%s} %d\n", name, samples[i].labels, value(&samples[i].stats))
+		}
+	}
+
+	counter("cache_hits_total", "Lookups that found the key.",
+		func(st *pkg.Stats) int64 { return st.Hits })
+	counter("cache_misses_total", "Lookups that did not find the key.",
+		func(st *pkg.Stats) int64 { return st.Misses })
+
+	family := "cache_evictions_total"
+	if openMetrics {
+		family = "cache_evictions"
+	}
+	header(buf, family, "counter", "Entries removed by the cache itself, by reason.")
+	for i := range samples {
+		for reason, n := range samples[i].stats.Evictions {
+			fmt.Fprintf(buf, "cache_evictions_total{%s,reason=%q} %d\n", samples[i].labels, pkg.EvictReason(reason).String(), n)
+		}
+	}
+
+	gauge("cache_entries", "Number of entries in the cache.",
+		func(st *pkg.Stats) int64 { return int64(st.Len) })
+	gauge("cache_weight", "Total weight of entries; equals the number of entries without a weigher.",
+		func(st *pkg.Stats) int64 { return st.Weight })
+	counter("cache_load_errors_total", "Loader calls that returned an error.",
+		func(st *pkg.Stats) int64 { return st.LoadErrors })
+
+	header(buf, "cache_load_duration_seconds", "histogram", "Duration of loader calls on cache misses.")
+	for i := range samples {
+		writeHistogram(buf, "cache_load_duration_seconds", samples[i].labels, samples[i].stats.LoadLatency.Histogram(pkg.LoadBuckets[:]))
+	}
+
+	header(buf, "cache_operation_duration_seconds", "summary", "Duration of cache operations including lock wait; Get and Put are sampled.")
+	for i := range samples {
+		st := &samples[i].stats
+		for _, op := range []struct {
+			name string
+			h    pkg.LatencySnapshot
+		}{{"get", st.GetLatency}, {"put", st.PutLatency}, {"load", st.LoadLatency}} {
+			writeSummary(buf, "cache_operation_duration_seconds", samples[i].labels+`,op="`+op.name+`"`, op.h)
+		}
+	}
+
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+}
+
+func header(buf *bytes.Buffer, family, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", family, help, family, kind)
+}
+
+// writeHistogram выводит накопительные корзины, сумму и число наблюдений.
+func writeHistogram(buf *bytes.Buffer, name, labels string, h pkg.HistogramSnapshot) {
+	var cumulative int64
+	for i, n := range h.Counts {
+		cumulative += n
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = seconds(h.Bounds[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket{%s,le=%q} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels, seconds(h.Sum))
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.Count)
+}
+
+// writeSummary выводит квантили, сумму и число наблюдений.
+func writeSummary(buf *bytes.Buffer, name, labels string, h pkg.LatencySnapshot) {
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		fmt.Fprintf(buf, "%s{%s,quantile=\"%g\"} %s\n", name, labels, q, seconds(h.Quantile(q)))
+	}
+	fmt.Fprintf(buf, "%s_sum{%s} %s\n", name, labels, seconds(h.Sum))
+	fmt.Fprintf(buf, "%s_count{%s} %d\n", name, labels, h.Count)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// escape экранирует значение метки: обратную косую черту, кавычку и перевод строки.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+func scrape(t *testing.T, r *Registry, accept string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Header().Get("Content-Type"), string(body)
+}
+
+func TestRegistryText(t *testing.T) {
+	r := NewRegistry()
+	users := lru.NewCache[string, int](1)
+	sessions := lfu.NewCache[string, int](10)
+	if err := r.Register("users", "lru", users); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("sessions", "lfu", sessions); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("users", "lfu", sessions); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("duplicate Register = %v", err)
+	}
+
+	users.SetLatencySampling(0)
+	users.Put("a", 1, 0)
+	users.Get("a")
+	users.Get("b")
+	users.Put("b", 2, 0)
+	sessions.GetOrLoad("s", 0, func(string) (int, error) {
+		time.Sleep(2 * time.Millisecond)
+		return 1, nil
+	})
+
+	contentType, body := scrape(t, r, "")
+	if !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", contentType)
+	}
+	for _, line := range []string{
+		"# TYPE cache_hits_total counter",
+		`cache_hits_total{name="users",policy="lru"} 1`,
+		`cache_misses_total{name="users",policy="lru"} 1`,
+		`cache_misses_total{name="sessions",policy="lfu"} 1`,
+		`cache_evictions_total{name="users",policy="lru",reason="capacity"} 1`,
+		`cache_evictions_total{name="users",policy="lru",reason="expired"} 0`,
+		`cache_entries{name="sessions",policy="lfu"} 1`,
+		`cache_weight{name="users",policy="lru"} 1`,
+		"# TYPE cache_load_duration_seconds histogram",
+		`cache_load_duration_seconds_bucket{name="sessions",policy="lfu",le="0.001"} 0`,
+		`cache_load_duration_seconds_bucket{name="sessions",policy="lfu",le="+Inf"} 1`,
+		`cache_load_duration_seconds_count{name="sessions",policy="lfu"} 1`,
+		"# TYPE cache_operation_duration_seconds summary",
+		`cache_operation_duration_seconds_count{name="sessions",policy="lfu",op="load"} 1`,
+		`cache_operation_duration_seconds{name="users",policy="lru",op="get",quantile="0.999"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+	if strings.Index(body, `name="sessions"`) > strings.Index(body, `name="users"`) {
+		t.Error("caches are not sorted by name")
+	}
+	if strings.Contains(body, "# EOF") {
+		t.Error("text format ends with # EOF")
+	}
+
+	r.Unregister("sessions")
+	if _, body := scrape(t, r, ""); strings.Contains(body, "sessions") {
+		t.Error("unregistered cache is still exported")
+	}
+}
+
+func TestRegistryOpenMetrics(t *testing.T) {
+	r := NewRegistry()
+	r.Register("quo\"te\\", "lru", lru.NewCache[string, int](1))
+
+	contentType, body := scrape(t, r, "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if !strings.HasPrefix(contentType, "application/openmetrics-text") {
+		t.Errorf("Content-Type %q", contentType)
+	}
+	for _, line := range []string{
+		"# TYPE cache_hits counter",
+		"# TYPE cache_evictions counter",
+		`cache_hits_total{name="quo\"te\\",policy="lru"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in\n%s", line, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Error("OpenMetrics output does not end with # EOF")
+	}
+}
+
+func TestDebugHandler(t *testing.T) {
+	r := NewRegistry()
+	recent := lru.NewCache[int, int](100)
+	for i := 1; i <= 5; i++ {
+		recent.Put(i, i, 0)
+	}
+	recent.Get(1)
+	hot := lfu.NewCache[string, int](100)
+	for _, key := range []string{"a", "b", "c", "<script>"} {
+		hot.Put(key, 0, 0)
+	}
+	for i := 0; i < 4; i++ {
+		hot.Get("b")
+	}
+	hot.Get("c")
+	r.Register("recent", "lru", recent)
+	r.Register("hot", "lfu", hot)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/cache?format=json&n=2", nil)
+	rec := httptest.NewRecorder()
+	r.DebugHandler().ServeHTTP(rec, req)
+	var infos []CacheInfo
+	if err := json.NewDecoder(rec.Body).Decode(&infos); err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Name != "hot" || infos[1].Name != "recent" {
+		t.Fatalf("infos %+v", infos)
+	}
+	lfuInfo, lruInfo := infos[0], infos[1]
+	if got := fmt.Sprint(lfuInfo.Hottest); got != "[{b 5} {c 2}]" {
+		t.Errorf("hottest %s", got)
+	}
+	if got := fmt.Sprint(lfuInfo.FreqBuckets); got != "[{1 1 2} {2 3 1} {4 7 1}]" {
+		t.Errorf("freq buckets %s", got)
+	}
+	if lfuInfo.HitRatio != 1 || lfuInfo.Capacity != 100 {
+		t.Errorf("lfu info %+v", lfuInfo)
+	}
+	if fmt.Sprint(lruInfo.Head) != "[1 5]" || fmt.Sprint(lruInfo.Tail) != "[3 2]" {
+		t.Errorf("head %v, tail %v", lruInfo.Head, lruInfo.Tail)
+	}
+
+	rec = httptest.NewRecorder()
+	r.DebugHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/cache", nil))
+	page := rec.Body.String()
+	if !strings.Contains(page, "<h2>hot (lfu)</h2>") || !strings.Contains(page, "&lt;script&gt;") {
+		t.Errorf("page\n%s", page)
+	}
+
+	var fromVar []CacheInfo
+	if err := json.Unmarshal([]byte(r.Var().String()), &fromVar); err != nil || len(fromVar) != 2 {
+		t.Errorf("expvar %s: %v", r.Var().String(), err)
+	}
+}
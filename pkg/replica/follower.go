@@ -0,0 +1,325 @@
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// Follower - ведомый узел. Подключается к ведущему, получает снимок и применяет поток операций.
+// Запись в кэш ведомого через Follower запрещена.
+type Follower[KeyT comparable, ValueT any] struct {
+	addr    string
+	backend Backend[KeyT, ValueT]
+	opts    Options[KeyT, ValueT]
+
+	// id и offset изменяются только фоновой репликацией
+	id           string
+	offset       atomic.Uint64
+	leaderOffset atomic.Uint64
+	connected    atomic.Bool
+	fullSyncs    atomic.Int64
+
+	mu       sync.Mutex
+	progress chan struct{} // закрывается при изменении смещения или состояния
+	conn     net.Conn
+	err      error
+	closed   bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Follow создает ведомый узел над backend и запускает репликацию с ведущего по адресу addr,
+// которую останавливает Close. Содержимое backend заменяется снимком ведущего.
+func Follow[KeyT comparable, ValueT any](addr string, backend Backend[KeyT, ValueT], opts Options[KeyT, ValueT]) *Follower[KeyT, ValueT] {
+	opts.setDefaults()
+	f := &Follower[KeyT, ValueT]{
+		addr:     addr,
+		backend:  backend,
+		opts:     opts,
+		progress: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	f.wg.Add(1)
+	go f.run()
+	return f
+}
+
+// Get возвращает значение из кэша ведомого.
+func (f *Follower[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	return f.backend.Get(key)
+}
+
+// Put не изменяет кэш и возвращает ErrReadOnly.
+func (f *Follower[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) error {
+	return ErrReadOnly
+}
+
+// Delete не изменяет кэш и возвращает ErrReadOnly.
+func (f *Follower[KeyT, ValueT]) Delete(key KeyT) error {
+	return ErrReadOnly
+}
+
+// Expire не изменяет кэш и возвращает ErrReadOnly.
+func (f *Follower[KeyT, ValueT]) Expire(key KeyT, ttl time.Duration) error {
+	return ErrReadOnly
+}
+
+// Offset возвращает смещение последней примененной операции.
+func (f *Follower[KeyT, ValueT]) Offset() uint64 {
+	return f.offset.Load()
+}
+
+// Lag возвращает отставание от ведущего по его последнему известному смещению.
+func (f *Follower[KeyT, ValueT]) Lag() uint64 {
+	leader, offset := f.leaderOffset.Load(), f.offset.Load()
+	return leader - min(leader, offset)
+}
+
+// Connected сообщает, получает ли ведомый поток операций.
+func (f *Follower[KeyT, ValueT]) Connected() bool {
+	return f.connected.Load()
+}
+
+// FullSyncs возвращает число полученных снимков.
+func (f *Follower[KeyT, ValueT]) FullSyncs() int64 {
+	return f.fullSyncs.Load()
+}
+
+// Err возвращает причину последнего разрыва соединения.
+func (f *Follower[KeyT, ValueT]) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// WaitOffset ждет, пока ведомый применит операции до смещения offset включительно.
+func (f *Follower[KeyT, ValueT]) WaitOffset(ctx context.Context, offset uint64) error {
+	for {
+		f.mu.Lock()
+		progress, closed := f.progress, f.closed
+		f.mu.Unlock()
+
+		if f.offset.Load() >= offset {
+			return nil
+		}
+		if closed {
+			return ErrClosed
+		}
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Close останавливает репликацию. Кэш остается доступным для чтения.
+func (f *Follower[KeyT, ValueT]) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	close(f.done)
+	if f.conn != nil {
+		f.conn.Close()
+	}
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	f.signal()
+	return nil
+}
+
+// signal будит WaitOffset.
+func (f *Follower[KeyT, ValueT]) signal() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.progress)
+	f.progress = make(chan struct{})
+}
+
+func (f *Follower[KeyT, ValueT]) run() {
+	defer f.wg.Done()
+	for {
+		err := f.sync()
+		f.connected.Store(false)
+
+		f.mu.Lock()
+		f.err = err
+		f.conn = nil
+		f.mu.Unlock()
+		f.signal()
+
+		select {
+		case <-f.done:
+			return
+		case <-time.After(f.opts.ReconnectInterval):
+		}
+	}
+}
+
+// sync выполняет один сеанс репликации до разрыва соединения.
+func (f *Follower[KeyT, ValueT]) sync() error {
+	timeout := f.opts.timeout()
+	conn, err := net.DialTimeout("tcp", f.addr, timeout)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		conn.Close()
+		return ErrClosed
+	}
+	f.conn = conn
+	f.mu.Unlock()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+	writeFrame(w, frameSync, appendPosition(nil, f.id, f.offset.Load()))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	kind, payload, err := readFrame(r)
+	if err != nil {
+		return err
+	}
+	if err := f.handshake(kind, payload); err != nil {
+		return err
+	}
+	f.connected.Store(true)
+	f.signal()
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		kind, payload, err := readFrame(r)
+		if err != nil {
+			return err
+		}
+		switch {
+		case isOp(kind):
+			o, err := decodeOp(kind, payload)
+			if err != nil {
+				return err
+			}
+			if err := f.apply(o); err != nil {
+				return err
+			}
+			offset := f.offset.Add(1)
+			if f.leaderOffset.Load() < offset {
+				f.leaderOffset.Store(offset)
+			}
+			// Следующая операция часто уже в буфере: ждущих будим после пачки
+			if r.Buffered() == 0 {
+				f.signal()
+			}
+		case kind == frameBeat:
+			leader, n := binary.Uvarint(payload)
+			if n <= 0 {
+				return errProtocol
+			}
+			f.leaderOffset.Store(leader)
+			conn.SetWriteDeadline(time.Now().Add(timeout))
+			writeFrame(w, frameAck, binary.AppendUvarint(nil, f.offset.Load()))
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unexpected frame %q", errProtocol, kind)
+		}
+	}
+}
+
+// handshake обрабатывает ответ ведущего на запрос синхронизации.
+func (f *Follower[KeyT, ValueT]) handshake(kind byte, payload []byte) error {
+	id, offset, rest, err := readPosition(payload)
+	if err != nil {
+		return err
+	}
+	switch kind {
+	case frameContinue:
+		if id != f.id || offset != f.offset.Load() {
+			return fmt.Errorf("%w: continue from %s/%d, have %s/%d", errProtocol, id, offset, f.id, f.offset.Load())
+		}
+	case frameFull:
+		// При ошибке кэш остается пустым, а следующее подключение снова запросит снимок
+		f.backend.Clear()
+		if err := f.loadSnapshot(rest); err != nil {
+			f.id = ""
+			f.offset.Store(0)
+			return err
+		}
+		f.id = id
+		f.offset.Store(offset)
+		f.fullSyncs.Add(1)
+	default:
+		return fmt.Errorf("%w: unexpected frame %q", errProtocol, kind)
+	}
+	f.leaderOffset.Store(offset)
+	return nil
+}
+
+// loadSnapshot загружает снимок ведущего. Снимок другой политики вытеснения, например
+// lfu у ведомого lru, загружается поэлементно через Put без частот обращений.
+func (f *Follower[KeyT, ValueT]) loadSnapshot(data []byte) error {
+	err := f.backend.LoadFrom(bytes.NewReader(data), f.opts.Keys, f.opts.Values)
+	if !errors.Is(err, snapshot.ErrPolicy) {
+		return err
+	}
+	h, records, err := snapshot.Read(bytes.NewReader(data), f.opts.Keys, f.opts.Values)
+	if err != nil {
+		return err
+	}
+	now := f.opts.Clock.Now()
+	for _, rec := range records {
+		if ttl, ok := h.Remaining(rec.TTL, now); ok {
+			f.backend.Put(rec.Key, rec.Value, ttl)
+		}
+	}
+	return nil
+}
+
+func (f *Follower[KeyT, ValueT]) apply(o op) error {
+	var key KeyT
+	if err := f.opts.Keys.Unmarshal(o.key, &key); err != nil {
+		return err
+	}
+	switch o.kind {
+	case opPut:
+		var value ValueT
+		if err := f.opts.Values.Unmarshal(o.value, &value); err != nil {
+			return err
+		}
+		if ttl, ok := f.opts.remaining(o.expiresAt); ok {
+			f.backend.Put(key, value, ttl)
+		} else {
+			f.backend.Delete(key)
+		}
+	case opDelete, opExpire:
+		f.backend.Delete(key)
+	case opTTL:
+		if ttl, ok := f.opts.remaining(o.expiresAt); ok {
+			f.backend.Expire(key, ttl)
+		} else {
+			f.backend.Delete(key)
+		}
+	}
+	return nil
+}
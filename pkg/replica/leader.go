@@ -0,0 +1,409 @@
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// FollowerStatus - состояние подключенного ведомого.
+type FollowerStatus struct {
+	Addr string
+	// Offset - смещение, подтвержденное ведомым.
+	Offset uint64
+	// Lag - число операций, которые ведомый еще не подтвердил.
+	Lag uint64
+}
+
+// Leader - ведущий узел. Применяет операции к кэшу и передает их ведомым.
+type Leader[KeyT comparable, ValueT any] struct {
+	backend Backend[KeyT, ValueT]
+	opts    Options[KeyT, ValueT]
+	id      string
+
+	// mu упорядочивает применение операций к кэшу и их запись в журнал
+	mu sync.Mutex
+
+	// logMu защищает журнал. Истечение записывается под блокировкой кэша без mu.
+	logMu   sync.Mutex
+	offset  uint64
+	backlog [][]byte // закодированные операции со смещениями offset-len(backlog)+1 ... offset
+	notify  chan struct{}
+	err     error
+
+	connMu    sync.Mutex
+	listeners map[net.Listener]struct{}
+	links     map[*link]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+	done      chan struct{}
+}
+
+// link - соединение с ведомым.
+type link struct {
+	conn net.Conn
+	ack  atomic.Uint64
+}
+
+// NewLeader создает ведущий узел над backend. Идентификатор репликации выбирается случайно,
+// поэтому после перезапуска ведущего ведомые заново получают снимок.
+func NewLeader[KeyT comparable, ValueT any](backend Backend[KeyT, ValueT], opts Options[KeyT, ValueT]) *Leader[KeyT, ValueT] {
+	opts.setDefaults()
+	var id [16]byte
+	rand.Read(id[:])
+
+	l := &Leader[KeyT, ValueT]{
+		backend:   backend,
+		opts:      opts,
+		id:        hex.EncodeToString(id[:]),
+		notify:    make(chan struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		links:     make(map[*link]struct{}),
+		done:      make(chan struct{}),
+	}
+	backend.OnEvict(func(e pkg.Eviction[KeyT, ValueT]) {
+		if e.Reason != pkg.EvictExpired {
+			return
+		}
+		rawKey, err := l.opts.Keys.Marshal(e.Key)
+		if err != nil {
+			l.drop(fmt.Errorf("replica: encode expired key: %w", err))
+			return
+		}
+		l.append(op{kind: opExpire, key: rawKey})
+	})
+	return l
+}
+
+// ID возвращает идентификатор репликации.
+func (l *Leader[KeyT, ValueT]) ID() string {
+	return l.id
+}
+
+// Offset возвращает смещение последней операции.
+func (l *Leader[KeyT, ValueT]) Offset() uint64 {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	return l.offset
+}
+
+// Get возвращает значение из кэша. Чтения не реплицируются.
+func (l *Leader[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	return l.backend.Get(key)
+}
+
+// Err возвращает первую ошибку кодирования истекшего ключа. После нее ведомые
+// получают новый снимок, потому что операцию истечения нельзя передать.
+func (l *Leader[KeyT, ValueT]) Err() error {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+	return l.err
+}
+
+// Put применяет операцию к кэшу и передает ее ведомым. Если ключ или значение
+// не кодируются, кэш не изменяется и возвращается ошибка.
+func (l *Leader[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) error {
+	rawKey, err := l.opts.Keys.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("replica: encode key: %w", err)
+	}
+	rawValue, err := l.opts.Values.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("replica: encode value: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Операция записывается после применения: истечение старого значения ключа,
+	// случившееся между ними, не попадет в журнал после новой записи
+	l.backend.Put(key, value, ttl)
+	l.append(op{kind: opPut, key: rawKey, value: rawValue, expiresAt: l.opts.expiresAt(ttl)})
+	return nil
+}
+
+// Delete удаляет ключ и передает удаление ведомым. Если ключ не кодируется,
+// кэш не изменяется и возвращается ошибка.
+func (l *Leader[KeyT, ValueT]) Delete(key KeyT) (bool, error) {
+	rawKey, err := l.opts.Keys.Marshal(key)
+	if err != nil {
+		return false, fmt.Errorf("replica: encode key: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	deleted := l.backend.Delete(key)
+	if deleted {
+		l.append(op{kind: opDelete, key: rawKey})
+	}
+	return deleted, nil
+}
+
+// Expire устанавливает время жизни ключа и передает его ведомым. Нулевой ttl снимает ограничение.
+// Если ключ не кодируется, кэш не изменяется и возвращается ошибка.
+func (l *Leader[KeyT, ValueT]) Expire(key KeyT, ttl time.Duration) (bool, error) {
+	rawKey, err := l.opts.Keys.Marshal(key)
+	if err != nil {
+		return false, fmt.Errorf("replica: encode key: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ok := l.backend.Expire(key, ttl)
+	if ok {
+		l.append(op{kind: opTTL, key: rawKey, expiresAt: l.opts.expiresAt(ttl)})
+	}
+	return ok, nil
+}
+
+func (l *Leader[KeyT, ValueT]) append(o op) {
+	frame := appendOp(nil, o)
+
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+
+	l.offset++
+	l.backlog = append(l.backlog, frame)
+	if len(l.backlog) > l.opts.Backlog {
+		l.backlog[0] = nil
+		l.backlog = l.backlog[1:]
+	}
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// drop запоминает ошибку и пропускает операцию, которую нельзя закодировать: журнал
+// очищается, поэтому все ведомые переподключаются и получают снимок.
+func (l *Leader[KeyT, ValueT]) drop(err error) {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+
+	if l.err == nil {
+		l.err = err
+	}
+	l.offset++
+	l.backlog = nil
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// since возвращает операции после смещения pos и канал, который закроется при появлении новых.
+// ok == false означает, что операции после pos уже вытеснены из журнала.
+func (l *Leader[KeyT, ValueT]) since(pos uint64) (frames [][]byte, next uint64, notify chan struct{}, ok bool) {
+	l.logMu.Lock()
+	defer l.logMu.Unlock()
+
+	start := l.offset - uint64(len(l.backlog))
+	if pos < start || pos > l.offset {
+		return nil, pos, nil, false
+	}
+	return l.backlog[pos-start:], l.offset, l.notify, true
+}
+
+// Followers возвращает подключенных ведомых.
+func (l *Leader[KeyT, ValueT]) Followers() []FollowerStatus {
+	offset := l.Offset()
+
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+
+	statuses := make([]FollowerStatus, 0, len(l.links))
+	for lk := range l.links {
+		ack := lk.ack.Load()
+		statuses = append(statuses, FollowerStatus{
+			Addr:   lk.conn.RemoteAddr().String(),
+			Offset: ack,
+			Lag:    offset - min(ack, offset),
+		})
+	}
+	return statuses
+}
+
+// ListenAndServe принимает ведомых по адресу addr.
+func (l *Leader[KeyT, ValueT]) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ln)
+}
+
+// Serve принимает ведомых на ln до вызова Close и тогда возвращает ErrClosed.
+func (l *Leader[KeyT, ValueT]) Serve(ln net.Listener) error {
+	l.connMu.Lock()
+	if l.closed {
+		l.connMu.Unlock()
+		ln.Close()
+		return ErrClosed
+	}
+	l.listeners[ln] = struct{}{}
+	l.connMu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			l.connMu.Lock()
+			closed := l.closed
+			delete(l.listeners, ln)
+			l.connMu.Unlock()
+			if closed {
+				return ErrClosed
+			}
+			return err
+		}
+
+		lk := &link{conn: conn}
+		l.connMu.Lock()
+		if l.closed {
+			l.connMu.Unlock()
+			conn.Close()
+			continue
+		}
+		l.links[lk] = struct{}{}
+		l.wg.Add(1)
+		l.connMu.Unlock()
+
+		go func() {
+			defer l.wg.Done()
+			l.serveLink(lk)
+
+			l.connMu.Lock()
+			delete(l.links, lk)
+			l.connMu.Unlock()
+		}()
+	}
+}
+
+// Close прекращает прием ведомых, разрывает соединения с ними и дожидается их завершения.
+// Кэш остается доступным.
+func (l *Leader[KeyT, ValueT]) Close() error {
+	l.connMu.Lock()
+	if l.closed {
+		l.connMu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	for ln := range l.listeners {
+		ln.Close()
+	}
+	for lk := range l.links {
+		lk.conn.Close()
+	}
+	l.connMu.Unlock()
+
+	l.wg.Wait()
+	return nil
+}
+
+func (l *Leader[KeyT, ValueT]) serveLink(lk *link) {
+	defer lk.conn.Close()
+	r := bufio.NewReader(lk.conn)
+	w := bufio.NewWriter(lk.conn)
+	timeout := l.opts.timeout()
+
+	lk.conn.SetReadDeadline(time.Now().Add(timeout))
+	kind, payload, err := readFrame(r)
+	if err != nil || kind != frameSync {
+		return
+	}
+	id, offset, _, err := readPosition(payload)
+	if err != nil {
+		return
+	}
+
+	lk.conn.SetWriteDeadline(time.Now().Add(timeout))
+	pos, err := l.handshake(w, id, offset)
+	if err != nil {
+		return
+	}
+	lk.ack.Store(pos)
+
+	// Подтверждения ведомого читаются отдельно от передачи операций
+	go func() {
+		for {
+			lk.conn.SetReadDeadline(time.Now().Add(timeout))
+			kind, payload, err := readFrame(r)
+			if err != nil {
+				lk.conn.Close()
+				return
+			}
+			if kind == frameAck {
+				if ack, n := binary.Uvarint(payload); n > 0 {
+					lk.ack.Store(ack)
+				}
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(l.opts.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		frames, next, notify, ok := l.since(pos)
+		if !ok {
+			// Ведомый отстал больше, чем на Backlog операций, и после переподключения получит снимок
+			return
+		}
+		if len(frames) > 0 {
+			lk.conn.SetWriteDeadline(time.Now().Add(timeout))
+			for _, frame := range frames {
+				w.Write(frame)
+			}
+			if err := w.Flush(); err != nil {
+				return
+			}
+			pos = next
+			continue
+		}
+
+		select {
+		case <-notify:
+		case <-ticker.C:
+			lk.conn.SetWriteDeadline(time.Now().Add(timeout))
+			writeFrame(w, frameBeat, binary.AppendUvarint(nil, pos))
+			if err := w.Flush(); err != nil {
+				return
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// handshake отвечает на запрос ведомого и возвращает смещение, с которого продолжается передача.
+func (l *Leader[KeyT, ValueT]) handshake(w *bufio.Writer, id string, offset uint64) (uint64, error) {
+	if id == l.id {
+		if _, _, _, ok := l.since(offset); ok {
+			writeFrame(w, frameContinue, appendPosition(nil, l.id, offset))
+			return offset, w.Flush()
+		}
+	}
+
+	// Запись остановлена на время снимка, чтобы он точно соответствовал смещению.
+	// Истечения, записанные в это время, ведомый повторит сам по TTL из снимка.
+	var snap bytes.Buffer
+	l.mu.Lock()
+	err := l.backend.SaveTo(&snap, l.opts.Keys, l.opts.Values)
+	pos := l.Offset()
+	l.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	payload := appendPosition(nil, l.id, pos)
+	if err := writeFrame(w, frameFull, append(payload, snap.Bytes()...)); err != nil {
+		return 0, err
+	}
+	return pos, w.Flush()
+}
@@ -0,0 +1,154 @@
+package replica
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Кадр протокола репликации:
+//
+//	[0]  тип кадра
+//	[1:] длина полезной нагрузки (uvarint), затем полезная нагрузка
+//
+// Ведомый начинает с frameSync, ведущий отвечает frameContinue или frameFull и
+// затем передает операции, каждая из которых увеличивает смещение на 1.
+const (
+	frameSync     byte = 'S' // ведомый: идентификатор репликации, смещение
+	frameContinue byte = 'C' // ведущий: идентификатор, смещение; далее операции после смещения ведомого
+	frameFull     byte = 'F' // ведущий: идентификатор, смещение, снимок
+	frameAck      byte = 'A' // ведомый: примененное смещение
+	frameBeat     byte = 'H' // ведущий: текущее смещение
+
+	opPut    byte = 'P' // ключ, значение, время истечения в наносекундах Unix (0 - без ограничения)
+	opDelete byte = 'D' // ключ
+	opExpire byte = 'E' // ключ истек
+	opTTL    byte = 'T' // ключ, новое время истечения
+)
+
+// maxFrameSize ограничивает кадры, кроме снимка.
+const maxFrameSize = 1 << 30
+
+var errProtocol = errors.New("replica: protocol error")
+
+func writeFrame(w *bufio.Writer, kind byte, payload []byte) error {
+	w.WriteByte(kind)
+	var size [binary.MaxVarintLen64]byte
+	w.Write(size[:binary.PutUvarint(size[:], uint64(len(payload)))])
+	_, err := w.Write(payload)
+	return err
+}
+
+// appendFrame кодирует кадр в buf, чтобы один раз закодированная операция
+// передавалась всем ведомым без повторного кодирования.
+func appendFrame(buf []byte, kind byte, payload []byte) []byte {
+	buf = append(buf, kind)
+	buf = binary.AppendUvarint(buf, uint64(len(payload)))
+	return append(buf, payload...)
+}
+
+// readFrame читает кадр. Кадр frameFull не ограничен maxFrameSize.
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	if size > maxFrameSize && kind != frameFull {
+		return 0, nil, fmt.Errorf("%w: frame of %d bytes", errProtocol, size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return kind, payload, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// position - идентификатор репликации и смещение, полезная нагрузка кадров S, C и F.
+func appendPosition(buf []byte, id string, offset uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(id)))
+	buf = append(buf, id...)
+	return binary.AppendUvarint(buf, offset)
+}
+
+func readPosition(payload []byte) (id string, offset uint64, rest []byte, err error) {
+	field, rest, ok := readField(payload)
+	if !ok {
+		return "", 0, nil, errProtocol
+	}
+	offset, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return "", 0, nil, errProtocol
+	}
+	return string(field), offset, rest[n:], nil
+}
+
+// op - операция журнала репликации.
+type op struct {
+	kind      byte
+	key       []byte
+	value     []byte
+	expiresAt int64
+}
+
+func appendOp(buf []byte, o op) []byte {
+	payload := binary.AppendUvarint(nil, uint64(len(o.key)))
+	payload = append(payload, o.key...)
+	switch o.kind {
+	case opPut:
+		payload = binary.AppendUvarint(payload, uint64(len(o.value)))
+		payload = append(payload, o.value...)
+		payload = binary.AppendVarint(payload, o.expiresAt)
+	case opTTL:
+		payload = binary.AppendVarint(payload, o.expiresAt)
+	}
+	return appendFrame(buf, o.kind, payload)
+}
+
+func decodeOp(kind byte, payload []byte) (op, error) {
+	o := op{kind: kind}
+	var ok bool
+	if o.key, payload, ok = readField(payload); !ok {
+		return o, errProtocol
+	}
+	if kind == opPut {
+		if o.value, payload, ok = readField(payload); !ok {
+			return o, errProtocol
+		}
+	}
+	if kind == opPut || kind == opTTL {
+		var n int
+		if o.expiresAt, n = binary.Varint(payload); n <= 0 {
+			return o, errProtocol
+		}
+		payload = payload[n:]
+	}
+	if len(payload) != 0 {
+		return o, errProtocol
+	}
+	return o, nil
+}
+
+func readField(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, false
+	}
+	return data[n : n+int(size)], data[n+int(size):], true
+}
+
+func isOp(kind byte) bool {
+	return kind == opPut || kind == opDelete || kind == opExpire || kind == opTTL
+}
@@ -0,0 +1,101 @@
+// Package replica реплицирует кэш с ведущего узла на ведомые по TCP.
+//
+// Ведущий (Leader) применяет Put, Delete и Expire к своему кэшу и записывает их, а также
+// истечение времени жизни, в журнал репликации. Каждая операция увеличивает смещение на 1.
+// Ведомый (Follower) при первом подключении получает снимок кэша со смещением и затем
+// применяет операции после него. После разрыва соединения ведомый переподключается и
+// продолжает с последнего примененного смещения, если оно еще есть в хвосте журнала
+// ведущего, иначе заново получает снимок. Ведомые доступны только для чтения.
+//
+// Вытеснения по емкости не реплицируются: чтения на ведомом меняют порядок вытеснения,
+// поэтому при заполненном кэше ведомый может хранить другой набор ключей.
+package replica
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+var (
+	// ErrReadOnly возвращают операции записи ведомого.
+	ErrReadOnly = errors.New("replica: follower is read-only")
+	// ErrClosed возвращают Serve после Close ведущего и WaitOffset после Close ведомого.
+	ErrClosed = errors.New("replica: closed")
+)
+
+// Backend - реплицируемый кэш. Его реализуют lru.Cache и lfu.Cache.
+type Backend[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	Expire(key KeyT, ttl time.Duration) bool
+	Clear()
+	OnEvict(fn func(e pkg.Eviction[KeyT, ValueT]))
+	SaveTo(w io.Writer, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error
+	LoadFrom(r io.Reader, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error
+}
+
+// Options - настройки ведущего и ведомого. Нулевое значение допустимо.
+// Кодеки и HeartbeatInterval ведущего и ведомых должны совпадать.
+type Options[KeyT comparable, ValueT any] struct {
+	// Keys и Values кодируют ключи и значения. По умолчанию snapshot.Gob.
+	Keys   snapshot.Codec[KeyT]
+	Values snapshot.Codec[ValueT]
+	// Backlog - число последних операций, которые хранит ведущий для продолжения
+	// репликации после разрыва без нового снимка. По умолчанию 10000.
+	Backlog int
+	// HeartbeatInterval - период контрольных сообщений ведущего, по умолчанию 1 секунда.
+	// Соединение считается разорванным после трех периодов без сообщений.
+	HeartbeatInterval time.Duration
+	// ReconnectInterval - пауза ведомого перед повторным подключением, по умолчанию 100 мс.
+	ReconnectInterval time.Duration
+	// Clock - часы backend, по которым сроки жизни переводятся в моменты истечения
+	// и обратно. По умолчанию pkg.SystemClock.
+	Clock pkg.Clock
+}
+
+func (o *Options[KeyT, ValueT]) setDefaults() {
+	if o.Keys == nil {
+		o.Keys = snapshot.Gob[KeyT]{}
+	}
+	if o.Values == nil {
+		o.Values = snapshot.Gob[ValueT]{}
+	}
+	if o.Backlog <= 0 {
+		o.Backlog = 10000
+	}
+	if o.HeartbeatInterval <= 0 {
+		o.HeartbeatInterval = time.Second
+	}
+	if o.ReconnectInterval <= 0 {
+		o.ReconnectInterval = 100 * time.Millisecond
+	}
+	if o.Clock == nil {
+		o.Clock = pkg.SystemClock
+	}
+}
+
+func (o *Options[KeyT, ValueT]) timeout() time.Duration {
+	return 3 * o.HeartbeatInterval
+}
+
+// expiresAt переводит время жизни в момент истечения, 0 - без ограничения.
+func (o *Options[KeyT, ValueT]) expiresAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	return o.Clock.Now().Add(ttl).UnixNano()
+}
+
+// remaining переводит момент истечения в оставшееся время жизни. ok == false - время уже истекло.
+func (o *Options[KeyT, ValueT]) remaining(expiresAt int64) (time.Duration, bool) {
+	if expiresAt == 0 {
+		return 0, true
+	}
+	ttl := time.Unix(0, expiresAt).Sub(o.Clock.Now())
+	return ttl, ttl > 0
+}
@@ -0,0 +1,252 @@
+package replica
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+func startLeader(t *testing.T, leader *Leader[string, string]) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- leader.Serve(ln) }()
+	t.Cleanup(func() {
+		leader.Close()
+		if err := <-done; !errors.Is(err, ErrClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return ln.Addr().String()
+}
+
+func follow(t *testing.T, addr string, opts Options[string, string]) (*Follower[string, string], *lru.Cache[string, string]) {
+	t.Helper()
+	cache := lru.NewCache[string, string](100)
+	f := Follow[string, string](addr, cache, opts)
+	t.Cleanup(func() { f.Close() })
+	return f, cache
+}
+
+// catchUp ждет, пока ведомый догонит ведущего.
+func catchUp(t *testing.T, f *Follower[string, string], leader *Leader[string, string]) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.WaitOffset(ctx, leader.Offset()); err != nil {
+		t.Fatalf("WaitOffset(%d): %v, at %d, last error %v", leader.Offset(), err, f.Offset(), f.Err())
+	}
+}
+
+func TestReplication(t *testing.T) {
+	leader := NewLeader[string, string](lfu.NewCache[string, string](100), Options[string, string]{})
+	leader.Put("before", "snapshot", 0)
+	leader.Put("short", "lived", 100*time.Millisecond)
+	addr := startLeader(t, leader)
+
+	f, cache := follow(t, addr, Options[string, string]{})
+	catchUp(t, f, leader)
+	if v, ok := f.Get("before"); !ok || v != "snapshot" || f.FullSyncs() != 1 {
+		t.Fatalf("after snapshot: %q %v, full syncs %d", v, ok, f.FullSyncs())
+	}
+
+	leader.Put("a", "1", 0)
+	leader.Put("b", "2", 0)
+	leader.Delete("a")
+	leader.Expire("b", time.Hour)
+	catchUp(t, f, leader)
+
+	if _, ok := f.Get("a"); ok {
+		t.Error("deleted key replicated")
+	}
+	if ttl, ok := cache.TTL("b"); !ok || ttl < 59*time.Minute {
+		t.Errorf("TTL(b) = %v, %v", ttl, ok)
+	}
+
+	// Истечение на ведущем передается ведомому операцией
+	time.Sleep(150 * time.Millisecond)
+	catchUp(t, f, leader)
+	if _, ok := f.Get("short"); ok {
+		t.Error("expired key still on follower")
+	}
+
+	if err := f.Put("x", "y", 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Put on follower: %v", err)
+	}
+	if err := f.Delete("b"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Delete on follower: %v", err)
+	}
+	if _, ok := f.Get("b"); !ok {
+		t.Error("follower write was applied")
+	}
+}
+
+// failCodec - кодек строк, который отказывает на ключе "bad" и, пока включен fail, на любом ключе
+type failCodec struct {
+	fail *atomic.Bool
+}
+
+func (c failCodec) Marshal(v string) ([]byte, error) {
+	if v == "bad" || c.fail.Load() {
+		return nil, errors.New("cannot encode")
+	}
+	return []byte(v), nil
+}
+
+func (c failCodec) Unmarshal(data []byte, v *string) error {
+	*v = string(data)
+	return nil
+}
+
+func TestReplicationEncodeError(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := lru.NewCache[string, string](100)
+	cache.SetClock(clock)
+	var fail atomic.Bool
+	opts := Options[string, string]{Keys: failCodec{&fail}, Clock: clock}
+	leader := NewLeader[string, string](cache, opts)
+	addr := startLeader(t, leader)
+
+	if err := leader.Put("bad", "v", 0); err == nil || cache.Contains("bad") {
+		t.Errorf("Put of unencodable key: %v, applied %v", err, cache.Contains("bad"))
+	}
+	if _, err := leader.Delete("bad"); err == nil {
+		t.Error("Delete of unencodable key succeeded")
+	}
+
+	leader.Put("short", "lived", time.Minute)
+	f, _ := follow(t, addr, opts)
+	catchUp(t, f, leader)
+
+	// Истечение, которое нельзя закодировать, заменяется новым снимком для ведомых
+	fail.Store(true)
+	clock.Advance(time.Minute)
+	fail.Store(false)
+	if leader.Err() == nil {
+		t.Error("expected encode error of expired key")
+	}
+	catchUp(t, f, leader)
+	if _, ok := f.Get("short"); ok || f.FullSyncs() != 2 {
+		t.Errorf("follower kept expired key: %v, full syncs %d", ok, f.FullSyncs())
+	}
+}
+
+func TestReplicationAck(t *testing.T) {
+	opts := Options[string, string]{HeartbeatInterval: 20 * time.Millisecond}
+	leader := NewLeader[string, string](lru.NewCache[string, string](100), opts)
+	addr := startLeader(t, leader)
+	f, _ := follow(t, addr, opts)
+
+	for i := 0; i < 10; i++ {
+		leader.Put(strconv.Itoa(i), "v", 0)
+	}
+	catchUp(t, f, leader)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		followers := leader.Followers()
+		if len(followers) == 1 && followers[0].Offset == 10 && followers[0].Lag == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("followers %+v", followers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if f.Lag() != 0 {
+		t.Errorf("follower lag %d", f.Lag())
+	}
+}
+
+// disconnect разрывает текущее соединение ведомого.
+func disconnect(f *Follower[string, string]) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+func TestReplicationResync(t *testing.T) {
+	opts := Options[string, string]{Backlog: 5, ReconnectInterval: 200 * time.Millisecond}
+	leader := NewLeader[string, string](lru.NewCache[string, string](100), opts)
+	addr := startLeader(t, leader)
+	f, _ := follow(t, addr, opts)
+	catchUp(t, f, leader)
+
+	// Пропущенные операции помещаются в хвост журнала: снимок не нужен
+	disconnect(f)
+	for i := 0; i < 3; i++ {
+		leader.Put("partial"+strconv.Itoa(i), "v", 0)
+	}
+	catchUp(t, f, leader)
+	if f.FullSyncs() != 1 {
+		t.Errorf("full syncs %d after partial resync", f.FullSyncs())
+	}
+
+	// Хвост журнала перезаписан: ведомый получает новый снимок
+	disconnect(f)
+	for i := 0; i < 10; i++ {
+		leader.Put("full"+strconv.Itoa(i), "v", 0)
+	}
+	catchUp(t, f, leader)
+	if f.FullSyncs() != 2 {
+		t.Errorf("full syncs %d after backlog overflow", f.FullSyncs())
+	}
+	for _, key := range []string{"partial2", "full9"} {
+		if _, ok := f.Get(key); !ok {
+			t.Errorf("%s missing", key)
+		}
+	}
+}
+
+func TestReplicationLeaderRestart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	first := NewLeader[string, string](lru.NewCache[string, string](100), Options[string, string]{})
+	first.Put("old", "1", 0)
+	go first.Serve(ln)
+
+	f, _ := follow(t, addr, Options[string, string]{})
+	catchUp(t, f, first)
+	first.Close()
+
+	// Новый ведущий с другим идентификатором репликации заменяет содержимое ведомого
+	second := NewLeader[string, string](lru.NewCache[string, string](100), Options[string, string]{})
+	second.Put("new", "2", 0)
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address reuse:", err)
+	}
+	go second.Serve(ln)
+	t.Cleanup(func() { second.Close() })
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.FullSyncs() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no resync, last error %v", f.Err())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	catchUp(t, f, second)
+	if _, ok := f.Get("old"); ok {
+		t.Error("stale key survived resync")
+	}
+	if v, _ := f.Get("new"); v != "2" {
+		t.Errorf("new = %q", v)
+	}
+}
@@ -0,0 +1,215 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// StatusError - неожиданный ответ сервера.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("rest: %d %s: %s", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// ClientOptions - настройки клиента. Нулевое значение - http.DefaultClient и тайм-аут 5 секунд.
+type ClientOptions struct {
+	HTTPClient *http.Client
+	// Timeout ограничивает запросы Get, Put и Delete, у которых нет контекста.
+	Timeout time.Duration
+	// OnError получает ошибки Get, Put и Delete, которые не могут быть возвращены вызывающему.
+	OnError func(err error)
+}
+
+// Client - клиент REST API. Реализует интерфейс Cacher[string, []byte]:
+// при ошибке Get возвращает промах, а ошибка передается в OnError.
+type Client struct {
+	base string
+	opts ClientOptions
+}
+
+// NewClient создает клиент к серверу с адресом baseURL, например "http://127.0.0.1:8080".
+func NewClient(baseURL string, opts ClientOptions) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Client{
+		base: strings.TrimSuffix(baseURL, "/"),
+		opts: opts,
+	}
+}
+
+// Get возвращает значение ключа.
+func (c *Client) Get(key string) ([]byte, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	value, ok, err := c.Fetch(ctx, key)
+	c.report(err)
+	return value, ok
+}
+
+// Put записывает значение с временем жизни ttl.
+func (c *Client) Put(key string, value []byte, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	c.report(c.Set(ctx, key, value, ttl))
+}
+
+// Delete удаляет ключ. Возвращает false, если ключа не было или запрос не удался.
+func (c *Client) Delete(key string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	deleted, err := c.Remove(ctx, key)
+	c.report(err)
+	return deleted
+}
+
+// Fetch - Get с контекстом и ошибкой.
+func (c *Client) Fetch(ctx context.Context, key string) ([]byte, bool, error) {
+	resp, err := c.do(ctx, http.MethodGet, keyPath(key), nil, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		value, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, false, err
+		}
+		return value, true, nil
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, statusError(resp)
+	}
+}
+
+// Set - Put с контекстом и ошибкой.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	header := http.Header{}
+	if ttl > 0 {
+		header.Set(TTLHeader, formatTTL(ttl))
+	}
+	resp, err := c.do(ctx, http.MethodPut, keyPath(key), bytes.NewReader(value), header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return statusError(resp)
+	}
+	return nil
+}
+
+// Remove - Delete с контекстом и ошибкой.
+func (c *Client) Remove(ctx context.Context, key string) (bool, error) {
+	resp, err := c.do(ctx, http.MethodDelete, keyPath(key), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, statusError(resp)
+	}
+}
+
+// Batch выполняет операции одним запросом и возвращает результаты в том же порядке.
+func (c *Client) Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error) {
+	body, err := json.Marshal(batchRequest{Ops: ops})
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{"Content-Type": {"application/json"}}
+	resp, err := c.do(ctx, http.MethodPost, "/batch", bytes.NewReader(body), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var out batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Results, nil
+}
+
+// Stats возвращает счетчики сервера.
+func (c *Client) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	resp, err := c.do(ctx, http.MethodGet, "/stats", nil, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return stats, statusError(resp)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stats)
+	return stats, err
+}
+
+// Ping проверяет доступность сервера.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Stats(ctx)
+	return err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return c.opts.HTTPClient.Do(req)
+}
+
+func (c *Client) report(err error) {
+	if err != nil && c.opts.OnError != nil {
+		c.opts.OnError(err)
+	}
+}
+
+// keyPath экранирует ключ, сохраняя его целиком в одном сегменте пути.
+func keyPath(key string) string {
+	return "/keys/" + url.PathEscape(key)
+}
+
+func statusError(resp *http.Response) error {
+	var body errorResponse
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if json.Unmarshal(data, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(data))
+	}
+	return &StatusError{Code: resp.StatusCode, Message: body.Error}
+}
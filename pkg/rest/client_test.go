@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+)
+
+// Cacher совпадает с интерфейсом Cacher корневого пакета
+type Cacher[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+}
+
+var _ Cacher[string, []byte] = (*Client)(nil)
+
+func TestClient(t *testing.T) {
+	cache := lfu.NewCache[string, []byte](10)
+	srv := httptest.NewServer(NewHandler(cache, Options{}))
+	defer srv.Close()
+
+	var errs []error
+	c := NewClient(srv.URL+"/", ClientOptions{OnError: func(err error) { errs = append(errs, err) }})
+
+	if _, ok := c.Get("a/b?c"); ok {
+		t.Error("missing key found")
+	}
+	c.Put("a/b?c", []byte("v"), time.Minute)
+	if v, ok := c.Get("a/b?c"); !ok || string(v) != "v" {
+		t.Errorf("Get: %q %v", v, ok)
+	}
+	if !cache.Contains("a/b?c") {
+		t.Error("key is stored under another name")
+	}
+	if ttl, _ := cache.TTL("a/b?c"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("TTL: %v", ttl)
+	}
+
+	ctx := context.Background()
+	results, err := c.Batch(ctx, []BatchOp{
+		{Op: OpPut, Key: "x", Value: []byte{0, 1, 2}},
+		{Op: OpGet, Key: "x"},
+	})
+	if err != nil || len(results) != 2 || string(results[1].Value) != "\x00\x01\x02" {
+		t.Errorf("Batch: %+v %v", results, err)
+	}
+	if !c.Delete("x") || c.Delete("x") {
+		t.Error("Delete")
+	}
+	stats, err := c.Stats(ctx)
+	if err != nil || stats.Keys != 1 || stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Stats: %+v %v", stats, err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("errors: %v", errs)
+	}
+
+	_, err = c.Batch(ctx, []BatchOp{{Op: "bogus"}})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest {
+		t.Errorf("Batch error: %v", err)
+	}
+
+	// Недоступный сервер - промах и ошибка в OnError
+	srv.Close()
+	if _, ok := c.Get("a/b?c"); ok || len(errs) != 1 {
+		t.Errorf("unreachable server: found %v, errors %v", ok, errs)
+	}
+}
@@ -0,0 +1,308 @@
+// Package rest открывает кэш по HTTP в формате REST/JSON и содержит Go-клиент к нему.
+//
+//	GET    /keys/{key}   значение ключа, заголовки ETag и X-Cache-TTL
+//	PUT    /keys/{key}   запись значения, время жизни в заголовке X-Cache-TTL
+//	DELETE /keys/{key}   удаление ключа
+//	GET    /stats        счетчики в JSON
+//	POST   /batch        несколько операций за один запрос
+//	GET    /openapi.json описание API
+package rest
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// TTLHeader - время жизни в секундах, дробная часть допускается. В ответе на GET
+// содержит оставшееся время жизни и отсутствует для ключей без ограничения.
+const TTLHeader = "X-Cache-TTL"
+
+//go:embed openapi.json
+var openAPI []byte
+
+// Backend - кэш, который открывает Handler. Его реализуют lru.Cache[string, []byte]
+// и lfu.Cache[string, []byte].
+type Backend interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, value []byte, ttl time.Duration)
+	Delete(key string) bool
+	TTL(key string) (time.Duration, bool)
+	Len() int
+}
+
+// weigher реализуют кэши, ограниченные суммарным весом элементов.
+type weigher interface {
+	Weight() int64
+}
+
+// Options - настройки Handler. Нулевое значение - значения по умолчанию.
+type Options struct {
+	// MaxValueSize - наибольший размер значения в байтах, по умолчанию 32 МиБ.
+	// Тело POST /batch ограничено удвоенным MaxValueSize.
+	MaxValueSize int64
+	// MaxBatch - наибольшее число операций в POST /batch, по умолчанию 1000.
+	MaxBatch int
+}
+
+// Stats - ответ GET /stats.
+type Stats struct {
+	Keys    int   `json:"keys"`
+	Weight  int64 `json:"weight,omitempty"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Puts    int64 `json:"puts"`
+	Deletes int64 `json:"deletes"`
+}
+
+// Операции POST /batch.
+const (
+	OpGet    = "get"
+	OpPut    = "put"
+	OpDelete = "delete"
+)
+
+// BatchOp - одна операция POST /batch. TTL задается в секундах, 0 - без ограничения.
+type BatchOp struct {
+	Op    string  `json:"op"`
+	Key   string  `json:"key"`
+	Value []byte  `json:"value,omitempty"`
+	TTL   float64 `json:"ttl,omitempty"`
+}
+
+// BatchResult - результат операции POST /batch. Found для get, Deleted для delete.
+type BatchResult struct {
+	Key     string `json:"key"`
+	Found   bool   `json:"found,omitempty"`
+	Value   []byte `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+type batchRequest struct {
+	Ops []BatchOp `json:"ops"`
+}
+
+type batchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler - HTTP-обработчик REST API над Backend.
+type Handler struct {
+	cache Backend
+	opts  Options
+	mux   *http.ServeMux
+
+	hits    atomic.Int64
+	misses  atomic.Int64
+	puts    atomic.Int64
+	deletes atomic.Int64
+}
+
+// NewHandler создает обработчик для cache.
+func NewHandler(cache Backend, opts Options) *Handler {
+	if opts.MaxValueSize <= 0 {
+		opts.MaxValueSize = 32 << 20
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 1000
+	}
+	h := &Handler{
+		cache: cache,
+		opts:  opts,
+		mux:   http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /keys/{key...}", h.get)
+	h.mux.HandleFunc("PUT /keys/{key...}", h.put)
+	h.mux.HandleFunc("DELETE /keys/{key...}", h.delete)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("POST /batch", h.batch)
+	h.mux.HandleFunc("GET /openapi.json", h.openAPI)
+	return h
+}
+
+// ServeHTTP реализует http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, ok := h.cache.Get(key)
+	if !ok {
+		h.misses.Add(1)
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	h.hits.Add(1)
+
+	etag := ETag(value)
+	w.Header().Set("ETag", etag)
+	if ttl, ok := h.cache.TTL(key); ok && ttl > 0 {
+		w.Header().Set(TTLHeader, formatTTL(ttl))
+	}
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request) {
+	ttl, err := parseTTL(r.Header.Get(TTLHeader))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.opts.MaxValueSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "value too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	h.cache.Put(r.PathValue("key"), value, ttl)
+	h.puts.Add(1)
+	w.Header().Set("ETag", ETag(value))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	if !h.cache.Delete(r.PathValue("key")) {
+		writeError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	h.deletes.Add(1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) stats(w http.ResponseWriter, r *http.Request) {
+	stats := Stats{
+		Keys:    h.cache.Len(),
+		Hits:    h.hits.Load(),
+		Misses:  h.misses.Load(),
+		Puts:    h.puts.Load(),
+		Deletes: h.deletes.Load(),
+	}
+	if weigher, ok := h.cache.(weigher); ok {
+		stats.Weight = weigher.Weight()
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// batch выполняет операции по порядку. Неизвестная операция отклоняет весь запрос до выполнения.
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	body := http.MaxBytesReader(w, r.Body, h.opts.MaxValueSize*2)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	if len(req.Ops) > h.opts.MaxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch exceeds %d operations", h.opts.MaxBatch))
+		return
+	}
+	for i, op := range req.Ops {
+		switch {
+		case op.Op != OpGet && op.Op != OpPut && op.Op != OpDelete:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("ops[%d]: unknown op %q", i, op.Op))
+			return
+		case op.TTL < 0 || op.TTL > math.MaxInt64/float64(time.Second):
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("ops[%d]: invalid ttl", i))
+			return
+		}
+	}
+
+	results := make([]BatchResult, len(req.Ops))
+	for i, op := range req.Ops {
+		results[i].Key = op.Key
+		switch op.Op {
+		case OpGet:
+			results[i].Value, results[i].Found = h.cache.Get(op.Key)
+			if results[i].Found {
+				h.hits.Add(1)
+			} else {
+				h.misses.Add(1)
+			}
+		case OpPut:
+			h.cache.Put(op.Key, op.Value, time.Duration(op.TTL*float64(time.Second)))
+			h.puts.Add(1)
+		case OpDelete:
+			results[i].Deleted = h.cache.Delete(op.Key)
+			if results[i].Deleted {
+				h.deletes.Add(1)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, batchResponse{Results: results})
+}
+
+func (h *Handler) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+// ETag возвращает строгий ETag значения.
+func ETag(value []byte) string {
+	hash := fnv.New64a()
+	hash.Write(value)
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+}
+
+// etagMatch проверяет заголовок If-None-Match: список ETag через запятую или "*".
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTTL разбирает время жизни в секундах. Пустое значение - без ограничения.
+func parseTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(s, 64)
+	if err != nil || seconds < 0 || math.IsNaN(seconds) || seconds > math.MaxInt64/float64(time.Second) {
+		return 0, fmt.Errorf("invalid %s header %q", TTLHeader, s)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func formatTTL(ttl time.Duration) string {
+	return strconv.FormatFloat(ttl.Seconds(), 'f', 3, 64)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,148 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+func request(t *testing.T, h http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerKeys(t *testing.T) {
+	h := NewHandler(lru.NewCache[string, []byte](10), Options{})
+
+	if rec := request(t, h, "GET", "/keys/a", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET missing: %d", rec.Code)
+	}
+	rec := request(t, h, "PUT", "/keys/a", "hello", map[string]string{TTLHeader: "60"})
+	if rec.Code != http.StatusNoContent || rec.Header().Get("ETag") != ETag([]byte("hello")) {
+		t.Fatalf("PUT: %d %q", rec.Code, rec.Header().Get("ETag"))
+	}
+
+	rec = request(t, h, "GET", "/keys/a", "", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("GET: %d %q", rec.Code, rec.Body.String())
+	}
+	etag := rec.Header().Get("ETag")
+	if ttl := rec.Header().Get(TTLHeader); ttl == "" || ttl > "60.000" {
+		t.Errorf("TTL header: %q", ttl)
+	}
+
+	// Совпадающий ETag возвращает 304 без тела
+	rec = request(t, h, "GET", "/keys/a", "", map[string]string{"If-None-Match": `"other", ` + etag})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match: %d %q", rec.Code, rec.Body.String())
+	}
+	request(t, h, "PUT", "/keys/a", "changed", nil)
+	rec = request(t, h, "GET", "/keys/a", "", map[string]string{"If-None-Match": etag})
+	if rec.Code != http.StatusOK || rec.Body.String() != "changed" || rec.Header().Get(TTLHeader) != "" {
+		t.Errorf("changed value: %d %q ttl %q", rec.Code, rec.Body.String(), rec.Header().Get(TTLHeader))
+	}
+
+	// Ключ со слешем и экранированием
+	request(t, h, "PUT", "/keys/dir%2Fname%20x", "v", nil)
+	if rec := request(t, h, "GET", "/keys/dir%2Fname%20x", "", nil); rec.Body.String() != "v" {
+		t.Errorf("escaped key: %d %q", rec.Code, rec.Body.String())
+	}
+
+	if rec := request(t, h, "PUT", "/keys/b", "x", map[string]string{TTLHeader: "-1"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("negative TTL: %d", rec.Code)
+	}
+	if rec := request(t, h, "DELETE", "/keys/a", "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d", rec.Code)
+	}
+	if rec := request(t, h, "DELETE", "/keys/a", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE missing: %d", rec.Code)
+	}
+}
+
+func TestHandlerLimits(t *testing.T) {
+	h := NewHandler(lru.NewCache[string, []byte](10), Options{MaxValueSize: 4})
+	if rec := request(t, h, "PUT", "/keys/a", "12345", nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large value: %d", rec.Code)
+	}
+
+	h = NewHandler(lru.NewCache[string, []byte](10), Options{MaxBatch: 1})
+	body := `{"ops":[{"op":"get","key":"a"},{"op":"get","key":"b"}]}`
+	if rec := request(t, h, "POST", "/batch", body, nil); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("large batch: %d", rec.Code)
+	}
+}
+
+func TestHandlerBatchAndStats(t *testing.T) {
+	cache := lru.NewCache[string, []byte](10)
+	h := NewHandler(cache, Options{})
+
+	body := `{"ops":[
+		{"op":"put","key":"a","value":"MQ==","ttl":0.05},
+		{"op":"put","key":"b","value":"Mg=="},
+		{"op":"get","key":"a"},
+		{"op":"get","key":"missing"},
+		{"op":"delete","key":"b"}
+	]}`
+	rec := request(t, h, "POST", "/batch", body, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp batchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 5 || !resp.Results[2].Found || string(resp.Results[2].Value) != "1" ||
+		resp.Results[3].Found || !resp.Results[4].Deleted {
+		t.Errorf("results: %+v", resp.Results)
+	}
+	if ttl, ok := cache.TTL("a"); !ok || ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("batch TTL: %v %v", ttl, ok)
+	}
+
+	// Неизвестная операция отклоняет запрос целиком
+	rec = request(t, h, "POST", "/batch", `{"ops":[{"op":"put","key":"c"},{"op":"incr","key":"c"}]}`, nil)
+	if rec.Code != http.StatusBadRequest || cache.Contains("c") {
+		t.Errorf("invalid op: %d, contains c %v", rec.Code, cache.Contains("c"))
+	}
+
+	rec = request(t, h, "GET", "/stats", "", nil)
+	var stats Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{Keys: 1, Weight: 1, Hits: 1, Misses: 1, Puts: 2, Deletes: 1}
+	if stats != want {
+		t.Errorf("stats: got %+v, want %+v", stats, want)
+	}
+}
+
+func TestHandlerOpenAPI(t *testing.T) {
+	h := NewHandler(lru.NewCache[string, []byte](10), Options{})
+
+	rec := request(t, h, "GET", "/openapi.json", "", nil)
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	data, _ := io.ReadAll(rec.Body)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/keys/{key}", "/stats", "/batch"} {
+		if _, ok := doc.Paths[path]; !ok {
+			t.Errorf("OpenAPI document lacks %s", path)
+		}
+	}
+}
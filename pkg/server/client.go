@@ -0,0 +1,419 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// ReplyError - ответ сервера с ошибкой.
+type ReplyError string
+
+func (e ReplyError) Error() string {
+	return string(e)
+}
+
+// ErrClientClosed возвращают методы Client после Close.
+var ErrClientClosed = errors.New("server: client closed")
+
+// ClientOptions - настройки Client. Нулевое значение - без локального кэша, тайм-аут 5 секунд.
+type ClientOptions struct {
+	// NearCacheSize - емкость локального lru-кэша значений GET. 0 отключает кэширование.
+	NearCacheSize int
+	// Broadcast включает режим BCAST: сервер сообщает обо всех изменениях ключей
+	// с префиксами Prefixes (пустой список - все ключи), а не только о прочитанных.
+	Broadcast bool
+	Prefixes  []string
+	// Timeout ограничивает подключение и каждую команду.
+	Timeout time.Duration
+}
+
+// ClientStats - счетчики Client.
+type ClientStats struct {
+	NearHits      int64 // ответы из локального кэша
+	NearMisses    int64 // обращения к серверу
+	Invalidations int64 // ключи из push-сообщений invalidate
+	Flushes       int64 // сбросы локального кэша: invalidate с null или разрыв соединения
+	Connects      int64 // подключения к серверу
+}
+
+// Client - клиент протокола RESP3 с локальным кэшем (near cache), который сервер
+// поддерживает в актуальном состоянии через CLIENT TRACKING. При разрыве соединения
+// сообщения об изменениях могут быть потеряны, поэтому локальный кэш сбрасывается,
+// а следующая команда подключается заново.
+//
+// Команды одного Client выполняются по очереди. Возвращаемые срезы общие с локальным
+// кэшем и не должны изменяться.
+type Client struct {
+	addr string
+	opts ClientOptions
+	near *lru.Cache[string, []byte]
+
+	// mu упорядочивает команды и защищает подключение
+	mu       sync.Mutex
+	conn     net.Conn
+	w        *bufio.Writer
+	replies  chan any
+	connDone chan struct{}
+	closed   bool
+	readers  sync.WaitGroup
+
+	// reading - ключи, чтение которых с сервера еще не завершилось; true - ключ
+	// изменился во время чтения, и ответ нельзя класть в локальный кэш
+	readMu  sync.Mutex
+	reading map[string]bool
+
+	nearHits      atomic.Int64
+	nearMisses    atomic.Int64
+	invalidations atomic.Int64
+	flushes       atomic.Int64
+	connects      atomic.Int64
+}
+
+// push - push-сообщение RESP3.
+type push []any
+
+// Dial подключается к серверу по адресу addr и включает отслеживание ключей,
+// если задан NearCacheSize.
+func Dial(addr string, opts ClientOptions) (*Client, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	c := &Client{
+		addr:    addr,
+		opts:    opts,
+		reading: make(map[string]bool),
+	}
+	if opts.NearCacheSize > 0 {
+		c.near = lru.NewCache[string, []byte](opts.NearCacheSize)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.connectLocked(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get возвращает значение ключа из локального кэша или с сервера.
+func (c *Client) Get(key string) ([]byte, bool, error) {
+	if c.near != nil {
+		if value, ok := c.near.Get(key); ok {
+			c.nearHits.Add(1)
+			return value, true, nil
+		}
+	}
+	c.nearMisses.Add(1)
+
+	c.readMu.Lock()
+	c.reading[key] = false
+	c.readMu.Unlock()
+
+	reply, err := c.Do("GET", key)
+
+	// Копия кладется под readMu: сообщение invalidate, пришедшее следом, удалит ее
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	invalidated := c.reading[key]
+	delete(c.reading, key)
+
+	if err != nil {
+		return nil, false, err
+	}
+	switch value := reply.(type) {
+	case nil:
+		return nil, false, nil
+	case []byte:
+		if c.near != nil && !invalidated {
+			c.near.Put(key, value, 0)
+		}
+		return value, true, nil
+	default:
+		return nil, false, fmt.Errorf("server: unexpected GET reply %T", reply)
+	}
+}
+
+// Set записывает значение с временем жизни ttl, 0 - без ограничения.
+func (c *Client) Set(key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	c.forget(key)
+	_, err := c.Do(args...)
+	return err
+}
+
+// Del удаляет ключ и сообщает, был ли он.
+func (c *Client) Del(key string) (bool, error) {
+	c.forget(key)
+	reply, err := c.Do("DEL", key)
+	if err != nil {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// forget удаляет локальную копию ключа, который изменяет сам клиент.
+func (c *Client) forget(key string) {
+	if c.near != nil {
+		c.near.Delete(key)
+	}
+}
+
+// Do выполняет произвольную команду и возвращает ответ: string, int64, []byte, []any,
+// nil или ReplyError в качестве ошибки. Словари RESP3 возвращаются плоским []any.
+func (c *Client) Do(args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	if c.conn != nil {
+		select {
+		case <-c.connDone:
+			// Сервер закрыл соединение, пока клиент простаивал
+			c.dropLocked()
+		default:
+		}
+	}
+	if c.conn == nil {
+		if err := c.connectLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return c.roundTripLocked(args)
+}
+
+// Stats возвращает счетчики клиента.
+func (c *Client) Stats() ClientStats {
+	return ClientStats{
+		NearHits:      c.nearHits.Load(),
+		NearMisses:    c.nearMisses.Load(),
+		Invalidations: c.invalidations.Load(),
+		Flushes:       c.flushes.Load(),
+		Connects:      c.connects.Load(),
+	}
+}
+
+// Close закрывает подключение.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.dropLocked()
+	c.mu.Unlock()
+
+	c.readers.Wait()
+	return nil
+}
+
+// connectLocked подключается, переходит на RESP3 и включает отслеживание.
+func (c *Client) connectLocked() error {
+	conn, err := net.DialTimeout("tcp", c.addr, c.opts.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.w = bufio.NewWriter(conn)
+	c.replies = make(chan any, 1)
+	c.connDone = make(chan struct{})
+	c.connects.Add(1)
+
+	c.readers.Add(1)
+	go c.readLoop(conn, c.replies, c.connDone)
+
+	handshake := [][]string{{"HELLO", "3"}}
+	if c.near != nil {
+		tracking := []string{"CLIENT", "TRACKING", "ON"}
+		if c.opts.Broadcast {
+			tracking = append(tracking, "BCAST")
+			for _, prefix := range c.opts.Prefixes {
+				tracking = append(tracking, "PREFIX", prefix)
+			}
+		}
+		handshake = append(handshake, tracking)
+	}
+	for _, args := range handshake {
+		if _, err := c.roundTripLocked(args); err != nil {
+			c.dropLocked()
+			return err
+		}
+	}
+	return nil
+}
+
+// dropLocked закрывает подключение. Локальный кэш сбрасывает readLoop.
+func (c *Client) dropLocked() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) roundTripLocked(args []string) (any, error) {
+	conn := c.conn
+	conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := c.w.Flush(); err != nil {
+		c.dropLocked()
+		return nil, err
+	}
+
+	timer := time.NewTimer(c.opts.Timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-c.replies:
+		if err, ok := reply.(ReplyError); ok {
+			return nil, err
+		}
+		return reply, nil
+	case <-c.connDone:
+		c.dropLocked()
+		return nil, io.ErrUnexpectedEOF
+	case <-timer.C:
+		c.dropLocked()
+		return nil, fmt.Errorf("server: %s: timeout", args[0])
+	}
+}
+
+// readLoop читает ответы и push-сообщения до разрыва соединения.
+func (c *Client) readLoop(conn net.Conn, replies chan<- any, done chan<- struct{}) {
+	defer c.readers.Done()
+	defer close(done)
+	// Сообщения об изменениях после разрыва потеряны
+	defer c.flushNear()
+
+	r := bufio.NewReader(conn)
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			conn.Close()
+			return
+		}
+		if p, ok := reply.(push); ok {
+			c.handlePush(p)
+			continue
+		}
+		select {
+		case replies <- reply:
+		default:
+			// Ответ без запроса, например после тайм-аута: поток рассинхронизирован
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (c *Client) handlePush(p push) {
+	if len(p) < 2 || c.near == nil {
+		return
+	}
+	if kind, _ := p[0].([]byte); string(kind) != "invalidate" {
+		return
+	}
+	keys, ok := p[1].([]any)
+	if !ok {
+		c.flushNear()
+		return
+	}
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for _, key := range keys {
+		name, _ := key.([]byte)
+		c.near.Delete(string(name))
+		if _, ok := c.reading[string(name)]; ok {
+			c.reading[string(name)] = true
+		}
+		c.invalidations.Add(1)
+	}
+}
+
+func (c *Client) flushNear() {
+	if c.near == nil {
+		return
+	}
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	c.near.Clear()
+	for key := range c.reading {
+		c.reading[key] = true
+	}
+	c.flushes.Add(1)
+}
+
+// readReply читает один ответ RESP2 или RESP3.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errProtocol
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return ReplyError(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '_':
+		return nil, nil
+	case '#':
+		return body == "t", nil
+	case ',':
+		return body, nil
+	case '$', '=':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*', '%', '~', '>':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if kind == '%' {
+			n *= 2
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		if kind == '>' {
+			return push(items), nil
+		}
+		return items, nil
+	default:
+		return nil, errProtocol
+	}
+}
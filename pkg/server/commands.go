@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// command - обработчик команды. arity - число аргументов вместе с именем команды,
+// отрицательное значение задает минимальное число.
+type command struct {
+	arity   int
+	handler func(s *Server, c *client, args [][]byte)
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ping":     {-1, (*Server).ping},
+		"echo":     {2, (*Server).echo},
+		"get":      {2, (*Server).get},
+		"set":      {-3, (*Server).set},
+		"del":      {-2, (*Server).del},
+		"exists":   {-2, (*Server).exists},
+		"ttl":      {2, (*Server).ttl},
+		"pttl":     {2, (*Server).pttl},
+		"expire":   {3, (*Server).expire},
+		"pexpire":  {3, (*Server).pexpire},
+		"dbsize":   {1, (*Server).dbsize},
+		"flushall": {-1, (*Server).flushall},
+		"flushdb":  {-1, (*Server).flushall},
+		"info":     {-1, (*Server).info},
+		"hello":    {-1, (*Server).hello},
+		"select":   {2, (*Server).selectDB},
+		"command":  {-1, (*Server).commandInfo},
+		"client":   {-2, (*Server).clientCmd},
+		"quit":     {-1, (*Server).quitCmd},
+	}
+}
+
+func (s *Server) dispatch(c *client, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		c.w.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		c.w.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	cmd.handler(s, c, args)
+}
+
+func (s *Server) ping(c *client, args [][]byte) {
+	switch len(args) {
+	case 1:
+		c.w.writeSimple("PONG")
+	case 2:
+		c.w.writeBulk(args[1])
+	default:
+		c.w.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *Server) echo(c *client, args [][]byte) {
+	c.w.writeBulk(args[1])
+}
+
+func (s *Server) get(c *client, args [][]byte) {
+	key := string(args[1])
+	value, ok := s.cache.Get(key)
+	s.trackRead(c, key)
+	if !ok {
+		c.w.writeNull()
+		return
+	}
+	c.w.writeBulk(value)
+}
+
+// set: SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (s *Server) set(c *client, args [][]byte) {
+	var ttl time.Duration
+	var nx, xx, expireSet bool
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "nx":
+			nx = true
+		case "xx":
+			xx = true
+		case "ex", "px":
+			if expireSet || i+1 >= len(args) {
+				c.w.writeError("ERR syntax error")
+				return
+			}
+			n, ok := parseInt(args[i+1])
+			if !ok {
+				c.w.writeError("ERR value is not an integer or out of range")
+				return
+			}
+			unit := time.Second
+			if args[i][0] == 'p' || args[i][0] == 'P' {
+				unit = time.Millisecond
+			}
+			if ttl, ok = duration(n, unit); !ok || n <= 0 {
+				c.w.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			expireSet = true
+			i++
+		default:
+			c.w.writeError("ERR syntax error")
+			return
+		}
+	}
+	if nx && xx {
+		c.w.writeError("ERR syntax error")
+		return
+	}
+
+	key := string(args[1])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if nx || xx {
+		if exists := s.cache.Contains(key); (nx && exists) || (xx && !exists) {
+			c.w.writeNull()
+			return
+		}
+	}
+	s.cache.Put(key, args[2], ttl)
+	c.keyChanged(key)
+	c.w.writeSimple("OK")
+}
+
+func (s *Server) del(c *client, args [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, key := range args[1:] {
+		if s.cache.Delete(string(key)) {
+			c.keyChanged(string(key))
+			n++
+		}
+	}
+	c.w.writeInt(n)
+}
+
+func (s *Server) exists(c *client, args [][]byte) {
+	var n int64
+	for _, key := range args[1:] {
+		if s.cache.Contains(string(key)) {
+			n++
+		}
+	}
+	c.w.writeInt(n)
+}
+
+func (s *Server) ttl(c *client, args [][]byte) {
+	s.writeTTL(c, string(args[1]), time.Second)
+}
+
+func (s *Server) pttl(c *client, args [][]byte) {
+	s.writeTTL(c, string(args[1]), time.Millisecond)
+}
+
+// writeTTL отвечает оставшимся временем жизни в единицах unit:
+// -2 - ключа нет, -1 - время жизни не ограничено.
+func (s *Server) writeTTL(c *client, key string, unit time.Duration) {
+	ttl, ok := s.cache.TTL(key)
+	switch {
+	case !ok:
+		c.w.writeInt(-2)
+	case ttl == 0:
+		c.w.writeInt(-1)
+	default:
+		c.w.writeInt(int64((ttl + unit/2) / unit))
+	}
+}
+
+func (s *Server) expire(c *client, args [][]byte) {
+	s.setExpire(c, args, time.Second)
+}
+
+func (s *Server) pexpire(c *client, args [][]byte) {
+	s.setExpire(c, args, time.Millisecond)
+}
+
+// setExpire устанавливает время жизни ключа. Неположительное время удаляет ключ, как в Redis.
+func (s *Server) setExpire(c *client, args [][]byte, unit time.Duration) {
+	n, ok := parseInt(args[2])
+	if !ok {
+		c.w.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	ttl, ok := duration(n, unit)
+	if !ok {
+		c.w.writeError(fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(string(args[0]))))
+		return
+	}
+	key := string(args[1])
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var done bool
+	if n <= 0 {
+		done = s.cache.Delete(key)
+	} else {
+		done = s.cache.Expire(key, ttl)
+	}
+	if done {
+		c.keyChanged(key)
+		c.w.writeInt(1)
+	} else {
+		c.w.writeInt(0)
+	}
+}
+
+func (s *Server) dbsize(c *client, args [][]byte) {
+	c.w.writeInt(int64(s.cache.Len()))
+}
+
+// flushall: FLUSHALL [ASYNC | SYNC]. Очистка всегда синхронная.
+func (s *Server) flushall(c *client, args [][]byte) {
+	if len(args) > 2 {
+		c.w.writeError("ERR syntax error")
+		return
+	}
+	if len(args) == 2 {
+		mode := strings.ToLower(string(args[1]))
+		if mode != "async" && mode != "sync" {
+			c.w.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache.Clear()
+	c.flushed = true
+	c.w.writeSimple("OK")
+}
+
+// info: INFO [section]. Поддерживаются разделы server, clients, stats и keyspace.
+func (s *Server) info(c *client, args [][]byte) {
+	section := "all"
+	if len(args) > 1 {
+		section = strings.ToLower(string(args[1]))
+	}
+	want := func(name string) bool {
+		return section == "all" || section == "default" || section == "everything" || section == name
+	}
+
+	var b strings.Builder
+	if want("server") {
+		fmt.Fprintf(&b, "# Server\r\n")
+		fmt.Fprintf(&b, "redis_version:%s\r\n", version)
+		fmt.Fprintf(&b, "redis_mode:standalone\r\n")
+		fmt.Fprintf(&b, "cache_policy:%s\r\n", s.policy)
+		fmt.Fprintf(&b, "go_version:%s\r\n", runtime.Version())
+		fmt.Fprintf(&b, "uptime_in_seconds:%d\r\n", int64(time.Since(s.started).Seconds()))
+		b.WriteString("\r\n")
+	}
+	if want("clients") {
+		fmt.Fprintf(&b, "# Clients\r\n")
+		fmt.Fprintf(&b, "connected_clients:%d\r\n", s.conns.connected())
+		b.WriteString("\r\n")
+	}
+	if want("stats") {
+		fmt.Fprintf(&b, "# Stats\r\n")
+		fmt.Fprintf(&b, "total_connections_received:%d\r\n", s.conns.accepted.Load())
+		fmt.Fprintf(&b, "total_commands_processed:%d\r\n", s.commands.Load())
+		b.WriteString("\r\n")
+	}
+	if want("keyspace") {
+		fmt.Fprintf(&b, "# Keyspace\r\n")
+		if n := s.cache.Len(); n > 0 {
+			fmt.Fprintf(&b, "db0:keys=%d\r\n", n)
+		}
+	}
+	c.w.writeBulkString(b.String())
+}
+
+// version - версия Redis, совместимость с которой заявляет сервер
+const version = "7.0.0"
+
+// hello: HELLO [protover [AUTH username password] [SETNAME clientname]]
+func (s *Server) hello(c *client, args [][]byte) {
+	proto := c.w.proto
+	if len(args) > 1 {
+		n, ok := parseInt(args[1])
+		if !ok {
+			c.w.writeError("ERR Protocol version is not an integer or out of range")
+			return
+		}
+		if n != 2 && n != 3 {
+			c.w.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+		proto = int(n)
+	}
+	c.w.proto = proto
+
+	c.w.writeMap(7)
+	c.w.writeBulkString("server")
+	c.w.writeBulkString("cache-sev")
+	c.w.writeBulkString("version")
+	c.w.writeBulkString(version)
+	c.w.writeBulkString("proto")
+	c.w.writeInt(int64(proto))
+	c.w.writeBulkString("id")
+	c.w.writeInt(c.id)
+	c.w.writeBulkString("mode")
+	c.w.writeBulkString("standalone")
+	c.w.writeBulkString("role")
+	c.w.writeBulkString("master")
+	c.w.writeBulkString("modules")
+	c.w.writeArray(0)
+}
+
+func (s *Server) selectDB(c *client, args [][]byte) {
+	if !bytes.Equal(args[1], []byte("0")) {
+		c.w.writeError("ERR DB index is out of range")
+		return
+	}
+	c.w.writeSimple("OK")
+}
+
+// commandInfo отвечает пустым списком: клиенты запрашивают COMMAND DOCS при подключении.
+func (s *Server) commandInfo(c *client, args [][]byte) {
+	c.w.writeArray(0)
+}
+
+// clientCmd выполняет CLIENT ID и CLIENT TRACKING, а SETNAME, SETINFO и подобные
+// команды принимает без изменения состояния.
+func (s *Server) clientCmd(c *client, args [][]byte) {
+	switch strings.ToLower(string(args[1])) {
+	case "id":
+		c.w.writeInt(c.id)
+	case "tracking":
+		s.clientTracking(c, args)
+	default:
+		c.w.writeSimple("OK")
+	}
+}
+
+func (s *Server) quitCmd(c *client, args [][]byte) {
+	c.w.writeSimple("OK")
+	c.quit = true
+}
+
+// duration переводит n единиц unit в time.Duration, сообщая о переполнении.
+func duration(n int64, unit time.Duration) (time.Duration, bool) {
+	if n > int64(math.MaxInt64/unit) || n < int64(math.MinInt64/unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func parseInt(b []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
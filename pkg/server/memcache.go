@@ -0,0 +1,612 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+const (
+	// maxKeyLen - наибольшая длина ключа memcached
+	maxKeyLen = 250
+	// maxItemSize - наибольший размер значения, как item_size_max в memcached по умолчанию
+	maxItemSize = 1 << 20
+	// maxRelativeExptime - время жизни больше 30 дней задается абсолютным временем Unix
+	maxRelativeExptime = 30 * 24 * 60 * 60
+	// itemOverhead - учитываемый в весе элемента размер служебных полей
+	itemOverhead = 48
+)
+
+// Item - значение memcached: данные, флаги клиента и CAS-токен.
+type Item struct {
+	Value []byte
+	Flags uint32
+	CAS   uint64
+}
+
+// ItemWeight возвращает размер элемента в байтах для кэшей, ограниченных объемом:
+//
+//	lru.NewWeightedCache[string, server.Item](64<<20, server.ItemWeight)
+func ItemWeight(key string, item Item) int64 {
+	return int64(len(key)+len(item.Value)) + itemOverhead
+}
+
+// MemcacheBackend - кэш, который обслуживает Memcache. Его реализуют
+// lru.Cache[string, server.Item] и lfu.Cache[string, server.Item].
+type MemcacheBackend interface {
+	Get(key string) (Item, bool)
+	GetEntry(key string) (pkg.Entry[string, Item], bool)
+	Put(key string, item Item, ttl time.Duration)
+	Delete(key string) bool
+	TTL(key string) (time.Duration, bool)
+	Expire(key string, ttl time.Duration) bool
+	Len() int
+	Clear()
+}
+
+// weigher реализуют кэши, ограниченные суммарным весом элементов.
+type weigher interface {
+	Weight() int64
+}
+
+// evictNotifier реализуют кэши, сообщающие о вытеснении.
+type evictNotifier interface {
+	OnEvict(fn func(e pkg.Eviction[string, Item]))
+}
+
+// Memcache - сервер текстового и мета-протокола memcached поверх MemcacheBackend.
+type Memcache struct {
+	cache  MemcacheBackend
+	policy string
+
+	// mu делает атомарными проверку и запись: add, replace, cas, incr и мета-команды
+	mu sync.Mutex
+	// cas - последний выданный CAS-токен
+	cas atomic.Uint64
+
+	conns   tracker
+	started time.Time
+	// clock - часы кэша, по которым exptime переводится во время жизни
+	clock pkg.Clock
+
+	flushTimer pkg.Timer
+
+	getCmds   atomic.Int64
+	setCmds   atomic.Int64
+	getHits   atomic.Int64
+	getMisses atomic.Int64
+	evictions atomic.Int64
+	expired   atomic.Int64
+}
+
+// NewMemcache создает сервер memcached для cache. policy выводится в stats.
+func NewMemcache(cache MemcacheBackend, policy string) *Memcache {
+	m := &Memcache{
+		cache:   cache,
+		policy:  policy,
+		started: time.Now(),
+		clock:   pkg.SystemClock,
+	}
+	if notifier, ok := cache.(evictNotifier); ok {
+		notifier.OnEvict(m.countEviction)
+	}
+	return m
+}
+
+// SetClock задает часы, по которым exptime переводится во время жизни и отсчитывается
+// отложенный flush_all. Совпадают с часами кэша, по умолчанию pkg.SystemClock.
+// nil возвращает системные часы. Часы задаются до начала обслуживания.
+func (m *Memcache) SetClock(clock pkg.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if clock == nil {
+		clock = pkg.SystemClock
+	}
+	m.clock = clock
+}
+
+// ListenAndServe слушает TCP-адрес addr и обслуживает подключения.
+func (m *Memcache) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.Serve(ln)
+}
+
+// Serve принимает подключения из ln до вызова Close, после которого возвращает ErrServerClosed.
+func (m *Memcache) Serve(ln net.Listener) error {
+	return m.conns.serve(ln, m.serveConn)
+}
+
+// Addr возвращает адрес, который слушает сервер, или nil до вызова Serve.
+func (m *Memcache) Addr() net.Addr {
+	return m.conns.addr()
+}
+
+// Close закрывает слушающий сокет и все подключения и ждет завершения их обработки.
+func (m *Memcache) Close() error {
+	m.mu.Lock()
+	if m.flushTimer != nil {
+		m.flushTimer.Stop()
+	}
+	m.mu.Unlock()
+	return m.conns.close()
+}
+
+func (m *Memcache) countEviction(e pkg.Eviction[string, Item]) {
+	if e.Reason == pkg.EvictCapacity {
+		m.evictions.Add(1)
+	} else {
+		m.expired.Add(1)
+	}
+}
+
+// errClient - ошибка в команде клиента, соединение остается открытым.
+type errClient string
+
+func (e errClient) Error() string { return string(e) }
+
+const (
+	errBadFormat = errClient("bad command line format")
+	errBadChunk  = errClient("bad data chunk")
+	errNonNum    = errClient("cannot increment or decrement non-numeric value")
+	errInvalid   = errClient("invalid numeric delta argument")
+)
+
+// mcConn - одно подключение memcached.
+type mcConn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func (m *Memcache) serveConn(conn net.Conn) {
+	c := &mcConn{r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			} else if !errors.Is(err, io.EOF) && !m.conns.isClosed() {
+				log.Printf("Ошибка чтения команды от %v: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		fields := bytes.Fields(line)
+		if len(fields) == 0 {
+			c.w.WriteString("ERROR\r\n")
+		} else {
+			quit, err := m.dispatch(c, fields)
+			if quit {
+				c.w.Flush()
+				return
+			}
+			var clientErr errClient
+			switch {
+			case errors.As(err, &clientErr):
+				fmt.Fprintf(c.w, "CLIENT_ERROR %s\r\n", clientErr)
+			case err != nil:
+				// Поток команд рассинхронизирован, например оборвался блок данных
+				return
+			}
+		}
+
+		// Ответы на конвейер команд отправляются одной записью
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dispatch выполняет команду. quit - клиент запросил закрытие соединения.
+func (m *Memcache) dispatch(c *mcConn, fields [][]byte) (quit bool, err error) {
+	args := fields[1:]
+	switch string(fields[0]) {
+	case "get":
+		return false, m.get(c, args, false)
+	case "gets":
+		return false, m.get(c, args, true)
+	case "set", "add", "replace", "cas":
+		return false, m.store(c, string(fields[0]), args)
+	case "delete":
+		return false, m.delete(c, args)
+	case "incr", "decr":
+		return false, m.incr(c, string(fields[0]) == "incr", args)
+	case "touch":
+		return false, m.touch(c, args)
+	case "flush_all":
+		return false, m.flushAll(c, args)
+	case "stats":
+		m.stats(c)
+	case "version":
+		fmt.Fprintf(c.w, "VERSION %s\r\n", memcacheVersion)
+	case "verbosity":
+		if !noreply(args) {
+			c.w.WriteString("OK\r\n")
+		}
+	case "quit":
+		return true, nil
+	case "mg":
+		return false, m.metaGet(c, args)
+	case "ms":
+		return false, m.metaSet(c, args)
+	case "md":
+		return false, m.metaDelete(c, args)
+	case "mn":
+		c.w.WriteString("MN\r\n")
+	default:
+		c.w.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+// memcacheVersion - версия memcached, совместимость с которой заявляет сервер
+const memcacheVersion = "1.6.21"
+
+// get: get|gets <key>*
+func (m *Memcache) get(c *mcConn, keys [][]byte, withCAS bool) error {
+	if len(keys) == 0 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	for _, key := range keys {
+		if len(key) > maxKeyLen {
+			return errBadFormat
+		}
+	}
+	for _, key := range keys {
+		m.getCmds.Add(1)
+		item, ok := m.cache.Get(string(key))
+		if !ok {
+			m.getMisses.Add(1)
+			continue
+		}
+		m.getHits.Add(1)
+		fmt.Fprintf(c.w, "VALUE %s %d %d", key, item.Flags, len(item.Value))
+		if withCAS {
+			fmt.Fprintf(c.w, " %d", item.CAS)
+		}
+		c.w.WriteString("\r\n")
+		c.w.Write(item.Value)
+		c.w.WriteString("\r\n")
+	}
+	c.w.WriteString("END\r\n")
+	return nil
+}
+
+// store: set|add|replace <key> <flags> <exptime> <bytes> [noreply]
+// и cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+func (m *Memcache) store(c *mcConn, cmd string, args [][]byte) error {
+	want := 4
+	if cmd == "cas" {
+		want = 5
+	}
+	if len(args) != want && !(len(args) == want+1 && noreply(args)) {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	key := args[0]
+	flags, err1 := strconv.ParseUint(string(args[1]), 10, 32)
+	exptime, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	size, err3 := strconv.Atoi(string(args[3]))
+	if err1 != nil || err2 != nil || err3 != nil || size < 0 || len(key) > maxKeyLen {
+		return errBadFormat
+	}
+	cond := storeCond{mode: storeModes[cmd]}
+	if cmd == "cas" {
+		var err error
+		if cond.cas, err = strconv.ParseUint(string(args[4]), 10, 64); err != nil {
+			return errBadFormat
+		}
+		cond.checkCAS = true
+	}
+	if size > maxItemSize {
+		// Блок данных пропускается, чтобы не рассинхронизировать поток команд
+		if _, err := c.r.Discard(size + 2); err != nil {
+			return err
+		}
+		c.w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	value, err := readChunk(c.r, size)
+	if err != nil {
+		return err
+	}
+
+	result, _ := m.set(string(key), value, uint32(flags), exptime, cond)
+	if !noreply(args) {
+		c.w.WriteString(storeReplies[result])
+	}
+	return nil
+}
+
+var storeModes = map[string]byte{"set": 'S', "add": 'E', "replace": 'R', "cas": 'S'}
+
+type storeResult int
+
+const (
+	stored storeResult = iota
+	notStored
+	exists
+	notFound
+)
+
+var storeReplies = [...]string{
+	stored:    "STORED\r\n",
+	notStored: "NOT_STORED\r\n",
+	exists:    "EXISTS\r\n",
+	notFound:  "NOT_FOUND\r\n",
+}
+
+// storeCond - условие записи. mode: 'S' - всегда, 'E' - если ключа нет, 'R' - если ключ есть,
+// 'A' и 'P' - дописать в конец или в начало существующего значения.
+// checkCAS требует совпадения CAS-токена с cas.
+type storeCond struct {
+	mode     byte
+	checkCAS bool
+	cas      uint64
+}
+
+// set записывает значение при выполнении cond и возвращает новый CAS-токен.
+func (m *Memcache) set(key string, value []byte, flags uint32, exptime int64, cond storeCond) (storeResult, uint64) {
+	m.setCmds.Add(1)
+	ttl, expired := expiration(exptime, m.clock.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Проверка не засчитывается как обращение и не меняет порядок вытеснения
+	entry, found := m.cache.GetEntry(key)
+	old := entry.Value
+	mode := cond.mode
+	switch {
+	case cond.checkCAS && !found:
+		return notFound, 0
+	case cond.checkCAS && old.CAS != cond.cas:
+		return exists, 0
+	case mode == 'E' && found:
+		return notStored, 0
+	case (mode == 'R' || mode == 'A' || mode == 'P') && !found:
+		return notStored, 0
+	}
+
+	switch mode {
+	case 'A':
+		value = append(bytes.Clone(old.Value), value...)
+		flags = old.Flags
+	case 'P':
+		value = append(value, old.Value...)
+		flags = old.Flags
+	}
+	if mode == 'A' || mode == 'P' {
+		// Дописывание сохраняет прежнее время жизни
+		ttl, _ = m.cache.TTL(key)
+		expired = false
+	}
+	if expired {
+		m.cache.Delete(key)
+		return stored, 0
+	}
+	cas := m.cas.Add(1)
+	m.cache.Put(key, Item{Value: value, Flags: flags, CAS: cas}, ttl)
+	return stored, cas
+}
+
+// delete: delete <key> [0] [noreply]
+func (m *Memcache) delete(c *mcConn, args [][]byte) error {
+	if len(args) == 0 || len(args) > 3 {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	if len(args) > 1 && !noreply(args) && string(args[1]) != "0" {
+		return errClient("bad command line format.  Usage: delete <key> [noreply]")
+	}
+
+	result := m.deleteKey(string(args[0]), false, 0)
+	if noreply(args) {
+		return nil
+	}
+	if result == stored {
+		c.w.WriteString("DELETED\r\n")
+	} else {
+		c.w.WriteString("NOT_FOUND\r\n")
+	}
+	return nil
+}
+
+// incr: incr|decr <key> <value> [noreply]. Значение - десятичное беззнаковое 64-битное число,
+// incr переполняется через ноль, decr не опускается ниже нуля.
+func (m *Memcache) incr(c *mcConn, increment bool, args [][]byte) error {
+	if len(args) != 2 && !(len(args) == 3 && noreply(args)) {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	delta, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return errInvalid
+	}
+	key := string(args[0])
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.cache.GetEntry(key)
+	if !ok {
+		if !noreply(args) {
+			c.w.WriteString("NOT_FOUND\r\n")
+		}
+		return nil
+	}
+	item := entry.Value
+	n, err := strconv.ParseUint(string(item.Value), 10, 64)
+	if err != nil {
+		return errNonNum
+	}
+	if increment {
+		n += delta
+	} else if delta > n {
+		n = 0
+	} else {
+		n -= delta
+	}
+
+	ttl, _ := m.cache.TTL(key)
+	value := strconv.AppendUint(nil, n, 10)
+	m.cache.Put(key, Item{Value: value, Flags: item.Flags, CAS: m.cas.Add(1)}, ttl)
+	if !noreply(args) {
+		c.w.Write(value)
+		c.w.WriteString("\r\n")
+	}
+	return nil
+}
+
+// touch: touch <key> <exptime> [noreply]
+func (m *Memcache) touch(c *mcConn, args [][]byte) error {
+	if len(args) != 2 && !(len(args) == 3 && noreply(args)) {
+		c.w.WriteString("ERROR\r\n")
+		return nil
+	}
+	exptime, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return errClient("invalid exptime argument")
+	}
+
+	touched := m.touchKey(string(args[0]), exptime)
+	if noreply(args) {
+		return nil
+	}
+	if touched {
+		c.w.WriteString("TOUCHED\r\n")
+	} else {
+		c.w.WriteString("NOT_FOUND\r\n")
+	}
+	return nil
+}
+
+// touchKey устанавливает новое время жизни ключа.
+func (m *Memcache) touchKey(key string, exptime int64) bool {
+	ttl, expired := expiration(exptime, m.clock.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if expired {
+		return m.cache.Delete(key)
+	}
+	return m.cache.Expire(key, ttl)
+}
+
+// flushAll: flush_all [delay] [noreply]. С задержкой кэш очищается по таймеру.
+func (m *Memcache) flushAll(c *mcConn, args [][]byte) error {
+	var delay int64
+	if len(args) > 0 && !(len(args) == 1 && noreply(args)) {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil || delay < 0 {
+			return errBadFormat
+		}
+	}
+
+	m.mu.Lock()
+	if m.flushTimer != nil {
+		m.flushTimer.Stop()
+		m.flushTimer = nil
+	}
+	if delay > 0 {
+		m.flushTimer = m.clock.AfterFunc(time.Duration(delay)*time.Second, m.flush)
+	} else {
+		m.cache.Clear()
+	}
+	m.mu.Unlock()
+
+	if !noreply(args) {
+		c.w.WriteString("OK\r\n")
+	}
+	return nil
+}
+
+func (m *Memcache) flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cache.Clear()
+}
+
+// stats выводит общие счетчики сервера.
+func (m *Memcache) stats(c *mcConn) {
+	now := time.Now()
+	stat := func(name string, value any) {
+		fmt.Fprintf(c.w, "STAT %s %v\r\n", name, value)
+	}
+	stat("pid", os.Getpid())
+	stat("uptime", int64(now.Sub(m.started).Seconds()))
+	stat("time", now.Unix())
+	stat("version", memcacheVersion)
+	stat("policy", m.policy)
+	stat("curr_connections", m.conns.connected())
+	stat("total_connections", m.conns.accepted.Load())
+	stat("cmd_get", m.getCmds.Load())
+	stat("cmd_set", m.setCmds.Load())
+	stat("get_hits", m.getHits.Load())
+	stat("get_misses", m.getMisses.Load())
+	stat("curr_items", m.cache.Len())
+	if w, ok := m.cache.(weigher); ok {
+		stat("bytes", w.Weight())
+	}
+	stat("evictions", m.evictions.Load())
+	stat("expired_unfetched", m.expired.Load())
+	c.w.WriteString("END\r\n")
+}
+
+// expiration переводит exptime memcached во время жизни: 0 - без ограничения,
+// до 30 дней - в секундах от текущего момента, больше - абсолютное время Unix.
+// expired - элемент истек сразу, например при отрицательном exptime.
+func expiration(exptime int64, now time.Time) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime > maxRelativeExptime:
+		ttl = time.Unix(exptime, 0).Sub(now)
+		return ttl, ttl <= 0
+	default:
+		return time.Duration(exptime) * time.Second, false
+	}
+}
+
+// readChunk читает блок данных длины size, завершенный "\r\n".
+func readChunk(r *bufio.Reader, size int) ([]byte, error) {
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		// Остаток строки с лишними данными пропускается
+		if buf[size+1] != '\n' {
+			if _, err := r.ReadSlice('\n'); err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+				return nil, err
+			}
+		}
+		return nil, errBadChunk
+	}
+	return buf[:size:size], nil
+}
+
+func noreply(args [][]byte) bool {
+	return len(args) > 0 && string(args[len(args)-1]) == "noreply"
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// startMemcache запускает сервер над cache. clock - часы кэша, nil - системные.
+func startMemcache(t *testing.T, cache MemcacheBackend, clock pkg.Clock) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMemcache(cache, "lru")
+	m.SetClock(clock)
+	done := make(chan error, 1)
+	go func() { done <- m.Serve(ln) }()
+	t.Cleanup(func() {
+		m.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return ln.Addr().String()
+}
+
+// mcClient сравнивает ответ сервера с ожидаемым побайтно
+type mcClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialMemcache(t *testing.T, addr string) *mcClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &mcClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *mcClient) expect(request, want string) {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		c.t.Fatal(err)
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(c.r, got); err != nil {
+		c.t.Fatalf("%q: %v, read %q", request, err, got)
+	}
+	if string(got) != want {
+		c.t.Errorf("%q: got %q, want %q", request, got, want)
+	}
+}
+
+// line читает одну строку ответа
+func (c *mcClient) line(request string) string {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, request); err != nil {
+		c.t.Fatal(err)
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return line
+}
+
+func TestMemcacheText(t *testing.T) {
+	c := dialMemcache(t, startMemcache(t, lru.NewCache[string, Item](100), nil))
+
+	c.expect("get a\r\n", "END\r\n")
+	c.expect("set a 5 0 3\r\nabc\r\n", "STORED\r\n")
+	c.expect("get a missing\r\n", "VALUE a 5 3\r\nabc\r\nEND\r\n")
+	c.expect("add a 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	c.expect("replace b 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	c.expect("add b 0 0 1\r\nx\r\n", "STORED\r\n")
+	c.expect("replace b 7 0 2\r\nyz\r\n", "STORED\r\n")
+	c.expect("get b\r\n", "VALUE b 7 2\r\nyz\r\nEND\r\n")
+
+	// cas с устаревшим токеном не записывает значение
+	line := c.line("gets a\r\n")
+	var cas string
+	if fields := strings.Fields(line); len(fields) != 5 {
+		t.Fatalf("gets: %q", line)
+	} else {
+		cas = fields[4]
+	}
+	c.expect("", "abc\r\nEND\r\n")
+	c.expect("cas a 0 0 1 "+cas+"\r\nz\r\n", "STORED\r\n")
+	c.expect("cas a 0 0 1 "+cas+"\r\nw\r\n", "EXISTS\r\n")
+	c.expect("cas missing 0 0 1 1\r\nw\r\n", "NOT_FOUND\r\n")
+	c.expect("get a\r\n", "VALUE a 0 1\r\nz\r\nEND\r\n")
+
+	c.expect("set n 0 0 2\r\n10\r\n", "STORED\r\n")
+	c.expect("incr n 5\r\n", "15\r\n")
+	c.expect("decr n 100\r\n", "0\r\n")
+	c.expect("incr a 1\r\n", "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+	c.expect("incr missing 1\r\n", "NOT_FOUND\r\n")
+
+	c.expect("delete a\r\n", "DELETED\r\n")
+	c.expect("delete a\r\n", "NOT_FOUND\r\n")
+	c.expect("set q 0 0 1 noreply\r\nq\r\nget q\r\n", "VALUE q 0 1\r\nq\r\nEND\r\n")
+
+	c.expect("set big 0 0 1048577\r\n"+strings.Repeat("x", 1048577)+"\r\n", "SERVER_ERROR object too large for cache\r\n")
+	c.expect("set bad 0 0 1\r\nxyz\r\n", "CLIENT_ERROR bad data chunk\r\n")
+	c.expect("bogus\r\n", "ERROR\r\n")
+	c.expect("version\r\n", "VERSION "+memcacheVersion+"\r\n")
+
+	c.expect("flush_all\r\n", "OK\r\n")
+	c.expect("get b n q\r\n", "END\r\n")
+}
+
+func TestMemcacheWriteChecks(t *testing.T) {
+	cache := lru.NewCache[string, Item](2)
+	c := dialMemcache(t, startMemcache(t, cache, nil))
+
+	c.expect("set a 0 0 1\r\n1\r\n", "STORED\r\n")
+	c.expect("set b 0 0 1\r\n1\r\n", "STORED\r\n")
+	// Проверки add, cas, md и incr не засчитываются как попадания и не продлевают жизнь a
+	c.expect("add a 0 0 1\r\nx\r\n", "NOT_STORED\r\n")
+	c.expect("cas a 0 0 1 100\r\nx\r\n", "EXISTS\r\n")
+	c.expect("md a C100\r\n", "EX\r\n")
+	c.expect("incr b 1\r\n", "2\r\n")
+	if st := cache.Stats(); st.Hits != 0 {
+		t.Errorf("write checks counted %d hits", st.Hits)
+	}
+
+	c.expect("set c 0 0 1\r\n1\r\n", "STORED\r\n")
+	if cache.Contains("a") {
+		t.Error("Expected a to be evicted as least recently used")
+	}
+}
+
+func TestMemcacheExpiration(t *testing.T) {
+	clock := cachetest.NewClock(time.Time{})
+	cache := lru.NewCache[string, Item](100)
+	cache.SetClock(clock)
+	c := dialMemcache(t, startMemcache(t, cache, clock))
+
+	c.expect("set a 0 1 1\r\na\r\n", "STORED\r\n")
+	c.expect("set gone 0 -1 1\r\ng\r\n", "STORED\r\n")
+	c.expect("get gone\r\n", "END\r\n")
+	c.expect("touch a 100\r\n", "TOUCHED\r\n")
+	c.expect("touch missing 100\r\n", "NOT_FOUND\r\n")
+	c.expect("mg a t\r\n", "HD t100\r\n")
+
+	// Абсолютное время Unix в прошлом
+	c.expect("set old 0 2592001 1\r\no\r\n", "STORED\r\n")
+	c.expect("get old\r\n", "END\r\n")
+
+	c.expect("set short 0 0 1\r\ns\r\n", "STORED\r\n")
+	c.expect("mg short T1 t v\r\n", "VA 1 t1\r\ns\r\n")
+	clock.Advance(time.Second)
+	c.expect("mg short v\r\n", "EN\r\n")
+}
+
+func TestMemcacheMeta(t *testing.T) {
+	c := dialMemcache(t, startMemcache(t, lfu.NewCache[string, Item](100), nil))
+
+	c.expect("mg a v\r\n", "EN\r\n")
+	c.expect("mg a v q\r\nmn\r\n", "MN\r\n")
+	c.expect("ms a 3 F9 T0\r\nabc\r\n", "HD\r\n")
+	c.expect("mg a v f s k Oxyz t\r\n", "VA 3 f9 s3 t-1 Oxyz ka\r\nabc\r\n")
+	c.expect("mg a\r\n", "HD\r\n")
+
+	line := c.line("ms b 1 c\r\nb\r\n")
+	if !strings.HasPrefix(line, "HD c") {
+		t.Fatalf("ms c: %q", line)
+	}
+	cas := strings.TrimSpace(strings.TrimPrefix(line, "HD c"))
+	c.expect("ms b 1 C"+cas+"0\r\nx\r\n", "EX\r\n")
+	c.expect("ms b 1 C"+cas+"\r\ny\r\n", "HD\r\n")
+	c.expect("mg b v c\r\n", "VA 1 c"+next(cas)+"\r\ny\r\n")
+
+	c.expect("ms b 1 ME\r\nz\r\n", "NS\r\n")
+	c.expect("ms c 1 MR\r\nz\r\n", "NS\r\n")
+	c.expect("ms b 2 MA\r\n23\r\n", "HD\r\n")
+	c.expect("ms b 1 MP q\r\n0\r\nmn\r\n", "MN\r\n")
+	c.expect("mg b v\r\n", "VA 4\r\n0y23\r\n")
+	c.expect("ms b 1 MX\r\nz\r\n", "CLIENT_ERROR invalid mode for ms\r\n")
+	c.expect("mg b Z\r\n", "CLIENT_ERROR invalid flag\r\n")
+
+	c.expect("md b C1\r\n", "EX\r\n")
+	c.expect("md b q\r\nmn\r\n", "MN\r\n")
+	c.expect("md b\r\n", "NF\r\n")
+	c.expect("mg b v\r\n", "EN\r\n")
+}
+
+// next возвращает следующий CAS-токен
+func next(cas string) string {
+	n, _ := strconv.ParseUint(cas, 10, 64)
+	return strconv.FormatUint(n+1, 10)
+}
+
+func TestMemcacheWeightedCapacity(t *testing.T) {
+	cache := lru.NewWeightedCache[string, Item](3*(ItemWeight("k0", Item{Value: make([]byte, 100)})), ItemWeight)
+	addr := startMemcache(t, cache, nil)
+	c := dialMemcache(t, addr)
+
+	value := strings.Repeat("v", 100)
+	for _, key := range []string{"k0", "k1", "k2", "k3"} {
+		c.expect("set "+key+" 0 0 100\r\n"+value+"\r\n", "STORED\r\n")
+	}
+	c.expect("get k0\r\n", "END\r\n")
+	if cache.Len() != 3 || cache.Weight() > cache.MaxWeight {
+		t.Errorf("len %d, weight %d", cache.Len(), cache.Weight())
+	}
+
+	stats := map[string]string{}
+	for line := c.line("stats\r\n"); line != "END\r\n"; line = c.line("") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "STAT" {
+			t.Fatalf("stats: %q", line)
+		}
+		stats[fields[1]] = fields[2]
+	}
+	if stats["evictions"] != "1" || stats["curr_items"] != "3" || stats["bytes"] != strconv.FormatInt(cache.Weight(), 10) {
+		t.Errorf("stats: %v", stats)
+	}
+}
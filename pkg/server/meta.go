@@ -0,0 +1,280 @@
+package server
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metaFlags - флаги мета-команды. Флаг - одна буква, за которой может следовать значение.
+type metaFlags struct {
+	flags  [][]byte
+	quiet  bool
+	opaque []byte
+}
+
+func parseMetaFlags(args [][]byte, allowed string) (metaFlags, error) {
+	f := metaFlags{flags: args}
+	for _, flag := range args {
+		if strings.IndexByte(allowed, flag[0]) < 0 {
+			return f, errClient("invalid flag")
+		}
+		switch flag[0] {
+		case 'q':
+			f.quiet = true
+		case 'O':
+			f.opaque = flag[1:]
+		}
+	}
+	return f, nil
+}
+
+// value возвращает значение флага name.
+func (f metaFlags) value(name byte) ([]byte, bool) {
+	for _, flag := range f.flags {
+		if flag[0] == name {
+			return flag[1:], true
+		}
+	}
+	return nil, false
+}
+
+func (f metaFlags) has(name byte) bool {
+	_, ok := f.value(name)
+	return ok
+}
+
+// number возвращает числовое значение флага name.
+func (f metaFlags) number(name byte) (int64, bool, error) {
+	token, ok := f.value(name)
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := strconv.ParseInt(string(token), 10, 64)
+	if err != nil {
+		return 0, true, errClient("bad token in command line format")
+	}
+	return n, true, nil
+}
+
+// writeReturn дописывает к ответу флаги, которые клиент просил вернуть: O и k.
+func (f metaFlags) writeReturn(c *mcConn, key []byte) {
+	if f.opaque != nil {
+		c.w.WriteString(" O")
+		c.w.Write(f.opaque)
+	}
+	if f.has('k') {
+		c.w.WriteString(" k")
+		c.w.Write(key)
+	}
+}
+
+// metaGet: mg <key> <flags>*
+//
+//	v - вернуть значение, s - размер, f - флаги клиента, c - CAS-токен, t - оставшееся время жизни,
+//	k - ключ, O - непрозрачное значение, q - не отвечать при промахе, T - установить время жизни.
+func (m *Memcache) metaGet(c *mcConn, args [][]byte) error {
+	if len(args) == 0 || len(args[0]) > maxKeyLen {
+		return errBadFormat
+	}
+	key := args[0]
+	flags, err := parseMetaFlags(args[1:], "vsfctkOqT")
+	if err != nil {
+		return err
+	}
+	exptime, touch, err := flags.number('T')
+	if err != nil {
+		return err
+	}
+
+	m.getCmds.Add(1)
+	if touch {
+		m.touchKey(string(key), exptime)
+	}
+	item, ok := m.cache.Get(string(key))
+	if !ok {
+		m.getMisses.Add(1)
+		if !flags.quiet {
+			c.w.WriteString("EN\r\n")
+		}
+		return nil
+	}
+	m.getHits.Add(1)
+
+	withValue := flags.has('v')
+	if withValue {
+		c.w.WriteString("VA ")
+		c.w.WriteString(strconv.Itoa(len(item.Value)))
+	} else {
+		c.w.WriteString("HD")
+	}
+	for _, flag := range flags.flags {
+		switch flag[0] {
+		case 's':
+			c.w.WriteString(" s" + strconv.Itoa(len(item.Value)))
+		case 'f':
+			c.w.WriteString(" f" + strconv.FormatUint(uint64(item.Flags), 10))
+		case 'c':
+			c.w.WriteString(" c" + strconv.FormatUint(item.CAS, 10))
+		case 't':
+			c.w.WriteString(" t" + strconv.FormatInt(m.remaining(string(key)), 10))
+		}
+	}
+	flags.writeReturn(c, key)
+	c.w.WriteString("\r\n")
+	if withValue {
+		c.w.Write(item.Value)
+		c.w.WriteString("\r\n")
+	}
+	return nil
+}
+
+// remaining возвращает оставшееся время жизни в секундах, -1 - без ограничения.
+func (m *Memcache) remaining(key string) int64 {
+	ttl, ok := m.cache.TTL(key)
+	if !ok || ttl == 0 {
+		return -1
+	}
+	return int64((ttl + time.Second/2) / time.Second)
+}
+
+// metaSet: ms <key> <datalen> <flags>*
+//
+//	T - время жизни, F - флаги клиента, C - сравнить CAS-токен, c - вернуть новый CAS-токен,
+//	M - режим: S (set), E (add), R (replace), A (append), P (prepend), q - не отвечать при успехе.
+func (m *Memcache) metaSet(c *mcConn, args [][]byte) error {
+	if len(args) < 2 || len(args[0]) > maxKeyLen {
+		return errBadFormat
+	}
+	key := args[0]
+	size, err := strconv.Atoi(string(args[1]))
+	if err != nil || size < 0 {
+		return errBadFormat
+	}
+	cond, exptime, clientFlags, flags, err := parseMetaSet(args[2:])
+	if err != nil {
+		// Блок данных пропускается, чтобы не рассинхронизировать поток команд
+		if _, derr := c.r.Discard(size + 2); derr != nil {
+			return derr
+		}
+		return err
+	}
+
+	if size > maxItemSize {
+		if _, err := c.r.Discard(size + 2); err != nil {
+			return err
+		}
+		c.w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	value, err := readChunk(c.r, size)
+	if err != nil {
+		return err
+	}
+
+	result, cas := m.set(string(key), value, clientFlags, exptime, cond)
+	if result == stored && flags.quiet {
+		return nil
+	}
+	c.w.WriteString(metaReplies[result])
+	if result == stored && flags.has('c') {
+		c.w.WriteString(" c" + strconv.FormatUint(cas, 10))
+	}
+	flags.writeReturn(c, key)
+	c.w.WriteString("\r\n")
+	return nil
+}
+
+// parseMetaSet разбирает флаги ms.
+func parseMetaSet(args [][]byte) (cond storeCond, exptime int64, clientFlags uint32, flags metaFlags, err error) {
+	flags, err = parseMetaFlags(args, "TFCcMqOk")
+	if err != nil {
+		return
+	}
+	if exptime, _, err = flags.number('T'); err != nil {
+		return
+	}
+	if token, ok := flags.value('F'); ok {
+		n, perr := strconv.ParseUint(string(token), 10, 32)
+		if perr != nil {
+			err = errClient("bad token in command line format")
+			return
+		}
+		clientFlags = uint32(n)
+	}
+	cond.mode = 'S'
+	if token, ok := flags.value('C'); ok {
+		if cond.cas, err = strconv.ParseUint(string(token), 10, 64); err != nil {
+			err = errClient("bad token in command line format")
+			return
+		}
+		cond.checkCAS = true
+	}
+	if mode, ok := flags.value('M'); ok {
+		if len(mode) != 1 || strings.IndexByte("SERAPserap", mode[0]) < 0 {
+			err = errClient("invalid mode for ms")
+			return
+		}
+		cond.mode = bytes.ToUpper(mode)[0]
+	}
+	return
+}
+
+var metaReplies = [...]string{
+	stored:    "HD",
+	notStored: "NS",
+	exists:    "EX",
+	notFound:  "NF",
+}
+
+// metaDelete: md <key> <flags>*
+//
+//	C - удалить при совпадении CAS-токена, q - не отвечать при успехе и промахе.
+func (m *Memcache) metaDelete(c *mcConn, args [][]byte) error {
+	if len(args) == 0 || len(args[0]) > maxKeyLen {
+		return errBadFormat
+	}
+	key := args[0]
+	flags, err := parseMetaFlags(args[1:], "CqOk")
+	if err != nil {
+		return err
+	}
+	var casUnique uint64
+	token, checkCAS := flags.value('C')
+	if checkCAS {
+		if casUnique, err = strconv.ParseUint(string(token), 10, 64); err != nil {
+			return errClient("bad token in command line format")
+		}
+	}
+
+	result := m.deleteKey(string(key), checkCAS, casUnique)
+	if result != exists && flags.quiet {
+		return nil
+	}
+	c.w.WriteString(metaReplies[result])
+	flags.writeReturn(c, key)
+	c.w.WriteString("\r\n")
+	return nil
+}
+
+// deleteKey удаляет ключ, при checkCAS - только при совпадении CAS-токена.
+// Результат stored означает успешное удаление.
+func (m *Memcache) deleteKey(key string, checkCAS bool, casUnique uint64) storeResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if checkCAS {
+		entry, ok := m.cache.GetEntry(key)
+		if !ok {
+			return notFound
+		}
+		if entry.Value.CAS != casUnique {
+			return exists
+		}
+	}
+	if !m.cache.Delete(key) {
+		return notFound
+	}
+	return stored
+}
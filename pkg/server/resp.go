@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// Память под команду выделяется по мере поступления данных, а не по заголовкам длины,
+// поэтому клиент, приславший только заголовки, не занимает больше bulkChunk на аргумент.
+const (
+	// maxArgs - наибольшее число аргументов одной команды
+	maxArgs = 1 << 16
+	// maxBulk - наибольший размер одного аргумента
+	maxBulk = 16 << 20
+	// maxInline - наибольшая длина строки встроенной команды
+	maxInline = 64 << 10
+	// bulkChunk - наибольшая порция аргумента, выделяемая до получения данных
+	bulkChunk = 64 << 10
+)
+
+// errProtocol - клиент нарушил протокол, соединение закрывается.
+var errProtocol = errors.New("protocol error")
+
+// respReader читает команды клиента: массивы строк RESP и встроенные команды вида "PING\r\n".
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRespReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+// buffered сообщает, есть ли уже прочитанные, но не обработанные данные.
+func (r *respReader) buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// readCommand возвращает аргументы следующей команды. Пустые встроенные строки пропускаются.
+// Каждый аргумент размещается в отдельном срезе, поэтому его можно сохранить в кэше.
+func (r *respReader) readCommand() ([][]byte, error) {
+	for {
+		prefix, err := r.r.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if prefix[0] != '*' {
+			args, err := r.readInline()
+			if err != nil || len(args) > 0 {
+				return args, err
+			}
+			continue
+		}
+
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil || n > maxArgs {
+			return nil, errProtocol
+		}
+		if n <= 0 {
+			continue
+		}
+		args := make([][]byte, 0, min(n, 16))
+		for len(args) < n {
+			arg, err := r.readBulk()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		return args, nil
+	}
+}
+
+func (r *respReader) readInline() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	fields := bytes.Fields(line)
+	args := make([][]byte, len(fields))
+	for i, field := range fields {
+		args[i] = bytes.Clone(field)
+	}
+	return args, nil
+}
+
+func (r *respReader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, errProtocol
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulk {
+		return nil, errProtocol
+	}
+	buf := make([]byte, 0, min(n, bulkChunk))
+	for len(buf) < n {
+		chunk := min(n-len(buf), bulkChunk)
+		buf = slices.Grow(buf, chunk)
+		read, err := io.ReadFull(r.r, buf[len(buf):len(buf)+chunk])
+		buf = buf[:len(buf)+read]
+		if err != nil {
+			return nil, err
+		}
+	}
+	var crlf [2]byte
+	if _, err := io.ReadFull(r.r, crlf[:]); err != nil {
+		return nil, err
+	}
+	if crlf != [2]byte{'\r', '\n'} {
+		return nil, errProtocol
+	}
+	return buf[:n:n], nil
+}
+
+// readLine возвращает строку без завершающего "\r\n". Срез действителен до следующего чтения.
+func (r *respReader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, errProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(line) > maxInline {
+		return nil, errProtocol
+	}
+	return bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'}), nil
+}
+
+// respWriter записывает ответы в версии протокола proto (2 или 3).
+// В RESP2 отсутствующие в нем типы заменяются ближайшими: null - пустой строкой $-1,
+// словарь - плоским массивом.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+	buf   []byte
+}
+
+func newRespWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *respWriter) flush() error {
+	return w.w.Flush()
+}
+
+func (w *respWriter) writeSimple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeError(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeInt(n int64) {
+	w.writeHeader(':', n)
+}
+
+func (w *respWriter) writeBulk(b []byte) {
+	w.writeHeader('$', int64(len(b)))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeBulkString(s string) {
+	w.writeHeader('$', int64(len(s)))
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *respWriter) writeNull() {
+	if w.proto >= 3 {
+		w.w.WriteString("_\r\n")
+		return
+	}
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *respWriter) writeArray(n int) {
+	w.writeHeader('*', int64(n))
+}
+
+// writeMap начинает словарь из n пар ключ-значение.
+func (w *respWriter) writeMap(n int) {
+	if w.proto >= 3 {
+		w.writeHeader('%', int64(n))
+		return
+	}
+	w.writeHeader('*', int64(2*n))
+}
+
+// writePush начинает push-сообщение из n элементов (только RESP3).
+func (w *respWriter) writePush(n int) {
+	w.writeHeader('>', int64(n))
+}
+
+func (w *respWriter) writeHeader(prefix byte, n int64) {
+	w.buf = append(w.buf[:0], prefix)
+	w.buf = strconv.AppendInt(w.buf, n, 10)
+	w.buf = append(w.buf, '\r', '\n')
+	w.w.Write(w.buf)
+}
@@ -0,0 +1,262 @@
+// Package server обслуживает кэш по протоколу Redis (RESP2 и RESP3) или memcached.
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrServerClosed возвращает Serve после вызова Close.
+var ErrServerClosed = errors.New("server: closed")
+
+// Backend - кэш, который обслуживает сервер. Его реализуют lru.Cache[string, []byte]
+// и lfu.Cache[string, []byte].
+type Backend interface {
+	Get(key string) ([]byte, bool)
+	Put(key string, value []byte, ttl time.Duration)
+	Delete(key string) bool
+	Contains(key string) bool
+	TTL(key string) (time.Duration, bool)
+	Expire(key string, ttl time.Duration) bool
+	Len() int
+	Clear()
+}
+
+// Server - сервер протокола Redis поверх Backend.
+type Server struct {
+	cache  Backend
+	policy string
+
+	// mu делает атомарными команды из нескольких обращений к кэшу, например SET NX
+	mu sync.Mutex
+
+	conns    tracker
+	started  time.Time
+	nextID   atomic.Int64
+	commands atomic.Int64
+
+	// Отслеживание ключей для кэширования на стороне клиента, см. tracking.go
+	trackMu         sync.Mutex
+	trackedKeys     map[string]map[*client]struct{}
+	trackingClients map[*client]struct{}
+	bcastClients    map[*client]struct{}
+	anyTracking     atomic.Bool
+	evicted         chan string
+	evictOverflow   atomic.Bool
+	stopEvictions   chan struct{}
+	stopOnce        sync.Once
+}
+
+// New создает сервер для cache. policy выводится в INFO. Если cache сообщает о вытеснении,
+// клиенты с CLIENT TRACKING получают invalidate и для вытесненных и истекших ключей.
+func New(cache Backend, policy string) *Server {
+	s := &Server{
+		cache:   cache,
+		policy:  policy,
+		started: time.Now(),
+	}
+	if notifier, ok := cache.(bytesEvictNotifier); ok {
+		s.watchEvictions(notifier)
+	}
+	return s
+}
+
+// ListenAndServe слушает TCP-адрес addr и обслуживает подключения.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve принимает подключения из ln до вызова Close, после которого возвращает ErrServerClosed.
+func (s *Server) Serve(ln net.Listener) error {
+	return s.conns.serve(ln, s.serveConn)
+}
+
+// Addr возвращает адрес, который слушает сервер, или nil до вызова Serve.
+func (s *Server) Addr() net.Addr {
+	return s.conns.addr()
+}
+
+// Close закрывает слушающий сокет и все подключения и ждет завершения их обработки.
+func (s *Server) Close() error {
+	if s.stopEvictions != nil {
+		s.stopOnce.Do(func() { close(s.stopEvictions) })
+	}
+	return s.conns.close()
+}
+
+// tracker принимает подключения и закрывает их при остановке сервера.
+type tracker struct {
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+	accepted atomic.Int64
+}
+
+func (t *tracker) serve(ln net.Listener, handle func(conn net.Conn)) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	t.listener = ln
+	t.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if t.isClosed() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !t.track(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		t.accepted.Add(1)
+		go func() {
+			defer t.untrack(conn)
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
+
+func (t *tracker) addr() net.Addr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Addr()
+}
+
+func (t *tracker) close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	var err error
+	if t.listener != nil {
+		err = t.listener.Close()
+	}
+	for conn := range t.conns {
+		conn.Close()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	return err
+}
+
+func (t *tracker) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.closed
+}
+
+func (t *tracker) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]struct{})
+	}
+	t.conns[conn] = struct{}{}
+	t.wg.Add(1)
+	return true
+}
+
+func (t *tracker) untrack(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// connected возвращает число открытых подключений.
+func (t *tracker) connected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.conns)
+}
+
+// client - состояние одного подключения.
+type client struct {
+	id   int64
+	conn net.Conn
+	r    *respReader
+	// wmu защищает w: push-сообщения пишутся из обработчиков других подключений
+	wmu  sync.Mutex
+	w    *respWriter
+	quit bool
+
+	tracking trackingState
+	// changed и flushed собирают изменения текущей команды для рассылки invalidate
+	changed []string
+	flushed bool
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	c := &client{
+		id:   s.nextID.Add(1),
+		conn: conn,
+		r:    newRespReader(conn),
+		w:    newRespWriter(conn),
+	}
+	defer s.stopTracking(c)
+	for !c.quit {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.wmu.Lock()
+				c.w.writeError("ERR Protocol error")
+				c.w.flush()
+				c.wmu.Unlock()
+			} else if !errors.Is(err, io.EOF) && !s.conns.isClosed() {
+				log.Printf("Ошибка чтения команды от %v: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		s.commands.Add(1)
+		c.wmu.Lock()
+		s.dispatch(c, args)
+		// Ответы на конвейер команд отправляются одной записью
+		var flushErr error
+		if !c.r.buffered() {
+			flushErr = c.w.flush()
+		}
+		c.wmu.Unlock()
+		if flushErr != nil {
+			return
+		}
+
+		if len(c.changed) > 0 || c.flushed {
+			s.invalidate(c, c.changed, c.flushed)
+			c.changed, c.flushed = c.changed[:0], false
+		}
+	}
+	c.wmu.Lock()
+	c.w.flush()
+	c.wmu.Unlock()
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// startServer запускает сервер на локальном порту и останавливает его по завершении теста.
+func startServer(t *testing.T, cache Backend, policy string) (*Server, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(cache, policy)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return s, ln.Addr().String()
+}
+
+// testConn - клиент, возвращающий ответы сервера в сыром виде
+type testConn struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr string) *testConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testConn{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *testConn) send(args ...string) {
+	c.t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// do отправляет команду и возвращает ответ целиком
+func (c *testConn) do(args ...string) string {
+	c.t.Helper()
+	c.send(args...)
+	return c.reply()
+}
+
+func (c *testConn) expect(want string, args ...string) {
+	c.t.Helper()
+	if got := c.do(args...); got != want {
+		c.t.Errorf("%v: got %q, want %q", args, got, want)
+	}
+}
+
+// reply читает один ответ вместе со вложенными элементами
+func (c *testConn) reply() string {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var b strings.Builder
+	b.WriteString(line)
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	switch line[0] {
+	case '$':
+		if n >= 0 {
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, buf); err != nil {
+				c.t.Fatal(err)
+			}
+			b.Write(buf)
+		}
+	case '*', '>':
+		for i := 0; i < n; i++ {
+			b.WriteString(c.reply())
+		}
+	case '%':
+		for i := 0; i < 2*n; i++ {
+			b.WriteString(c.reply())
+		}
+	}
+	return b.String()
+}
+
+func TestServerStrings(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](10), "lru")
+	c := dial(t, addr)
+
+	c.expect("+PONG\r\n", "PING")
+	c.expect("$2\r\nhi\r\n", "PING", "hi")
+	c.expect("$-1\r\n", "GET", "a")
+	c.expect("+OK\r\n", "SET", "a", "1")
+	c.expect("$1\r\n1\r\n", "GET", "a")
+	c.expect("+OK\r\n", "set", "empty", "")
+	c.expect("$0\r\n\r\n", "get", "empty")
+	c.expect(":2\r\n", "EXISTS", "a", "empty", "missing")
+	c.expect(":2\r\n", "DBSIZE")
+	c.expect(":1\r\n", "DEL", "a", "missing")
+	c.expect(":0\r\n", "EXISTS", "a")
+
+	c.expect("-ERR unknown command 'NOPE'\r\n", "NOPE")
+	c.expect("-ERR wrong number of arguments for 'get' command\r\n", "GET")
+	c.expect("-ERR syntax error\r\n", "SET", "a", "1", "BOGUS")
+	c.expect("-ERR invalid expire time in 'set' command\r\n", "SET", "a", "1", "EX", "0")
+	c.expect("-ERR value is not an integer or out of range\r\n", "SET", "a", "1", "PX", "x")
+
+	c.expect("+OK\r\n", "FLUSHALL")
+	c.expect(":0\r\n", "DBSIZE")
+}
+
+func TestServerSetConditions(t *testing.T) {
+	_, addr := startServer(t, lfu.NewCache[string, []byte](10), "lfu")
+	c := dial(t, addr)
+
+	c.expect("$-1\r\n", "SET", "k", "1", "XX")
+	c.expect(":0\r\n", "EXISTS", "k")
+	c.expect("+OK\r\n", "SET", "k", "1", "NX")
+	c.expect("$-1\r\n", "SET", "k", "2", "NX")
+	c.expect("$1\r\n1\r\n", "GET", "k")
+	c.expect("+OK\r\n", "SET", "k", "3", "XX")
+	c.expect("$1\r\n3\r\n", "GET", "k")
+	c.expect("-ERR syntax error\r\n", "SET", "k", "4", "NX", "XX")
+}
+
+func TestServerTTL(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](10), "lru")
+	c := dial(t, addr)
+
+	c.expect(":-2\r\n", "TTL", "k")
+	c.expect("+OK\r\n", "SET", "k", "v")
+	c.expect(":-1\r\n", "TTL", "k")
+	c.expect("+OK\r\n", "SET", "k", "v", "EX", "100")
+	c.expect(":100\r\n", "TTL", "k")
+	// Повторный SET без EX снимает ограничение, как в Redis
+	c.expect("+OK\r\n", "SET", "k", "v")
+	c.expect(":-1\r\n", "PTTL", "k")
+
+	c.expect(":1\r\n", "EXPIRE", "k", "50")
+	c.expect(":50\r\n", "TTL", "k")
+	c.expect(":0\r\n", "EXPIRE", "missing", "50")
+
+	c.expect("+OK\r\n", "SET", "short", "v", "PX", "50")
+	if got := c.do("PTTL", "short"); got == ":-1\r\n" || got == ":-2\r\n" {
+		t.Errorf("PTTL short: got %q", got)
+	}
+	time.Sleep(100 * time.Millisecond)
+	c.expect("$-1\r\n", "GET", "short")
+	c.expect(":-2\r\n", "PTTL", "short")
+
+	// Неположительное время жизни удаляет ключ
+	c.expect(":1\r\n", "EXPIRE", "k", "0")
+	c.expect(":0\r\n", "EXISTS", "k")
+}
+
+func TestServerProtocol(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](10), "lru")
+	c := dial(t, addr)
+
+	// Встроенная команда и конвейер из нескольких команд
+	if _, err := c.conn.Write([]byte("PING\r\n\r\nSET a 1\r\n*2\r\n$3\r\nGET\r\n$1\r\na\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"+PONG\r\n", "+OK\r\n", "$1\r\n1\r\n"} {
+		if got := c.reply(); got != want {
+			t.Errorf("pipeline: got %q, want %q", got, want)
+		}
+	}
+
+	c.expect("-NOPROTO unsupported protocol version\r\n", "HELLO", "4")
+	hello := c.do("HELLO", "3")
+	if !strings.HasPrefix(hello, "%7\r\n") || !strings.Contains(hello, "$5\r\nproto\r\n:3\r\n") {
+		t.Errorf("HELLO 3: got %q", hello)
+	}
+	c.expect("_\r\n", "GET", "missing")
+
+	info := c.do("INFO")
+	for _, want := range []string{"cache_policy:lru", "db0:keys=1", "connected_clients:1"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("INFO does not contain %q: %q", want, info)
+		}
+	}
+
+	c.expect("+OK\r\n", "QUIT")
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("connection is open after QUIT")
+	}
+}
+
+func TestServerProtocolError(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](10), "lru")
+	c := dial(t, addr)
+
+	if _, err := c.conn.Write([]byte("*1\r\n+PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.reply(); got != "-ERR Protocol error\r\n" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("connection is open after protocol error")
+	}
+}
+
+func TestRespReaderLimits(t *testing.T) {
+	// Аргумент из нескольких порций читается целиком
+	value := strings.Repeat("v", 3*bulkChunk+1)
+	r := newRespReader(strings.NewReader(fmt.Sprintf("*2\r\n$3\r\nSET\r\n$%d\r\n%s\r\n", len(value), value)))
+	if args, err := r.readCommand(); err != nil || len(args) != 2 || string(args[1]) != value {
+		t.Fatalf("chunked bulk: %d args, %v", len(args), err)
+	}
+
+	for _, request := range []string{
+		fmt.Sprintf("*%d\r\n", maxArgs+1),
+		fmt.Sprintf("*1\r\n$%d\r\n", maxBulk+1),
+	} {
+		if _, err := newRespReader(strings.NewReader(request)).readCommand(); !errors.Is(err, errProtocol) {
+			t.Errorf("%q: %v, want protocol error", request, err)
+		}
+	}
+
+	// Заголовки без данных не выделяют память под заявленные размеры
+	header := fmt.Sprintf("*%d\r\n$%d\r\nab", maxArgs, maxBulk)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := newRespReader(strings.NewReader(header)).readCommand(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated bulk: %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("headers allocated %d bytes", alloc)
+	}
+}
+
+func TestServerClose(t *testing.T) {
+	s, addr := startServer(t, lru.NewCache[string, []byte](10), "lru")
+	c := dial(t, addr)
+	c.expect("+PONG\r\n", "PING")
+
+	s.Close()
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Error("connection is open after Close")
+	}
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"strings"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Отслеживание ключей для кэширования на стороне клиента (CLIENT TRACKING, RESP3).
+//
+// В обычном режиме сервер запоминает ключи, которые клиент прочитал командой GET, и при
+// изменении ключа один раз отправляет клиенту push-сообщение invalidate; чтобы получить
+// следующее, клиент должен прочитать ключ снова. В режиме BCAST клиент получает сообщения
+// обо всех изменениях ключей с заданными префиксами без запоминания прочитанных ключей.
+// После FLUSHALL и при переполнении очереди вытеснений клиентам отправляется invalidate
+// с null: все локальные копии устарели.
+
+// trackingState - настройки отслеживания клиента. Защищены Server.trackMu.
+type trackingState struct {
+	on       bool
+	bcast    bool
+	noloop   bool
+	prefixes []string
+	keys     map[string]struct{} // прочитанные ключи в обычном режиме
+}
+
+// bytesEvictNotifier реализуют кэши, сообщающие о вытеснении.
+type bytesEvictNotifier interface {
+	OnEvict(fn func(e pkg.Eviction[string, []byte]))
+}
+
+// evictionQueue - размер очереди вытесненных ключей для рассылки invalidate.
+const evictionQueue = 4096
+
+// watchEvictions рассылает invalidate для ключей, вытесненных кэшем или истекших.
+// Обработчик вызывается под блокировкой кэша, поэтому только ставит ключ в очередь.
+func (s *Server) watchEvictions(notifier bytesEvictNotifier) {
+	s.evicted = make(chan string, evictionQueue)
+	s.stopEvictions = make(chan struct{})
+	notifier.OnEvict(func(e pkg.Eviction[string, []byte]) {
+		if !s.anyTracking.Load() {
+			return
+		}
+		select {
+		case s.evicted <- e.Key:
+		default:
+			s.evictOverflow.Store(true)
+		}
+	})
+	go func() {
+		for {
+			select {
+			case key := <-s.evicted:
+				s.invalidate(nil, []string{key}, s.evictOverflow.Swap(false))
+			case <-s.stopEvictions:
+				return
+			}
+		}
+	}()
+}
+
+// trackRead запоминает ключ, прочитанный клиентом в обычном режиме отслеживания.
+func (s *Server) trackRead(c *client, key string) {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+
+	if !c.tracking.on || c.tracking.bcast {
+		return
+	}
+	if s.trackedKeys == nil {
+		s.trackedKeys = make(map[string]map[*client]struct{})
+	}
+	clients := s.trackedKeys[key]
+	if clients == nil {
+		clients = make(map[*client]struct{})
+		s.trackedKeys[key] = clients
+	}
+	clients[c] = struct{}{}
+	c.tracking.keys[key] = struct{}{}
+}
+
+// keyChanged отмечает изменение ключа командой клиента. Сообщения рассылаются после ответа
+// на команду, когда клиент уже не держит блокировку записи своего подключения.
+func (c *client) keyChanged(key string) {
+	c.changed = append(c.changed, key)
+}
+
+// invalidate рассылает сообщения об изменении keys или, при all, обо всех ключах.
+// from - клиент, изменивший ключи, или nil.
+func (s *Server) invalidate(from *client, keys []string, all bool) {
+	if !s.anyTracking.Load() {
+		return
+	}
+	targets := make(map[*client][]string)
+	flush := make(map[*client]struct{})
+
+	s.trackMu.Lock()
+	if all {
+		for c := range s.trackingClients {
+			flush[c] = struct{}{}
+			clear(c.tracking.keys)
+		}
+		clear(s.trackedKeys)
+	}
+	for _, key := range keys {
+		for c := range s.trackedKeys[key] {
+			delete(c.tracking.keys, key)
+			if !(c == from && c.tracking.noloop) {
+				targets[c] = append(targets[c], key)
+			}
+		}
+		delete(s.trackedKeys, key)
+		for c := range s.bcastClients {
+			if c == from && c.tracking.noloop {
+				continue
+			}
+			if c.tracking.matches(key) {
+				targets[c] = append(targets[c], key)
+			}
+		}
+	}
+	s.trackMu.Unlock()
+
+	for c := range flush {
+		c.push(nil)
+		delete(targets, c)
+	}
+	for c, keys := range targets {
+		c.push(keys)
+	}
+}
+
+func (t *trackingState) matches(key string) bool {
+	if len(t.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range t.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// push отправляет клиенту сообщение invalidate. keys == nil - все ключи.
+func (c *client) push(keys []string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.w.writePush(2)
+	c.w.writeBulkString("invalidate")
+	if keys == nil {
+		c.w.writeNull()
+	} else {
+		c.w.writeArray(len(keys))
+		for _, key := range keys {
+			c.w.writeBulkString(key)
+		}
+	}
+	c.w.flush()
+}
+
+// startTracking включает отслеживание для клиента с новыми настройками.
+func (s *Server) startTracking(c *client, state trackingState) {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+
+	s.stopTrackingLocked(c)
+	state.on = true
+	state.keys = make(map[string]struct{})
+	c.tracking = state
+	if s.trackingClients == nil {
+		s.trackingClients = make(map[*client]struct{})
+		s.bcastClients = make(map[*client]struct{})
+	}
+	s.trackingClients[c] = struct{}{}
+	if state.bcast {
+		s.bcastClients[c] = struct{}{}
+	}
+	s.anyTracking.Store(true)
+}
+
+// stopTracking выключает отслеживание, например при отключении клиента.
+func (s *Server) stopTracking(c *client) {
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+
+	s.stopTrackingLocked(c)
+}
+
+func (s *Server) stopTrackingLocked(c *client) {
+	if !c.tracking.on {
+		return
+	}
+	for key := range c.tracking.keys {
+		if clients := s.trackedKeys[key]; clients != nil {
+			delete(clients, c)
+			if len(clients) == 0 {
+				delete(s.trackedKeys, key)
+			}
+		}
+	}
+	delete(s.trackingClients, c)
+	delete(s.bcastClients, c)
+	c.tracking = trackingState{}
+	s.anyTracking.Store(len(s.trackingClients) > 0)
+}
+
+// clientTracking: CLIENT TRACKING ON|OFF [BCAST] [PREFIX prefix ...] [NOLOOP]
+func (s *Server) clientTracking(c *client, args [][]byte) {
+	if len(args) < 3 {
+		c.w.writeError("ERR wrong number of arguments for 'client|tracking' command")
+		return
+	}
+	var state trackingState
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "bcast":
+			state.bcast = true
+		case "noloop":
+			state.noloop = true
+		case "prefix":
+			if i+1 >= len(args) {
+				c.w.writeError("ERR syntax error")
+				return
+			}
+			state.prefixes = append(state.prefixes, string(args[i+1]))
+			i++
+		case "redirect", "optin", "optout":
+			c.w.writeError("ERR " + strings.ToUpper(string(args[i])) + " is not supported")
+			return
+		default:
+			c.w.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	switch strings.ToLower(string(args[2])) {
+	case "on":
+		if c.w.proto < 3 {
+			c.w.writeError("ERR tracking requires RESP3, switch with HELLO 3")
+			return
+		}
+		if len(state.prefixes) > 0 && !state.bcast {
+			c.w.writeError("ERR PREFIX option requires BCAST mode to be enabled")
+			return
+		}
+		s.startTracking(c, state)
+	case "off":
+		s.stopTracking(c)
+	default:
+		c.w.writeError("ERR syntax error")
+		return
+	}
+	c.w.writeSimple("OK")
+}
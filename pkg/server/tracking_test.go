@@ -0,0 +1,140 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+func TestServerTrackingProtocol(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](100), "lru")
+	reader := dial(t, addr)
+	writer := dial(t, addr)
+
+	reader.expect("-ERR tracking requires RESP3, switch with HELLO 3\r\n", "CLIENT", "TRACKING", "ON")
+	reader.do("HELLO", "3")
+	reader.expect("-ERR PREFIX option requires BCAST mode to be enabled\r\n", "CLIENT", "TRACKING", "ON", "PREFIX", "a")
+	reader.expect("+OK\r\n", "CLIENT", "TRACKING", "ON")
+	reader.expect("_\r\n", "GET", "a")
+
+	// Сообщение отправляется один раз, пока ключ не прочитан снова
+	writer.expect("+OK\r\n", "SET", "a", "1")
+	writer.expect("+OK\r\n", "SET", "a", "2")
+	reader.expect(">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\na\r\n", "GET", "a")
+	if got := reader.reply(); got != "$1\r\n2\r\n" {
+		t.Errorf("GET reply %q", got)
+	}
+
+	writer.expect("+OK\r\n", "FLUSHALL")
+	if got := reader.reply(); got != ">2\r\n$10\r\ninvalidate\r\n_\r\n" {
+		t.Errorf("flush push %q", got)
+	}
+
+	reader.expect("+OK\r\n", "CLIENT", "TRACKING", "OFF")
+	reader.do("GET", "a")
+	writer.expect("+OK\r\n", "SET", "a", "3")
+	reader.expect("+PONG\r\n", "PING")
+}
+
+func TestServerTrackingBroadcast(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](100), "lru")
+	reader := dial(t, addr)
+	reader.do("HELLO", "3")
+	reader.expect("+OK\r\n", "CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "user:", "NOLOOP")
+
+	writer := dial(t, addr)
+	writer.do("SET", "other", "x")
+	writer.do("SET", "user:1", "x")
+	if got := reader.reply(); got != ">2\r\n$10\r\ninvalidate\r\n*1\r\n$6\r\nuser:1\r\n" {
+		t.Errorf("bcast push %q", got)
+	}
+
+	// NOLOOP: собственные изменения не рассылаются
+	reader.expect("+OK\r\n", "SET", "user:2", "x")
+	reader.expect("+PONG\r\n", "PING")
+}
+
+func dialClient(t *testing.T, addr string, opts ClientOptions) *Client {
+	t.Helper()
+	c, err := Dial(addr, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func waitStats(t *testing.T, c *Client, cond func(ClientStats) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(c.Stats()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("stats %+v", c.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestClientNearCache(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](3), "lru")
+	near := dialClient(t, addr, ClientOptions{NearCacheSize: 10})
+	plain := dialClient(t, addr, ClientOptions{})
+
+	if err := plain.Set("k", []byte("v1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if value, ok, err := near.Get("k"); err != nil || !ok || string(value) != "v1" {
+			t.Fatalf("Get = %q %v %v", value, ok, err)
+		}
+	}
+	if stats := near.Stats(); stats.NearMisses != 1 || stats.NearHits != 2 {
+		t.Errorf("stats %+v", stats)
+	}
+
+	plain.Set("k", []byte("v2"), 0)
+	waitStats(t, near, func(s ClientStats) bool { return s.Invalidations == 1 })
+	if value, _, _ := near.Get("k"); string(value) != "v2" {
+		t.Errorf("after invalidation Get = %q", value)
+	}
+
+	// Вытеснение на сервере тоже рассылается
+	for _, key := range []string{"a", "b", "c"} {
+		plain.Set(key, []byte("x"), 0)
+	}
+	waitStats(t, near, func(s ClientStats) bool { return s.Invalidations == 2 })
+
+	// Разрыв соединения сбрасывает локальный кэш, следующая команда подключается заново
+	near.Get("c")
+	near.mu.Lock()
+	near.conn.Close()
+	near.mu.Unlock()
+	waitStats(t, near, func(s ClientStats) bool { return s.Flushes == 1 })
+	if near.near.Len() != 0 {
+		t.Errorf("%d entries survived disconnect", near.near.Len())
+	}
+	if value, ok, err := near.Get("c"); err != nil || !ok || string(value) != "x" || near.Stats().Connects != 2 {
+		t.Errorf("after reconnect Get = %q %v %v, stats %+v", value, ok, err, near.Stats())
+	}
+}
+
+func TestClientBroadcast(t *testing.T) {
+	_, addr := startServer(t, lru.NewCache[string, []byte](100), "lru")
+	near := dialClient(t, addr, ClientOptions{NearCacheSize: 10, Broadcast: true, Prefixes: []string{"user:"}})
+	plain := dialClient(t, addr, ClientOptions{})
+
+	plain.Set("user:1", []byte("a"), time.Minute)
+	plain.Set("other", []byte("b"), 0)
+	plain.Set("user:2", []byte("c"), 0)
+	waitStats(t, near, func(s ClientStats) bool { return s.Invalidations == 2 })
+
+	if _, err := plain.Do("FLUSHALL"); err != nil {
+		t.Fatal(err)
+	}
+	waitStats(t, near, func(s ClientStats) bool { return s.Flushes == 1 })
+
+	if _, err := plain.Do("NOSUCH"); err == nil {
+		t.Error("error reply not returned")
+	}
+}
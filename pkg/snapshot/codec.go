@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec кодирует ключи или значения кэша в байты снимка.
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(data []byte, v *T) error
+}
+
+// Gob кодирует значения через encoding/gob. Используется по умолчанию.
+type Gob[T any] struct{}
+
+func (Gob[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob[T]) Unmarshal(data []byte, v *T) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// JSON кодирует значения через encoding/json.
+type JSON[T any] struct{}
+
+func (JSON[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSON[T]) Unmarshal(data []byte, v *T) error {
+	return json.Unmarshal(data, v)
+}
+
+// BinaryMarshaler описывает указатель на T, реализующий encoding.BinaryMarshaler
+// и encoding.BinaryUnmarshaler.
+type BinaryMarshaler[T any] interface {
+	*T
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Binary кодирует значения их собственными методами MarshalBinary и UnmarshalBinary.
+type Binary[T any, P BinaryMarshaler[T]] struct{}
+
+func (Binary[T, P]) Marshal(v T) ([]byte, error) {
+	return P(&v).MarshalBinary()
+}
+
+func (Binary[T, P]) Unmarshal(data []byte, v *T) error {
+	return P(v).UnmarshalBinary(data)
+}
@@ -0,0 +1,294 @@
+// Package snapshot реализует формат снимков содержимого кэша.
+//
+// Снимок начинается с заголовка (магическая строка, версия, имя политики вытеснения,
+// время сохранения в наносекундах Unix), затем идут записи в порядке восстановления, завершает снимок количество записей
+// и контрольная сумма CRC-32 (Castagnoli) всех предыдущих байт.
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"slices"
+	"time"
+)
+
+// Version - версия формата снимка. Снимки других версий не читаются.
+const Version = 1
+
+const (
+	magic        = "CSEVSNAP"
+	tagRecord    = 1
+	tagEnd       = 0
+	maxFieldSize = 1 << 30
+	// fieldChunk - наибольшая часть поля, память под которую выделяется до чтения данных.
+	// Поле растет по мере чтения, поэтому длина из поврежденного снимка не приводит
+	// к выделению памяти больше размера самого снимка.
+	fieldChunk = 64 << 10
+)
+
+var (
+	ErrFormat   = errors.New("snapshot: invalid format")
+	ErrVersion  = errors.New("snapshot: unsupported version")
+	ErrChecksum = errors.New("snapshot: checksum mismatch")
+	// ErrPolicy возвращает LoadFrom кэша, если снимок сохранен другой политикой вытеснения.
+	ErrPolicy = errors.New("snapshot: policy mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Header - заголовок снимка.
+type Header struct {
+	Policy string
+	// SavedAt - время сохранения. При нулевом значении TTL записей не пересчитывается.
+	SavedAt time.Time
+}
+
+// Remaining возвращает время жизни записи с TTL ttl, оставшееся к моменту now с учетом
+// времени, прошедшего после сохранения, и false, если запись истекла. 0 - без ограничения.
+func (h Header) Remaining(ttl time.Duration, now time.Time) (time.Duration, bool) {
+	if ttl == 0 {
+		return 0, true
+	}
+	if !h.SavedAt.IsZero() {
+		ttl -= max(now.Sub(h.SavedAt), 0)
+	}
+	return ttl, ttl > 0
+}
+
+// Record - запись снимка.
+// TTL - время жизни, оставшееся на момент сохранения, 0 - без ограничения.
+// Freq - частота обращений для LFU.
+type Record[KeyT any, ValueT any] struct {
+	Key   KeyT
+	Value ValueT
+	TTL   time.Duration
+	Freq  int
+}
+
+// Writer последовательно пишет записи снимка.
+type Writer[KeyT any, ValueT any] struct {
+	out    *bufio.Writer
+	crc    hash.Hash32
+	keys   Codec[KeyT]
+	values Codec[ValueT]
+	count  uint64
+	buf    []byte
+}
+
+// NewWriter пишет заголовок снимка в w. Нулевые кодеки заменяются на Gob.
+func NewWriter[KeyT any, ValueT any](w io.Writer, h Header, keys Codec[KeyT], values Codec[ValueT]) (*Writer[KeyT, ValueT], error) {
+	if keys == nil {
+		keys = Gob[KeyT]{}
+	}
+	if values == nil {
+		values = Gob[ValueT]{}
+	}
+	sw := &Writer[KeyT, ValueT]{
+		out:    bufio.NewWriter(w),
+		crc:    crc32.New(castagnoli),
+		keys:   keys,
+		values: values,
+	}
+
+	sw.buf = append(sw.buf, magic...)
+	sw.buf = binary.BigEndian.AppendUint16(sw.buf, Version)
+	sw.buf = appendBytes(sw.buf, []byte(h.Policy))
+	var savedAt int64
+	if !h.SavedAt.IsZero() {
+		savedAt = h.SavedAt.UnixNano()
+	}
+	sw.buf = binary.AppendVarint(sw.buf, savedAt)
+	return sw, sw.flushBuf()
+}
+
+// Write добавляет запись в снимок.
+func (w *Writer[KeyT, ValueT]) Write(rec Record[KeyT, ValueT]) error {
+	key, err := w.keys.Marshal(rec.Key)
+	if err != nil {
+		return fmt.Errorf("snapshot: encode key: %w", err)
+	}
+	value, err := w.values.Marshal(rec.Value)
+	if err != nil {
+		return fmt.Errorf("snapshot: encode value: %w", err)
+	}
+
+	w.buf = append(w.buf, tagRecord)
+	w.buf = appendBytes(w.buf, key)
+	w.buf = appendBytes(w.buf, value)
+	w.buf = binary.AppendVarint(w.buf, int64(rec.TTL))
+	w.buf = binary.AppendUvarint(w.buf, uint64(rec.Freq))
+	w.count++
+	return w.flushBuf()
+}
+
+// Close дописывает количество записей и контрольную сумму. Нижележащий io.Writer не закрывается.
+func (w *Writer[KeyT, ValueT]) Close() error {
+	w.buf = append(w.buf, tagEnd)
+	w.buf = binary.AppendUvarint(w.buf, w.count)
+	if err := w.flushBuf(); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(binary.BigEndian.AppendUint32(nil, w.crc.Sum32())); err != nil {
+		return err
+	}
+	return w.out.Flush()
+}
+
+func (w *Writer[KeyT, ValueT]) flushBuf() error {
+	w.crc.Write(w.buf)
+	_, err := w.out.Write(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+func appendBytes(buf []byte, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// Read читает снимок целиком и проверяет контрольную сумму до того, как вернуть записи,
+// поэтому поврежденный снимок не попадает в кэш частично.
+func Read[KeyT any, ValueT any](r io.Reader, keys Codec[KeyT], values Codec[ValueT]) (h Header, records []Record[KeyT, ValueT], err error) {
+	if keys == nil {
+		keys = Gob[KeyT]{}
+	}
+	if values == nil {
+		values = Gob[ValueT]{}
+	}
+	cr := &crcReader{r: bufio.NewReader(r)}
+
+	head := make([]byte, len(magic)+2)
+	if _, err := io.ReadFull(cr, head); err != nil {
+		return Header{}, nil, formatErr(err)
+	}
+	if string(head[:len(magic)]) != magic {
+		return Header{}, nil, ErrFormat
+	}
+	version := binary.BigEndian.Uint16(head[len(magic):])
+	if version != Version {
+		return h, nil, fmt.Errorf("%w: %d", ErrVersion, version)
+	}
+	name, err := readBytes(cr)
+	if err != nil {
+		return h, nil, err
+	}
+	h.Policy = string(name)
+	savedAt, err := binary.ReadVarint(cr)
+	if err != nil {
+		return h, nil, formatErr(err)
+	}
+	if savedAt != 0 {
+		h.SavedAt = time.Unix(0, savedAt)
+	}
+
+	for {
+		tag, err := cr.ReadByte()
+		if err != nil {
+			return Header{}, nil, formatErr(err)
+		}
+		if tag == tagEnd {
+			break
+		}
+		if tag != tagRecord {
+			return Header{}, nil, ErrFormat
+		}
+
+		var rec Record[KeyT, ValueT]
+		key, err := readBytes(cr)
+		if err != nil {
+			return Header{}, nil, err
+		}
+		value, err := readBytes(cr)
+		if err != nil {
+			return Header{}, nil, err
+		}
+		ttl, err := binary.ReadVarint(cr)
+		if err != nil {
+			return Header{}, nil, formatErr(err)
+		}
+		freq, err := binary.ReadUvarint(cr)
+		if err != nil {
+			return Header{}, nil, formatErr(err)
+		}
+		if err := keys.Unmarshal(key, &rec.Key); err != nil {
+			return Header{}, nil, fmt.Errorf("snapshot: decode key: %w", err)
+		}
+		if err := values.Unmarshal(value, &rec.Value); err != nil {
+			return Header{}, nil, fmt.Errorf("snapshot: decode value: %w", err)
+		}
+		rec.TTL = time.Duration(ttl)
+		rec.Freq = int(freq)
+		records = append(records, rec)
+	}
+
+	count, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return Header{}, nil, formatErr(err)
+	}
+	sum := cr.crc
+	tail := make([]byte, 4)
+	if _, err := io.ReadFull(cr.r, tail); err != nil {
+		return Header{}, nil, formatErr(err)
+	}
+	if binary.BigEndian.Uint32(tail) != sum {
+		return Header{}, nil, ErrChecksum
+	}
+	if count != uint64(len(records)) {
+		return Header{}, nil, ErrFormat
+	}
+	return h, records, nil
+}
+
+func readBytes(cr *crcReader) ([]byte, error) {
+	n, err := binary.ReadUvarint(cr)
+	if err != nil {
+		return nil, formatErr(err)
+	}
+	if n > maxFieldSize {
+		return nil, ErrFormat
+	}
+	data := make([]byte, 0, min(n, fieldChunk))
+	for uint64(len(data)) < n {
+		chunk := int(min(n-uint64(len(data)), fieldChunk))
+		data = slices.Grow(data, chunk)
+		read, err := io.ReadFull(cr, data[len(data):len(data)+chunk])
+		data = data[:len(data)+read]
+		if err != nil {
+			return nil, formatErr(err)
+		}
+	}
+	return data, nil
+}
+
+// formatErr превращает преждевременный конец потока в ErrFormat.
+func formatErr(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", ErrFormat, io.ErrUnexpectedEOF)
+	}
+	return err
+}
+
+// crcReader считает контрольную сумму прочитанных байт.
+type crcReader struct {
+	r   *bufio.Reader
+	crc uint32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc = crc32.Update(c.crc, castagnoli, p[:n])
+	return n, err
+}
+
+func (c *crcReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.crc = crc32.Update(c.crc, castagnoli, []byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,117 @@
+package snapshot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X, Y int32
+}
+
+func (p *point) MarshalBinary() ([]byte, error) {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(p.X))
+	return binary.BigEndian.AppendUint32(buf, uint32(p.Y)), nil
+}
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("point: invalid length")
+	}
+	p.X = int32(binary.BigEndian.Uint32(data))
+	p.Y = int32(binary.BigEndian.Uint32(data[4:]))
+	return nil
+}
+
+func writeSnapshot[KeyT any, ValueT any](t *testing.T, keys Codec[KeyT], values Codec[ValueT], records ...Record[KeyT, ValueT]) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Policy: "test"}, keys, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range records {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	records := []Record[string, point]{
+		{Key: "a", Value: point{1, 2}, TTL: time.Second, Freq: 3},
+		{Key: "b", Value: point{-4, 5}},
+	}
+
+	for name, values := range map[string]Codec[point]{
+		"gob":    Gob[point]{},
+		"json":   JSON[point]{},
+		"binary": Binary[point, *point]{},
+	} {
+		data := writeSnapshot(t, JSON[string]{}, values, records...)
+
+		h, got, err := Read(bytes.NewReader(data), JSON[string]{}, values)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if h.Policy != "test" || len(got) != len(records) {
+			t.Fatalf("%s: expected %d records of policy test, got %d of %q", name, len(records), len(got), h.Policy)
+		}
+		for i := range records {
+			if got[i] != records[i] {
+				t.Errorf("%s: expected %+v, got %+v", name, records[i], got[i])
+			}
+		}
+	}
+}
+
+func TestReadDetectsCorruption(t *testing.T) {
+	data := writeSnapshot[int, string](t, nil, nil, Record[int, string]{Key: 1, Value: "value1"})
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-6] ^= 0xff
+	if _, _, err := Read[int, string](bytes.NewReader(corrupted), nil, nil); err == nil {
+		t.Error("Expected error for corrupted snapshot")
+	}
+
+	if _, _, err := Read[int, string](bytes.NewReader(data[:len(data)-1]), nil, nil); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat for truncated snapshot, got %v", err)
+	}
+
+	badVersion := bytes.Clone(data)
+	binary.BigEndian.PutUint16(badVersion[len(magic):], Version+1)
+	if _, _, err := Read[int, string](bytes.NewReader(badVersion), nil, nil); !errors.Is(err, ErrVersion) {
+		t.Errorf("Expected ErrVersion, got %v", err)
+	}
+}
+
+func TestReadHugeFieldLength(t *testing.T) {
+	data := []byte(magic)
+	data = binary.BigEndian.AppendUint16(data, Version)
+	data = binary.AppendUvarint(data, maxFieldSize) // имя политики без данных
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, _, err := Read[int, string](bytes.NewReader(data), nil, nil); !errors.Is(err, ErrFormat) {
+		t.Errorf("Expected ErrFormat, got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 1<<20 {
+		t.Errorf("truncated field allocated %d bytes", alloc)
+	}
+
+	// Поле из нескольких частей читается целиком
+	value := string(bytes.Repeat([]byte("v"), 3*fieldChunk+1))
+	big := writeSnapshot[int, string](t, nil, JSON[string]{}, Record[int, string]{Key: 1, Value: value})
+	if _, got, err := Read[int, string](bytes.NewReader(big), nil, JSON[string]{}); err != nil || len(got) != 1 || got[0].Value != value {
+		t.Errorf("chunked field: %d records, %v", len(got), err)
+	}
+}
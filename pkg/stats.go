@@ -0,0 +1,179 @@
+package pkg
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+)
+
+// Stats - счетчики кэша с момента создания. Clear и LoadFrom их не сбрасывают.
+type Stats struct {
+	Hits       int64
+	Misses     int64
+	Evictions  [EvictExpired + 1]int64 // по причинам, индекс - EvictReason
+	Len        int
+	Weight     int64
+	LoadErrors int64
+
+	// Длительность операций вместе с ожиданием блокировки. При выборочной записи
+	// Count оценивает полное число операций. LoadLatency - длительность вызовов
+	// загрузчика GetOrLoad, они записываются всегда.
+	GetLatency  LatencySnapshot
+	PutLatency  LatencySnapshot
+	LoadLatency LatencySnapshot
+}
+
+// Merge добавляет к s счетчики other, например чтобы получить статистику нескольких шардов.
+func (s *Stats) Merge(other Stats) {
+	s.Hits += other.Hits
+	s.Misses += other.Misses
+	for i := range s.Evictions {
+		s.Evictions[i] += other.Evictions[i]
+	}
+	s.Len += other.Len
+	s.Weight += other.Weight
+	s.LoadErrors += other.LoadErrors
+	s.GetLatency.Merge(other.GetLatency)
+	s.PutLatency.Merge(other.PutLatency)
+	s.LoadLatency.Merge(other.LoadLatency)
+}
+
+// Counters собирает счетчики Stats без блокировок. Нулевое значение готово к использованию.
+type Counters struct {
+	hits       atomic.Int64
+	misses     atomic.Int64
+	evictions  [EvictExpired + 1]atomic.Int64
+	loadErrors atomic.Int64
+
+	getLatency  LatencyHistogram
+	putLatency  LatencyHistogram
+	loadLatency LatencyHistogram
+	// every - одна записанная операция из every: 0 - DefaultLatencySampling, -1 - запись отключена
+	every atomic.Int32
+}
+
+// DefaultLatencySampling - выборка записи длительности Get и Put по умолчанию:
+// два вызова time.Now на каждую операцию заметно замедляют попадание в кэш.
+const DefaultLatencySampling = 16
+
+// SetSampling задает выборочную запись длительности Get и Put: одна операция из every,
+// 1 - каждая операция, 0 и меньше - запись отключена. Загрузки записываются всегда.
+func (c *Counters) SetSampling(every int) {
+	if every <= 0 {
+		c.every.Store(-1)
+		return
+	}
+	c.every.Store(int32(min(every, math.MaxInt32)))
+}
+
+// sampling возвращает текущую выборку или 0, если запись отключена.
+func (c *Counters) sampling() uint32 {
+	switch every := c.every.Load(); {
+	case every == 0:
+		return DefaultLatencySampling
+	case every < 0:
+		return 0
+	default:
+		return uint32(every)
+	}
+}
+
+// Start возвращает время начала операции или нулевое время, если операция не попала в выборку.
+func (c *Counters) Start() time.Time {
+	every := c.sampling()
+	if every == 0 || (every > 1 && rand.Uint32N(every) != 0) {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// GetDone записывает длительность Get, начатого в start.
+func (c *Counters) GetDone(start time.Time) {
+	c.observe(&c.getLatency, start)
+}
+
+// PutDone записывает длительность Put, начатого в start.
+func (c *Counters) PutDone(start time.Time) {
+	c.observe(&c.putLatency, start)
+}
+
+func (c *Counters) observe(h *LatencyHistogram, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	h.Observe(time.Since(start), int64(max(c.sampling(), 1)))
+}
+
+// Hit учитывает попадание.
+func (c *Counters) Hit() {
+	c.hits.Add(1)
+}
+
+// Miss учитывает промах.
+func (c *Counters) Miss() {
+	c.misses.Add(1)
+}
+
+// Evicted учитывает удаление элемента кэшем по причине reason.
+func (c *Counters) Evicted(reason EvictReason) {
+	if int(reason) < len(c.evictions) {
+		c.evictions[reason].Add(1)
+	}
+}
+
+// Loaded учитывает вызов загрузчика длительностью d.
+func (c *Counters) Loaded(d time.Duration, err error) {
+	c.loadLatency.Observe(d, 1)
+	if err != nil {
+		c.loadErrors.Add(1)
+	}
+}
+
+// Stats возвращает значения счетчиков. Len и Weight заполняет кэш.
+func (c *Counters) Stats() Stats {
+	st := Stats{
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		LoadErrors: c.loadErrors.Load(),
+
+		GetLatency:  c.getLatency.Snapshot(),
+		PutLatency:  c.putLatency.Snapshot(),
+		LoadLatency: c.loadLatency.Snapshot(),
+	}
+	for i := range c.evictions {
+		st.Evictions[i] = c.evictions[i].Load()
+	}
+	return st
+}
+
+// LoadBuckets - верхние границы корзин гистограммы длительности загрузки,
+// см. LatencySnapshot.Histogram.
+var LoadBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// HistogramSnapshot - гистограмма с заданными границами. Counts[i] - число наблюдений
+// не больше Bounds[i] и больше предыдущей границы, последний элемент Counts - наблюдения
+// больше всех границ.
+type HistogramSnapshot struct {
+	Bounds []time.Duration
+	Counts []int64
+	Count  int64
+	Sum    time.Duration
+}
@@ -0,0 +1,258 @@
+// Package tiered объединяет два кэша в двухуровневый: небольшой быстрый L1
+// перед большим или удаленным L2.
+package tiered
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Cacher - уровень кэша. Совпадает с интерфейсом Cacher корневого пакета,
+// поэтому уровнем может быть lru.Cache, lfu.Cache или другой tiered.Cache.
+type Cacher[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+}
+
+// Deleter реализуют уровни, поддерживающие удаление. Без него исключающий режим
+// и запись в обход L1 не могут убрать устаревшую копию.
+type Deleter[KeyT comparable] interface {
+	Delete(key KeyT) bool
+}
+
+// TTLer реализуют уровни, сообщающие оставшееся время жизни ключа, например lru.Cache
+// и lfu.Cache. Без него элемент, перенесенный из L2 в L1, живет PromoteTTL.
+type TTLer[KeyT comparable] interface {
+	TTL(key KeyT) (time.Duration, bool)
+}
+
+// evictNotifier реализуют уровни, сообщающие о вытеснении, например lru.Cache и lfu.Cache.
+type evictNotifier[KeyT comparable, ValueT any] interface {
+	OnEvict(fn func(e pkg.Eviction[KeyT, ValueT]))
+}
+
+// WritePolicy определяет, на какие уровни попадает Put.
+type WritePolicy int
+
+const (
+	// WriteThrough записывает значение в L1, а во включающем режиме - и в L2.
+	WriteThrough WritePolicy = iota
+	// WriteAround записывает значение только в L2 и удаляет копию из L1.
+	WriteAround
+)
+
+// Mode определяет, может ли элемент храниться на обоих уровнях одновременно.
+type Mode int
+
+const (
+	// Inclusive - L1 содержит копии элементов L2.
+	Inclusive Mode = iota
+	// Exclusive - элемент хранится только на одном уровне: при переносе в L1 он удаляется
+	// из L2, а вытесненный из L1 элемент переносится в L2.
+	Exclusive
+)
+
+// Options - настройки двухуровневого кэша. Нулевое значение - включающий режим
+// со сквозной записью без переноса в L1 при чтении.
+type Options struct {
+	Mode  Mode
+	Write WritePolicy
+	// Promote переносит найденный в L2 элемент в L1.
+	Promote bool
+	// PromoteTTL - наибольшее время жизни элемента, перенесенного в L1. Если L2 реализует
+	// TTLer, элемент не переживает свою копию в L2. 0 - без ограничения.
+	PromoteTTL time.Duration
+	// Clock - часы, по которым считается оставшийся срок жизни элемента при переносе
+	// в L2. Совпадают с часами уровней, по умолчанию pkg.SystemClock.
+	Clock pkg.Clock
+}
+
+// LevelStats - счетчики одного уровня.
+type LevelStats struct {
+	Hits   int64
+	Misses int64
+	Puts   int64
+}
+
+// Stats - счетчики двухуровневого кэша.
+type Stats struct {
+	L1         LevelStats
+	L2         LevelStats
+	Promotions int64 // элементы, перенесенные из L2 в L1
+	Demotions  int64 // элементы, вытесненные из L1 в L2
+}
+
+type levelCounters struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+	puts   atomic.Int64
+}
+
+func (l *levelCounters) stats() LevelStats {
+	return LevelStats{Hits: l.hits.Load(), Misses: l.misses.Load(), Puts: l.puts.Load()}
+}
+
+// Cache - двухуровневый кэш, реализующий интерфейс Cacher.
+type Cache[KeyT comparable, ValueT any] struct {
+	l1   Cacher[KeyT, ValueT]
+	l2   Cacher[KeyT, ValueT]
+	opts Options
+
+	// mu упорядочивает перенос элементов между уровнями с записью и удалением
+	mu sync.Mutex
+
+	l1Stats    levelCounters
+	l2Stats    levelCounters
+	promotions atomic.Int64
+	demotions  atomic.Int64
+}
+
+// New объединяет l1 и l2. В исключающем режиме вытесненные из l1 элементы переносятся в l2,
+// если l1 сообщает о вытеснении (метод OnEvict).
+func New[KeyT comparable, ValueT any](l1, l2 Cacher[KeyT, ValueT], opts Options) *Cache[KeyT, ValueT] {
+	if opts.Clock == nil {
+		opts.Clock = pkg.SystemClock
+	}
+	c := &Cache[KeyT, ValueT]{
+		l1:   l1,
+		l2:   l2,
+		opts: opts,
+	}
+	if notifier, ok := l1.(evictNotifier[KeyT, ValueT]); ok && opts.Mode == Exclusive {
+		notifier.OnEvict(c.demote)
+	}
+	return c
+}
+
+// Get ищет значение в L1, затем в L2.
+func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	if value, ok := c.l1.Get(key); ok {
+		c.l1Stats.hits.Add(1)
+		return value, true
+	}
+	c.l1Stats.misses.Add(1)
+
+	if !c.opts.Promote {
+		return c.getL2(key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.getL2(key)
+	if !ok {
+		return value, false
+	}
+	ttl, ok := c.promoteTTL(key)
+	if !ok {
+		// Элемент истек в L2 сразу после чтения
+		return value, true
+	}
+	if c.opts.Mode == Exclusive {
+		deleteFrom(c.l2, key)
+	}
+	c.l1.Put(key, value, ttl)
+	c.l1Stats.puts.Add(1)
+	c.promotions.Add(1)
+	return value, true
+}
+
+// promoteTTL возвращает время жизни переносимого в L1 элемента: меньшее из PromoteTTL
+// и оставшегося в L2. Второе значение false, если ключа в L2 уже нет.
+func (c *Cache[KeyT, ValueT]) promoteTTL(key KeyT) (time.Duration, bool) {
+	ttl := c.opts.PromoteTTL
+	level, ok := c.l2.(TTLer[KeyT])
+	if !ok {
+		return ttl, true
+	}
+	left, ok := level.TTL(key)
+	if !ok {
+		return 0, false
+	}
+	if left > 0 && (ttl == 0 || left < ttl) {
+		ttl = left
+	}
+	return ttl, true
+}
+
+func (c *Cache[KeyT, ValueT]) getL2(key KeyT) (ValueT, bool) {
+	value, ok := c.l2.Get(key)
+	if ok {
+		c.l2Stats.hits.Add(1)
+	} else {
+		c.l2Stats.misses.Add(1)
+	}
+	return value, ok
+}
+
+// Put записывает значение согласно WritePolicy и Mode.
+func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.opts.Write == WriteAround {
+		c.l2.Put(key, value, ttl)
+		c.l2Stats.puts.Add(1)
+		deleteFrom(c.l1, key)
+		return
+	}
+
+	c.l1.Put(key, value, ttl)
+	c.l1Stats.puts.Add(1)
+	if c.opts.Mode == Exclusive {
+		deleteFrom(c.l2, key)
+		return
+	}
+	c.l2.Put(key, value, ttl)
+	c.l2Stats.puts.Add(1)
+}
+
+// Delete удаляет ключ с обоих уровней, поддерживающих удаление.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deleted := deleteFrom(c.l1, key)
+	if deleteFrom(c.l2, key) {
+		deleted = true
+	}
+	return deleted
+}
+
+// Stats возвращает счетчики обоих уровней.
+func (c *Cache[KeyT, ValueT]) Stats() Stats {
+	return Stats{
+		L1:         c.l1Stats.stats(),
+		L2:         c.l2Stats.stats(),
+		Promotions: c.promotions.Load(),
+		Demotions:  c.demotions.Load(),
+	}
+}
+
+// demote переносит в L2 элемент, вытесненный из L1 при переполнении.
+// Вызывается под блокировкой L1, которая не пересекается с блокировкой L2.
+func (c *Cache[KeyT, ValueT]) demote(e pkg.Eviction[KeyT, ValueT]) {
+	if e.Reason != pkg.EvictCapacity {
+		return
+	}
+	var ttl time.Duration
+	if !e.ExpiresAt.IsZero() {
+		ttl = e.ExpiresAt.Sub(c.opts.Clock.Now())
+		if ttl <= 0 {
+			return
+		}
+	}
+	c.l2.Put(e.Key, e.Value, ttl)
+	c.l2Stats.puts.Add(1)
+	c.demotions.Add(1)
+}
+
+func deleteFrom[KeyT comparable, ValueT any](level Cacher[KeyT, ValueT], key KeyT) bool {
+	if deleter, ok := level.(Deleter[KeyT]); ok {
+		return deleter.Delete(key)
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package tiered
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// mapCache - уровень без удаления и уведомлений о вытеснении, как сетевой клиент
+type mapCache map[string]string
+
+func (m mapCache) Get(key string) (string, bool) {
+	v, ok := m[key]
+	return v, ok
+}
+
+func (m mapCache) Put(key string, value string, ttl time.Duration) {
+	m[key] = value
+}
+
+func TestInclusiveWriteThrough(t *testing.T) {
+	l1 := lru.NewCache[string, string](1)
+	l2 := mapCache{}
+	cache := New[string, string](l1, l2, Options{Promote: true})
+
+	cache.Put("key1", "value1", 0)
+	cache.Put("key2", "value2", 0) // вытесняет key1 из L1
+	if l2["key1"] != "value1" || l2["key2"] != "value2" {
+		t.Errorf("Expected both keys in L2, got %v", l2)
+	}
+
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected value1, got %v (found: %v)", v, found)
+	}
+	if !l1.Contains("key1") {
+		t.Error("Expected key1 to be promoted to L1")
+	}
+	if _, found := l2["key1"]; !found {
+		t.Error("Expected key1 to stay in inclusive L2")
+	}
+
+	st := cache.Stats()
+	if st.L1.Misses != 1 || st.L2.Hits != 1 || st.Promotions != 1 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	l1 := lru.NewCache[string, string](1)
+	l2 := lfu.NewCache[string, string](10)
+	cache := New[string, string](l1, l2, Options{Mode: Exclusive, Promote: true})
+
+	cache.Put("key1", "value1", 0)
+	if l2.Contains("key1") {
+		t.Error("Expected key1 only in L1")
+	}
+
+	cache.Put("key2", "value2", 0) // key1 переносится в L2
+	if !l2.Contains("key1") {
+		t.Error("Expected key1 to be demoted to L2")
+	}
+
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected value1, got %v (found: %v)", v, found)
+	}
+	if l2.Contains("key1") {
+		t.Error("Expected promoted key1 to leave L2")
+	}
+	if !l2.Contains("key2") {
+		t.Error("Expected key2 to be demoted to L2")
+	}
+
+	st := cache.Stats()
+	if st.Promotions != 1 || st.Demotions != 2 {
+		t.Errorf("Unexpected stats %+v", st)
+	}
+}
+
+func TestPromoteKeepsTTL(t *testing.T) {
+	clock := cachetest.NewClock(cachetest.Start)
+	l1 := lru.NewCache[string, string](1)
+	l2 := lru.NewCache[string, string](10)
+	l1.SetClock(clock)
+	l2.SetClock(clock)
+	cache := New[string, string](l1, l2, Options{Mode: Exclusive, Promote: true, PromoteTTL: time.Hour, Clock: clock})
+
+	cache.Put("key1", "value1", time.Minute)
+	cache.Put("key2", "value2", 0) // key1 переносится в L2
+	clock.Advance(20 * time.Second)
+
+	if _, found := cache.Get("key1"); !found {
+		t.Fatal("Expected key1 in L2")
+	}
+	if ttl, ok := l1.TTL("key1"); !ok || ttl != 40*time.Second {
+		t.Errorf("Expected promoted key1 to keep 40s, got %v (found: %v)", ttl, ok)
+	}
+
+	clock.Advance(40 * time.Second)
+	if _, found := cache.Get("key1"); found {
+		t.Error("Expected key1 to expire after round trip through L2")
+	}
+}
+
+func TestWriteAround(t *testing.T) {
+	l1 := lru.NewCache[string, string](2)
+	l2 := mapCache{}
+	cache := New[string, string](l1, l2, Options{Write: WriteAround})
+
+	cache.Put("key1", "value1", 0)
+	if l1.Contains("key1") {
+		t.Error("Expected write-around Put to skip L1")
+	}
+
+	l1.Put("key1", "stale", 0)
+	cache.Put("key1", "value_updated", 0)
+	if v, found := cache.Get("key1"); !found || v != "value_updated" {
+		t.Errorf("Expected value_updated, got %v (found: %v)", v, found)
+	}
+	if l1.Contains("key1") {
+		t.Error("Expected L2 hit not to be promoted without Promote")
+	}
+}
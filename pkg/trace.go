@@ -0,0 +1,71 @@
+package pkg
+
+import "sync/atomic"
+
+// Операции, о которых кэши сообщают Tracer.
+const (
+	OpGet   = "cache.get"
+	OpPut   = "cache.put"
+	OpLoad  = "cache.load" // вызов загрузчика GetOrLoad
+	OpEvict = "cache.evict"
+)
+
+// Ключи атрибутов span'ов.
+const (
+	AttrPolicy = "cache.policy" // "lru" или "lfu"
+	AttrKey    = "cache.key"
+	AttrHit    = "cache.hit"    // bool, в End span'а cache.get
+	AttrReason = "cache.reason" // EvictReason.String() в cache.evict
+	AttrError  = "error"        // error загрузчика в End span'а cache.load
+)
+
+// Attr - атрибут span'а.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// Tracer получает span'ы операций кэша, например чтобы передать их в OpenTelemetry.
+// Start вызывается до взятия блокировки кэша, End - после ее освобождения, поэтому
+// длительность span'а включает ожидание блокировки. Span'ы cache.evict открываются
+// и закрываются под блокировкой кэша. Методы вызываются из разных горутин одновременно.
+type Tracer interface {
+	Start(op string, attrs ...Attr) Span
+}
+
+// Span - начатая операция.
+type Span interface {
+	End(attrs ...Attr)
+}
+
+// NopTracer ничего не делает. Установка NopTracer равносильна отключению трассировки.
+type NopTracer struct{}
+
+func (NopTracer) Start(string, ...Attr) Span { return nopSpan{} }
+
+type nopSpan struct{}
+
+func (nopSpan) End(...Attr) {}
+
+// Trace хранит Tracer кэша. Нулевое значение - трассировка отключена.
+type Trace struct {
+	tracer atomic.Pointer[Tracer]
+}
+
+// Set устанавливает tracer. nil и NopTracer отключают трассировку.
+func (t *Trace) Set(tracer Tracer) {
+	if _, nop := tracer.(NopTracer); tracer == nil || nop {
+		t.tracer.Store(nil)
+		return
+	}
+	t.tracer.Store(&tracer)
+}
+
+// Tracer возвращает установленный Tracer или nil. Вызывающий проверяет nil до того, как
+// собирать атрибуты, поэтому отключенная трассировка не выделяет память.
+func (t *Trace) Tracer() Tracer {
+	if p := t.tracer.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
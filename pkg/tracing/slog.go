@@ -0,0 +1,52 @@
+// Package tracing содержит адаптеры pkg.Tracer. Адаптер для OpenTelemetry или другой системы
+// трассировки пишется так же, как Slog: Start открывает span и переводит атрибуты, End закрывает его.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+)
+
+// Slog пишет завершенные span'ы в Logger с именем операции, длительностью и атрибутами.
+type Slog struct {
+	Logger *slog.Logger
+	// Level - уровень записей, по умолчанию slog.LevelDebug.
+	Level slog.Level
+	// MinDuration отбрасывает операции быстрее заданной длительности.
+	MinDuration time.Duration
+}
+
+// NewSlog создает адаптер, пишущий в logger на уровне Debug.
+func NewSlog(logger *slog.Logger) *Slog {
+	return &Slog{Logger: logger, Level: slog.LevelDebug}
+}
+
+// Start начинает span операции op.
+func (t *Slog) Start(op string, attrs ...pkg.Attr) pkg.Span {
+	return &slogSpan{tracer: t, op: op, attrs: attrs, start: time.Now()}
+}
+
+type slogSpan struct {
+	tracer *Slog
+	op     string
+	attrs  []pkg.Attr
+	start  time.Time
+}
+
+func (s *slogSpan) End(attrs ...pkg.Attr) {
+	elapsed := time.Since(s.start)
+	if elapsed < s.tracer.MinDuration || !s.tracer.Logger.Enabled(context.Background(), s.tracer.Level) {
+		return
+	}
+	args := make([]slog.Attr, 0, len(s.attrs)+len(attrs)+1)
+	args = append(args, slog.Duration("duration", elapsed))
+	for _, list := range [][]pkg.Attr{s.attrs, attrs} {
+		for _, attr := range list {
+			args = append(args, slog.Any(attr.Key, attr.Value))
+		}
+	}
+	s.tracer.Logger.LogAttrs(context.Background(), s.tracer.Level, s.op, args...)
+}
@@ -0,0 +1,123 @@
+package tracing
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+)
+
+// recorder запоминает завершенные span'ы в виде строк
+type recorder struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *recorder) Start(op string, attrs ...pkg.Attr) pkg.Span {
+	return &recordedSpan{r: r, op: op, attrs: attrs}
+}
+
+type recordedSpan struct {
+	r     *recorder
+	op    string
+	attrs []pkg.Attr
+}
+
+func (s *recordedSpan) End(attrs ...pkg.Attr) {
+	line := s.op
+	for _, attr := range append(s.attrs, attrs...) {
+		line += fmt.Sprintf(" %s=%v", attr.Key, attr.Value)
+	}
+	s.r.mu.Lock()
+	s.r.spans = append(s.r.spans, line)
+	s.r.mu.Unlock()
+}
+
+// tracedCache - общие методы lru.Cache и lfu.Cache
+type tracedCache interface {
+	Get(key string) (int, bool)
+	Put(key string, value int, ttl time.Duration)
+	GetOrLoad(key string, ttl time.Duration, load func(string) (int, error)) (int, error)
+	SetTracer(tracer pkg.Tracer)
+}
+
+func TestCacheSpans(t *testing.T) {
+	for policy, cache := range map[string]tracedCache{
+		"lru": lru.NewCache[string, int](1),
+		"lfu": lfu.NewCache[string, int](1),
+	} {
+		rec := &recorder{}
+		cache.SetTracer(rec)
+		cache.Put("a", 1, 0)
+		cache.Get("a")
+		cache.GetOrLoad("b", 0, func(string) (int, error) { return 0, errors.New("down") })
+		cache.GetOrLoad("b", 0, func(string) (int, error) { return 2, nil })
+
+		p := "cache.policy=" + policy
+		want := []string{
+			"cache.put " + p + " cache.key=a",
+			"cache.get " + p + " cache.key=a cache.hit=true",
+			"cache.get " + p + " cache.key=b cache.hit=false",
+			"cache.load " + p + " cache.key=b error=down",
+			"cache.get " + p + " cache.key=b cache.hit=false",
+			"cache.load " + p + " cache.key=b error=<nil>",
+			"cache.evict " + p + " cache.key=a cache.reason=capacity",
+			"cache.put " + p + " cache.key=b",
+		}
+		if fmt.Sprint(rec.spans) != fmt.Sprint(want) {
+			t.Errorf("%s spans\n%q\nwant\n%q", policy, rec.spans, want)
+		}
+
+		cache.SetTracer(nil)
+		cache.Get("a")
+		if len(rec.spans) != len(want) {
+			t.Errorf("%s: span recorded after SetTracer(nil)", policy)
+		}
+	}
+}
+
+func TestDisabledTracingAllocs(t *testing.T) {
+	for policy, cache := range map[string]tracedCache{
+		"lru": lru.NewCache[string, int](10),
+		"lfu": lfu.NewCache[string, int](10),
+	} {
+		cache.SetTracer(pkg.NopTracer{})
+		cache.Put("a", 1, 0)
+		allocs := testing.AllocsPerRun(100, func() {
+			cache.Get("a")
+			cache.Get("missing")
+			cache.Put("a", 2, 0)
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocs with tracing disabled", policy, allocs)
+		}
+	}
+}
+
+func ExampleSlog() {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// Время и длительность меняются от запуска к запуску
+			if a.Key == slog.TimeKey || a.Key == "duration" {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	cache := lru.NewCache[string, string](100)
+	cache.SetTracer(NewSlog(logger))
+
+	cache.Put("greeting", "hello", 0)
+	cache.Get("greeting")
+	// Output:
+	// level=DEBUG msg=cache.put cache.policy=lru cache.key=greeting
+	// level=DEBUG msg=cache.get cache.policy=lru cache.key=greeting cache.hit=true
+}
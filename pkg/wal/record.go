@@ -0,0 +1,129 @@
+package wal
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Формат записи журнала:
+//
+//	[0:4] CRC-32 (Castagnoli) полезной нагрузки
+//	[4:8] длина полезной нагрузки
+//	[8:]  операция, ключ, для opPut - значение и время истечения в наносекундах Unix,
+//	      для opExpire - время истечения удаленного элемента
+const (
+	recordHeaderSize = 8
+	maxRecordSize    = 1 << 30
+)
+
+const (
+	opPut byte = iota + 1
+	opDelete
+	opExpire
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// errTornRecord означает, что запись обрезана или повреждена.
+var errTornRecord = errors.New("wal: torn record")
+
+type record struct {
+	op        byte
+	key       []byte
+	value     []byte
+	expiresAt int64
+}
+
+// appendRecord дописывает закодированную запись в buf.
+func appendRecord(buf []byte, rec record) []byte {
+	start := len(buf)
+	buf = append(buf, make([]byte, recordHeaderSize)...)
+	buf = append(buf, rec.op)
+	buf = binary.AppendUvarint(buf, uint64(len(rec.key)))
+	buf = append(buf, rec.key...)
+	if rec.op == opPut {
+		buf = binary.AppendUvarint(buf, uint64(len(rec.value)))
+		buf = append(buf, rec.value...)
+		buf = binary.AppendVarint(buf, rec.expiresAt)
+	}
+	if rec.op == opExpire {
+		buf = binary.AppendVarint(buf, rec.expiresAt)
+	}
+
+	payload := buf[start+recordHeaderSize:]
+	binary.BigEndian.PutUint32(buf[start:], crc32.Checksum(payload, castagnoli))
+	binary.BigEndian.PutUint32(buf[start+4:], uint32(len(payload)))
+	return buf
+}
+
+// readRecord читает очередную запись. В конце потока возвращает io.EOF,
+// для обрезанной или поврежденной записи - errTornRecord.
+func readRecord(r *bufio.Reader) (record, int, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return record{}, 0, io.EOF
+		}
+		return record{}, 0, errTornRecord
+	}
+	sum := binary.BigEndian.Uint32(header[:])
+	size := binary.BigEndian.Uint32(header[4:])
+	if size == 0 || size > maxRecordSize {
+		return record{}, 0, errTornRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record{}, 0, errTornRecord
+	}
+	if crc32.Checksum(payload, castagnoli) != sum {
+		return record{}, 0, errTornRecord
+	}
+
+	rec, ok := decodePayload(payload)
+	if !ok {
+		return record{}, 0, errTornRecord
+	}
+	return rec, recordHeaderSize + int(size), nil
+}
+
+func decodePayload(payload []byte) (record, bool) {
+	rec := record{op: payload[0]}
+	rest := payload[1:]
+
+	var ok bool
+	if rec.key, rest, ok = readField(rest); !ok {
+		return rec, false
+	}
+	switch rec.op {
+	case opPut:
+		if rec.value, rest, ok = readField(rest); !ok {
+			return rec, false
+		}
+		expiresAt, n := binary.Varint(rest)
+		if n <= 0 {
+			return rec, false
+		}
+		rec.expiresAt = expiresAt
+	case opExpire:
+		expiresAt, n := binary.Varint(rest)
+		if n <= 0 {
+			return rec, false
+		}
+		rec.expiresAt = expiresAt
+	case opDelete:
+	default:
+		return rec, false
+	}
+	return rec, true
+}
+
+func readField(data []byte) ([]byte, []byte, bool) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, false
+	}
+	return data[n : n+int(size)], data[n+int(size):], true
+}
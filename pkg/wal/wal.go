@@ -0,0 +1,588 @@
+// Package wal делает кэш устойчивым к падению процесса: каждая операция Put и Delete,
+// а также истечение срока жизни дописываются в журнал (append-only file), который
+// проигрывается в кэш при следующем запуске.
+//
+// Каталог журнала содержит сегменты NNNNNN.wal и снимок snapshot-NNNNNN.snap,
+// покрывающий все операции до сегмента NNNNNN. Перезапись журнала сохраняет живое
+// содержимое кэша в новый снимок и удаляет покрытые им сегменты.
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+// SyncPolicy определяет, как часто журнал сбрасывается на диск.
+type SyncPolicy int
+
+const (
+	// SyncEverySecond сбрасывает журнал на диск раз в секунду.
+	SyncEverySecond SyncPolicy = iota
+	// SyncAlways сбрасывает журнал на диск после каждой записи.
+	SyncAlways
+	// SyncNever оставляет сброс на диск операционной системе.
+	SyncNever
+)
+
+const (
+	segmentSuffix      = ".wal"
+	snapshotPrefix     = "snapshot-"
+	snapshotSuffix     = ".snap"
+	defaultSegmentSize = 64 << 20
+)
+
+// ErrCorrupt возвращается, если поврежден сегмент, который не является последним.
+var ErrCorrupt = errors.New("wal: corrupted segment")
+
+// Backend - кэш, операции которого записываются в журнал. Его реализуют lru.Cache и lfu.Cache.
+type Backend[KeyT comparable, ValueT any] interface {
+	Get(key KeyT) (ValueT, bool)
+	GetEntry(key KeyT) (pkg.Entry[KeyT, ValueT], bool)
+	Put(key KeyT, value ValueT, ttl time.Duration)
+	Delete(key KeyT) bool
+	OnEvict(fn func(e pkg.Eviction[KeyT, ValueT]))
+	SaveTo(w io.Writer, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error
+	LoadFrom(r io.Reader, keys snapshot.Codec[KeyT], values snapshot.Codec[ValueT]) error
+}
+
+// clocked реализуют backend, сообщающие свои часы.
+type clocked interface {
+	Clock() pkg.Clock
+}
+
+// Options - настройки журнала. Нулевое значение допустимо.
+type Options[KeyT comparable, ValueT any] struct {
+	Sync SyncPolicy
+	// SegmentSize - размер сегмента, после которого начинается новый. По умолчанию 64 МиБ.
+	SegmentSize int64
+	// RewriteSize - суммарный размер сегментов, после которого журнал перезаписывается
+	// в фоне. 0 отключает автоматическую перезапись.
+	RewriteSize int64
+	// Keys и Values кодируют ключи и значения. По умолчанию snapshot.Gob.
+	Keys   snapshot.Codec[KeyT]
+	Values snapshot.Codec[ValueT]
+	// Clock - часы, по которым считаются сроки жизни в журнале. По умолчанию - часы
+	// backend, если он их сообщает (метод Clock, как у lru.Cache и lfu.Cache),
+	// иначе pkg.SystemClock.
+	Clock pkg.Clock
+}
+
+// Cache записывает изменения backend в журнал и реализует тот же набор операций.
+type Cache[KeyT comparable, ValueT any] struct {
+	backend Backend[KeyT, ValueT]
+	dir     string
+	opts    Options[KeyT, ValueT]
+
+	// mu упорядочивает запись в журнал и применение операции к кэшу
+	mu sync.Mutex
+
+	fileMu  sync.Mutex
+	seg     *os.File
+	segID   int
+	segSize int64
+	logSize int64
+	dirty   bool
+	buf     []byte
+	err     error
+	// closed запрещает запуск фоновой перезаписи после начала Close
+	closed bool
+
+	rewriteMu sync.Mutex
+	rewriting atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// Open восстанавливает содержимое backend из каталога dir и начинает записывать в него журнал.
+func Open[KeyT comparable, ValueT any](dir string, backend Backend[KeyT, ValueT], opts Options[KeyT, ValueT]) (*Cache[KeyT, ValueT], error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if opts.Keys == nil {
+		opts.Keys = snapshot.Gob[KeyT]{}
+	}
+	if opts.Values == nil {
+		opts.Values = snapshot.Gob[ValueT]{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = pkg.SystemClock
+		if clocked, ok := backend.(clocked); ok {
+			opts.Clock = clocked.Clock()
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache[KeyT, ValueT]{
+		backend: backend,
+		dir:     dir,
+		opts:    opts,
+		done:    make(chan struct{}),
+	}
+	next, err := c.replay()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.openSegment(next); err != nil {
+		return nil, err
+	}
+	// Сегменты, оставшиеся от прерванной перезаписи, уже покрыты снимком
+	if err := c.removeBefore(c.snapshotID()); err != nil {
+		return nil, err
+	}
+
+	// Обработчик вызывается под блокировкой backend без c.mu, поэтому запись об истечении
+	// может попасть в журнал после Put того же ключа. Время истечения в записи позволяет
+	// при проигрывании не удалять более новое значение.
+	backend.OnEvict(func(e pkg.Eviction[KeyT, ValueT]) {
+		if e.Reason == pkg.EvictExpired {
+			c.append(opExpire, e.Key, nil, e.ExpiresAt.UnixNano())
+		}
+	})
+
+	if opts.Sync == SyncEverySecond {
+		c.wg.Add(1)
+		go c.syncLoop()
+	}
+	return c, nil
+}
+
+// Get возвращает значение из кэша. Чтения в журнал не пишутся.
+func (c *Cache[KeyT, ValueT]) Get(key KeyT) (ValueT, bool) {
+	return c.backend.Get(key)
+}
+
+// Put записывает операцию в журнал и применяет ее к кэшу.
+func (c *Cache[KeyT, ValueT]) Put(key KeyT, value ValueT, ttl time.Duration) {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = c.opts.Clock.Now().Add(ttl).UnixNano()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.append(opPut, key, &value, expiresAt)
+	c.backend.Put(key, value, ttl)
+}
+
+// Delete записывает удаление в журнал и удаляет ключ из кэша.
+func (c *Cache[KeyT, ValueT]) Delete(key KeyT) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.append(opDelete, key, nil, 0)
+	return c.backend.Delete(key)
+}
+
+// Err возвращает первую ошибку записи журнала.
+func (c *Cache[KeyT, ValueT]) Err() error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	return c.err
+}
+
+// Sync сбрасывает журнал на диск.
+func (c *Cache[KeyT, ValueT]) Sync() error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	return c.syncLocked()
+}
+
+// Close дожидается фоновой перезаписи, сбрасывает журнал на диск и закрывает его.
+// Возвращает первую ошибку записи журнала. Повторный вызов только возвращает ошибку.
+func (c *Cache[KeyT, ValueT]) Close() error {
+	c.closeOnce.Do(func() {
+		// Фоновая перезапись запускается под fileMu, поэтому после этого
+		// wg.Add больше не вызывается и wg.Wait не пропустит ее
+		c.fileMu.Lock()
+		c.closed = true
+		c.fileMu.Unlock()
+
+		close(c.done)
+		c.wg.Wait()
+
+		c.fileMu.Lock()
+		defer c.fileMu.Unlock()
+
+		c.setErrLocked(c.syncLocked())
+		c.setErrLocked(c.seg.Close())
+	})
+	return c.Err()
+}
+
+// Rewrite сохраняет живое содержимое кэша в новый снимок и удаляет сегменты, которые он покрывает.
+// Запись в кэш во время перезаписи не блокируется.
+func (c *Cache[KeyT, ValueT]) Rewrite() error {
+	c.rewriteMu.Lock()
+	defer c.rewriteMu.Unlock()
+
+	// Все операции, примененные до смены сегмента, попадут в снимок
+	c.mu.Lock()
+	c.fileMu.Lock()
+	id := c.segID + 1
+	err := c.rotateLocked(id)
+	c.fileMu.Unlock()
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeSnapshot(id); err != nil {
+		return err
+	}
+
+	if err := c.removeBefore(id); err != nil {
+		return err
+	}
+	return c.updateLogSize(id)
+}
+
+// snapshotID возвращает номер последнего снимка или 0, если снимков нет.
+func (c *Cache[KeyT, ValueT]) snapshotID() int {
+	_, snapshots, err := listDir(c.dir)
+	if err != nil || len(snapshots) == 0 {
+		return 0
+	}
+	return snapshots[len(snapshots)-1]
+}
+
+func (c *Cache[KeyT, ValueT]) writeSnapshot(id int) error {
+	name := filepath.Join(c.dir, snapshotName(id))
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = c.backend.SaveTo(f, c.opts.Keys, c.opts.Values)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(name+".tmp", name)
+	}
+	if err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	return syncDir(c.dir)
+}
+
+// removeBefore удаляет сегменты и снимки, предшествующие снимку id.
+func (c *Cache[KeyT, ValueT]) removeBefore(id int) error {
+	segments, snapshots, err := listDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		if seg < id {
+			if err := os.Remove(filepath.Join(c.dir, segmentName(seg))); err != nil {
+				return err
+			}
+		}
+	}
+	for _, snap := range snapshots {
+		if snap < id {
+			if err := os.Remove(filepath.Join(c.dir, snapshotName(snap))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateLogSize пересчитывает размер сегментов, не покрытых снимком id.
+func (c *Cache[KeyT, ValueT]) updateLogSize(id int) error {
+	segments, _, err := listDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	var size int64
+	for _, seg := range segments {
+		if seg == c.segID {
+			size += c.segSize
+		} else if seg >= id {
+			info, err := os.Stat(filepath.Join(c.dir, segmentName(seg)))
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+	}
+	c.logSize = size
+	return nil
+}
+
+// append кодирует и дописывает запись в текущий сегмент.
+func (c *Cache[KeyT, ValueT]) append(op byte, key KeyT, value *ValueT, expiresAt int64) {
+	rec := record{op: op, expiresAt: expiresAt}
+	var err error
+	if rec.key, err = c.opts.Keys.Marshal(key); err != nil {
+		c.fileMu.Lock()
+		c.setErrLocked(fmt.Errorf("wal: encode key: %w", err))
+		c.fileMu.Unlock()
+		return
+	}
+	if value != nil {
+		if rec.value, err = c.opts.Values.Marshal(*value); err != nil {
+			c.fileMu.Lock()
+			c.setErrLocked(fmt.Errorf("wal: encode value: %w", err))
+			c.fileMu.Unlock()
+			return
+		}
+	}
+
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+
+	c.buf = appendRecord(c.buf[:0], rec)
+	n, err := c.seg.Write(c.buf)
+	c.segSize += int64(n)
+	c.logSize += int64(n)
+	if err != nil {
+		c.setErrLocked(err)
+		return
+	}
+	c.dirty = true
+	if c.opts.Sync == SyncAlways {
+		c.setErrLocked(c.syncLocked())
+	}
+
+	if c.segSize >= c.opts.SegmentSize {
+		c.setErrLocked(c.rotateLocked(c.segID + 1))
+	}
+	if !c.closed && c.opts.RewriteSize > 0 && c.logSize >= c.opts.RewriteSize && c.rewriting.CompareAndSwap(false, true) {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			defer c.rewriting.Store(false)
+			if err := c.Rewrite(); err != nil {
+				c.fileMu.Lock()
+				c.setErrLocked(err)
+				c.fileMu.Unlock()
+			}
+		}()
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) syncLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.fileMu.Lock()
+			c.setErrLocked(c.syncLocked())
+			c.fileMu.Unlock()
+		}
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) syncLocked() error {
+	if !c.dirty {
+		return nil
+	}
+	c.dirty = false
+	return c.seg.Sync()
+}
+
+func (c *Cache[KeyT, ValueT]) setErrLocked(err error) {
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+// rotateLocked закрывает текущий сегмент и открывает сегмент id.
+func (c *Cache[KeyT, ValueT]) rotateLocked(id int) error {
+	if err := c.syncLocked(); err != nil {
+		return err
+	}
+	if err := c.seg.Close(); err != nil {
+		return err
+	}
+	return c.openSegment(id)
+}
+
+func (c *Cache[KeyT, ValueT]) openSegment(id int) error {
+	f, err := os.OpenFile(filepath.Join(c.dir, segmentName(id)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.seg = f
+	c.segID = id
+	c.segSize = info.Size()
+	return syncDir(c.dir)
+}
+
+// replay загружает последний снимок и проигрывает сегменты после него.
+// Возвращает номер сегмента, в который продолжится запись.
+func (c *Cache[KeyT, ValueT]) replay() (int, error) {
+	segments, snapshots, err := listDir(c.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	next := 1
+	if len(snapshots) > 0 {
+		next = snapshots[len(snapshots)-1]
+		f, err := os.Open(filepath.Join(c.dir, snapshotName(next)))
+		if err != nil {
+			return 0, err
+		}
+		err = c.backend.LoadFrom(f, c.opts.Keys, c.opts.Values)
+		f.Close()
+		if err != nil {
+			return 0, fmt.Errorf("wal: load snapshot: %w", err)
+		}
+	}
+
+	for i, seg := range segments {
+		if seg < next {
+			continue
+		}
+		size, err := c.replaySegment(seg, i == len(segments)-1)
+		if err != nil {
+			return 0, err
+		}
+		c.logSize += size
+		next = seg + 1
+	}
+	return next, nil
+}
+
+// replaySegment применяет записи сегмента к backend. Обрезанный хвост последнего
+// сегмента, оставшийся после падения, отбрасывается.
+func (c *Cache[KeyT, ValueT]) replaySegment(id int, last bool) (int64, error) {
+	name := filepath.Join(c.dir, segmentName(id))
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, n, err := readRecord(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err == errTornRecord {
+			if !last {
+				return 0, fmt.Errorf("%w: %s at offset %d", ErrCorrupt, segmentName(id), offset)
+			}
+			return offset, os.Truncate(name, offset)
+		}
+		if err := c.apply(rec); err != nil {
+			return 0, err
+		}
+		offset += int64(n)
+	}
+}
+
+func (c *Cache[KeyT, ValueT]) apply(rec record) error {
+	var key KeyT
+	if err := c.opts.Keys.Unmarshal(rec.key, &key); err != nil {
+		return fmt.Errorf("wal: decode key: %w", err)
+	}
+	switch rec.op {
+	case opDelete:
+		c.backend.Delete(key)
+		return nil
+	case opExpire:
+		// Ключ удаляется, только если в кэше элемент со сроком не позже истекшего.
+		// Более поздний срок или его отсутствие означают, что ключ записан заново
+		if e, ok := c.backend.GetEntry(key); ok && !e.ExpiresAt.IsZero() && e.ExpiresAt.UnixNano() <= rec.expiresAt {
+			c.backend.Delete(key)
+		}
+		return nil
+	}
+
+	var value ValueT
+	if err := c.opts.Values.Unmarshal(rec.value, &value); err != nil {
+		return fmt.Errorf("wal: decode value: %w", err)
+	}
+	var ttl time.Duration
+	if rec.expiresAt != 0 {
+		ttl = time.Unix(0, rec.expiresAt).Sub(c.opts.Clock.Now())
+		if ttl <= 0 {
+			c.backend.Delete(key)
+			return nil
+		}
+	}
+	c.backend.Put(key, value, ttl)
+	return nil
+}
+
+func segmentName(id int) string {
+	return fmt.Sprintf("%06d%s", id, segmentSuffix)
+}
+
+func snapshotName(id int) string {
+	return fmt.Sprintf("%s%06d%s", snapshotPrefix, id, snapshotSuffix)
+}
+
+// listDir возвращает отсортированные номера сегментов и снимков в каталоге.
+func listDir(dir string) (segments []int, snapshots []int, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix):
+			if id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)); err == nil {
+				snapshots = append(snapshots, id)
+			}
+		case strings.HasSuffix(name, segmentSuffix):
+			if id, err := strconv.Atoi(strings.TrimSuffix(name, segmentSuffix)); err == nil {
+				segments = append(segments, id)
+			}
+		}
+	}
+	sort.Ints(segments)
+	sort.Ints(snapshots)
+	return segments, snapshots, nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
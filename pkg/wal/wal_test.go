@@ -0,0 +1,254 @@
+package wal
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ivansevryukov1995/cache-sev/pkg/cachetest"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lfu"
+	"github.com/ivansevryukov1995/cache-sev/pkg/lru"
+	"github.com/ivansevryukov1995/cache-sev/pkg/snapshot"
+)
+
+func openLRU(t *testing.T, dir string, opts Options[string, string]) (*Cache[string, string], *lru.Cache[string, string]) {
+	t.Helper()
+	backend := lru.NewCache[string, string](10)
+	cache, err := Open[string, string](dir, backend, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache, backend
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, _ := openLRU(t, dir, Options[string, string]{Sync: SyncAlways})
+	cache.Put("key1", "value1", 0)
+	cache.Put("key2", "value2", time.Hour)
+	cache.Put("key1", "value_updated", 0)
+	cache.Put("key3", "value3", 0)
+	cache.Delete("key3")
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, backend := openLRU(t, dir, Options[string, string]{})
+	defer cache.Close()
+
+	if v, found := cache.Get("key1"); !found || v != "value_updated" {
+		t.Errorf("Expected value_updated, got %v (found: %v)", v, found)
+	}
+	if _, found := cache.Get("key3"); found {
+		t.Error("Expected key3 to stay deleted")
+	}
+	if ttl, _ := backend.TTL("key2"); ttl <= 0 || ttl > time.Hour {
+		t.Errorf("Expected key2 to keep its TTL, got %v", ttl)
+	}
+}
+
+// Истечение срока жизни попадает в журнал
+func TestReplayExpired(t *testing.T) {
+	dir := t.TempDir()
+
+	clock := cachetest.NewClock(time.Time{})
+	backend := lru.NewCache[string, string](10)
+	backend.SetClock(clock)
+	cache, err := Open[string, string](dir, backend, Options[string, string]{Sync: SyncNever})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Put("key1", "value1", time.Millisecond*50)
+	clock.Advance(time.Millisecond * 50)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, segmentName(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := len(appendRecord(nil, record{op: opPut}))
+	if len(data) <= put {
+		t.Error("Expected expiry record in the log")
+	}
+
+	backend = lru.NewCache[string, string](10)
+	backend.SetClock(clock)
+	cache, err = Open[string, string](dir, backend, Options[string, string]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if _, found := cache.Get("key1"); found {
+		t.Error("Expected key1 to be expired")
+	}
+}
+
+// Запись об истечении старого значения, попавшая в журнал после нового Put того же ключа,
+// не удаляет новое значение при проигрывании
+func TestReplayStaleExpire(t *testing.T) {
+	dir := t.TempDir()
+	clock := cachetest.NewClock(time.Time{})
+	expired := clock.Now().Add(-time.Minute).UnixNano()
+	deadline := clock.Now().Add(time.Hour).UnixNano()
+	value, _ := snapshot.Gob[string]{}.Marshal("fresh")
+	var log []byte
+	for _, rec := range []record{
+		{op: opPut, key: []byte("stale"), value: value, expiresAt: deadline},
+		{op: opPut, key: []byte("fresh"), value: value},
+		{op: opExpire, key: []byte("fresh"), expiresAt: expired},
+		{op: opExpire, key: []byte("stale"), expiresAt: deadline},
+	} {
+		rec.key, _ = snapshot.Gob[string]{}.Marshal(string(rec.key))
+		log = appendRecord(log, rec)
+	}
+	if err := os.WriteFile(filepath.Join(dir, segmentName(1)), log, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := lru.NewCache[string, string](10)
+	backend.SetClock(clock)
+	cache, err := Open[string, string](dir, backend, Options[string, string]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	if v, found := cache.Get("fresh"); !found || v != "fresh" {
+		t.Errorf("Expected fresh value to survive a stale expiry, got %v (found: %v)", v, found)
+	}
+	if _, found := cache.Get("stale"); found {
+		t.Error("Expected expiry of the same deadline to delete the key")
+	}
+
+	// Запись об истечении без срока повреждена
+	payload := append([]byte{opExpire}, binary.AppendUvarint(nil, 1)...)
+	if _, ok := decodePayload(append(payload, 'k')); ok {
+		t.Error("Expected expiry record without a deadline to be rejected")
+	}
+}
+
+// Обрезанная последняя запись, оставшаяся после падения, отбрасывается
+func TestReplayTornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, _ := openLRU(t, dir, Options[string, string]{Sync: SyncAlways})
+	cache.Put("key1", "value1", 0)
+	cache.Put("key2", "value2", 0)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := filepath.Join(dir, segmentName(1))
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(name, info.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, _ = openLRU(t, dir, Options[string, string]{})
+	defer cache.Close()
+	if _, found := cache.Get("key1"); !found {
+		t.Error("Expected key1 to be restored")
+	}
+	if _, found := cache.Get("key2"); found {
+		t.Error("Expected torn key2 to be dropped")
+	}
+}
+
+// Перезапись заменяет сегменты снимком и сохраняет частоты LFU
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+
+	backend := lfu.NewCache[int, int](10)
+	cache, err := Open[int, int](dir, backend, Options[int, int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		cache.Put(i%3, i, 0)
+	}
+	if err := cache.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	cache.Put(5, 5, 0)
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, snapshots, err := listDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || segments[0] < snapshots[0] {
+		t.Errorf("Expected covered segments to be removed, got segments %v, snapshots %v", segments, snapshots)
+	}
+
+	restored := lfu.NewCache[int, int](10)
+	cache, err = Open[int, int](dir, restored, Options[int, int]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	for key, freq := range map[int]int{0: 34, 1: 33, 2: 33, 5: 1} {
+		item, ok := restored.GetEntry(key)
+		if !ok || item.Frequency != freq {
+			t.Errorf("Expected key %d with frequency %d", key, freq)
+		}
+	}
+	if v, found := cache.Get(0); !found || v != 99 {
+		t.Errorf("Expected 99, got %v (found: %v)", v, found)
+	}
+}
+
+func TestAutoRewrite(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, _ := openLRU(t, dir, Options[string, string]{SegmentSize: 256, RewriteSize: 1024})
+	for i := 0; i < 200; i++ {
+		cache.Put("key1", "value1", 0)
+	}
+	if err := cache.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, snapshots, err := listDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) == 0 {
+		t.Error("Expected background rewrite to create a snapshot")
+	}
+
+	cache, _ = openLRU(t, dir, Options[string, string]{})
+	defer cache.Close()
+	if v, found := cache.Get("key1"); !found || v != "value1" {
+		t.Errorf("Expected value1, got %v (found: %v)", v, found)
+	}
+}
+
+// Запись, продолжающаяся во время Close, не запускает перезапись после ожидания фоновых задач
+func TestCloseDuringWrites(t *testing.T) {
+	cache, _ := openLRU(t, t.TempDir(), Options[string, string]{SegmentSize: 128, RewriteSize: 256})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			cache.Put("key1", "value1", 0)
+		}
+	}()
+	cache.Close()
+	<-done
+	if cache.rewriting.Load() {
+		t.Error("Expected no rewrite to start after Close")
+	}
+}